@@ -0,0 +1,426 @@
+// Copyright 2024 Block, Inc.
+
+// Package aggregate provides cross-monitor rollups: metrics from all monitors
+// with the same value for a tag (for example, cluster=payments) are aggregated
+// (sum, max, min, avg) and sent to sinks as a synthetic monitor. Rollups are
+// configured in config.aggregate (blip.ConfigAggregate).
+//
+// Monitors are not synchronized (each LCO ticks independently), so the
+// Aggregator keeps the latest value of each rollup metric from each member and,
+// every rollup freq (aligned to the wall clock), aggregates the values that are
+// not stale. Members that stop reporting (stopped, removed, or MySQL is down)
+// are excluded after the stale duration. Counters are aggregated as per-second
+// rates (computed per member) because members collect at different times.
+package aggregate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/event"
+	"github.com/cashapp/blip/sink"
+	"github.com/cashapp/blip/status"
+)
+
+// DOMAIN is the domain of rollup metadata metrics, like the number of members.
+const DOMAIN = "aggregate"
+
+// Aggregator aggregates metrics from monitors. It's created by the server, which
+// calls Run, and monitor.Loader adds a Sink (returned by Sink) to every monitor
+// that's a member of a rollup.
+type Aggregator struct {
+	rollups []*rollup // sorted by name
+	mux     *sync.Mutex
+}
+
+type rollup struct {
+	name       string
+	tag        string
+	freq       time.Duration
+	stale      time.Duration
+	minMembers uint
+	metrics    map[string]map[string][]string // domain => metric => functions
+	sinks      blip.ConfigSinks
+	tags       map[string]string
+	groups     map[string]*group // keyed on tag value
+}
+
+// group is the set of monitors with the same tag value for one rollup.
+type group struct {
+	monitorId string             // synthetic monitor ID: rollup/value
+	members   map[string]*member // keyed on monitor ID
+	sinks     []blip.Sink        // made on first flush
+	routes    []sink.Route       // same order as sinks
+	interval  uint
+}
+
+type member struct {
+	values map[string]sample      // latest values keyed on blip.MetricKey
+	raw    map[string]counterTick // last raw counter values keyed on blip.MetricKey
+	last   time.Time              // last time metrics were received
+}
+
+type sample struct {
+	domain string
+	value  blip.MetricValue // gauge value (counters converted to rate)
+	ts     time.Time
+}
+
+type counterTick struct {
+	value float64
+	ts    time.Time
+}
+
+// New returns an Aggregator for the rollups in config.aggregate. If a rollup
+// does not set sinks, it uses config.sinks.
+func New(cfg blip.Config) (*Aggregator, error) {
+	if err := cfg.Aggregate.Validate(); err != nil {
+		return nil, err
+	}
+	a := &Aggregator{
+		rollups: make([]*rollup, 0, len(cfg.Aggregate)),
+		mux:     &sync.Mutex{},
+	}
+	for name, rcfg := range cfg.Aggregate {
+		r := &rollup{
+			name:       name,
+			tag:        rcfg.Tag,
+			minMembers: rcfg.MinMembers,
+			metrics:    map[string]map[string][]string{},
+			sinks:      rcfg.Sinks,
+			tags:       rcfg.Tags,
+			groups:     map[string]*group{},
+		}
+		if r.minMembers == 0 {
+			r.minMembers = 1
+		}
+		freq := rcfg.Freq
+		if freq == "" {
+			freq = blip.DEFAULT_AGGREGATE_FREQ
+		}
+		r.freq, _ = time.ParseDuration(freq) // already validated
+		r.stale = 2 * r.freq
+		if rcfg.Stale != "" {
+			r.stale, _ = time.ParseDuration(rcfg.Stale) // already validated
+		}
+		if len(r.sinks) == 0 {
+			r.sinks = cfg.Sinks
+		}
+		for sinkName, opts := range r.sinks {
+			if _, _, err := sink.ParseRoute(opts); err != nil {
+				return nil, fmt.Errorf("aggregate.%s: sink %s: %s", name, sinkName, err)
+			}
+		}
+		for metric, fns := range rcfg.Metrics {
+			i := strings.LastIndex(metric, ".") // already validated
+			domain := metric[:i]
+			if r.metrics[domain] == nil {
+				r.metrics[domain] = map[string][]string{}
+			}
+			r.metrics[domain][metric[i+1:]] = fns
+		}
+		a.rollups = append(a.rollups, r)
+	}
+	sort.Slice(a.rollups, func(i, j int) bool { return a.rollups[i].name < a.rollups[j].name })
+	return a, nil
+}
+
+// Sink returns a sink that sends monitor metrics to the Aggregator, or nil if
+// the monitor is not a member of any rollup (it doesn't have any rollup tag).
+func (a *Aggregator) Sink(cfg blip.ConfigMonitor) blip.Sink {
+	s := &memberSink{a: a, monitorId: cfg.MonitorId}
+	for _, r := range a.rollups {
+		if v := cfg.Tags[r.tag]; v != "" {
+			s.memberOf = append(s.memberOf, membership{r: r, value: v})
+		}
+	}
+	if len(s.memberOf) == 0 {
+		return nil
+	}
+	return s
+}
+
+// Run flushes rollups every rollup freq until stopChan is closed.
+func (a *Aggregator) Run(stopChan, doneChan chan struct{}) {
+	defer close(doneChan)
+	status.Blip("aggregate", "running %d rollups", len(a.rollups))
+	var wg sync.WaitGroup
+	for _, r := range a.rollups {
+		wg.Add(1)
+		go func(r *rollup) {
+			defer wg.Done()
+			for {
+				// Align to wall clock so rollups are at predictable times,
+				// like 10s, 20s, 30s, etc. for freq 10s
+				now := time.Now()
+				next := now.Truncate(r.freq).Add(r.freq)
+				select {
+				case <-stopChan:
+					return
+				case <-time.After(next.Sub(now)):
+				}
+				a.flush(r, next)
+			}
+		}(r)
+	}
+	wg.Wait()
+}
+
+// flush aggregates and sends the metrics for every group in the rollup.
+func (a *Aggregator) flush(r *rollup, now time.Time) {
+	type send struct {
+		g       *group
+		metrics *blip.Metrics
+	}
+	sends := []send{}
+
+	a.mux.Lock()
+	values := make([]string, 0, len(r.groups))
+	for v := range r.groups {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	for _, v := range values {
+		g := r.groups[v]
+		m := r.aggregate(g, now)
+		if m == nil {
+			continue
+		}
+		if g.sinks == nil {
+			if err := r.makeSinks(g, v); err != nil {
+				event.Errorf(event.AGGREGATE_ERROR, "%s: %s", g.monitorId, err)
+				continue
+			}
+		}
+		sends = append(sends, send{g, m})
+	}
+	a.mux.Unlock()
+
+	// Send outside the lock so slow sinks don't block members (monitors)
+	for _, s := range sends {
+		for i, snk := range s.g.sinks {
+			m := s.g.routes[i].Filter(s.metrics)
+			if m == nil {
+				continue
+			}
+			if err := snk.Send(context.Background(), m); err != nil {
+				event.MonitorReceiver{MonitorId: s.g.monitorId}.Errorf(event.SINK_SEND_ERROR, "%s: %s", snk.Name(), err)
+			}
+		}
+	}
+}
+
+// aggregate returns the rollup metrics for the group at time now, or nil if
+// there are not enough members with values that aren't stale. It also removes
+// members that haven't reported for 5x the stale duration. The caller must
+// lock the Aggregator.
+func (r *rollup) aggregate(g *group, now time.Time) *blip.Metrics {
+	type acc struct {
+		domain string
+		value  blip.MetricValue
+		n      int
+		sum    float64
+		max    float64
+		min    float64
+	}
+	accs := map[string]*acc{}
+	members := 0
+	for monitorId, mem := range g.members {
+		if now.Sub(mem.last) > 5*r.stale {
+			blip.Debug("%s: remove member %s: last reported at %s", g.monitorId, monitorId, mem.last)
+			delete(g.members, monitorId)
+			continue
+		}
+		fresh := false
+		for key, s := range mem.values {
+			if now.Sub(s.ts) > r.stale {
+				continue
+			}
+			fresh = true
+			a, ok := accs[key]
+			if !ok {
+				a = &acc{domain: s.domain, value: s.value, max: s.value.Value, min: s.value.Value}
+				accs[key] = a
+			}
+			a.n++
+			a.sum += s.value.Value
+			if s.value.Value > a.max {
+				a.max = s.value.Value
+			}
+			if s.value.Value < a.min {
+				a.min = s.value.Value
+			}
+		}
+		if fresh {
+			members++
+		}
+	}
+	if uint(members) < r.minMembers {
+		blip.Debug("%s: %d members, need %d", g.monitorId, members, r.minMembers)
+		return nil
+	}
+
+	g.interval++
+	m := &blip.Metrics{
+		Begin:     now.Add(-r.freq),
+		End:       now,
+		MonitorId: g.monitorId,
+		Plan:      DOMAIN,
+		Level:     r.name,
+		Interval:  g.interval,
+		Values: map[string][]blip.MetricValue{
+			DOMAIN: {{Name: "members", Value: float64(members), Type: blip.GAUGE}},
+		},
+	}
+	for _, a := range accs {
+		for _, fn := range r.metrics[a.domain][a.value.Name] {
+			v := blip.MetricValue{
+				Name:  a.value.Name + "_" + fn,
+				Type:  blip.GAUGE,
+				Group: a.value.Group,
+			}
+			switch fn {
+			case blip.AGGREGATE_SUM:
+				v.Value = a.sum
+			case blip.AGGREGATE_MAX:
+				v.Value = a.max
+			case blip.AGGREGATE_MIN:
+				v.Value = a.min
+			case blip.AGGREGATE_AVG:
+				v.Value = a.sum / float64(a.n)
+			}
+			m.Values[a.domain] = append(m.Values[a.domain], v)
+		}
+	}
+	return m
+}
+
+// makeSinks makes the sinks for the group. The tags for the synthetic monitor
+// are the rollup tags plus the rollup tag and its value, like cluster=payments.
+func (r *rollup) makeSinks(g *group, value string) error {
+	tags := map[string]string{r.tag: value}
+	for k, v := range r.tags {
+		tags[k] = v
+	}
+	sinkNames := make([]string, 0, len(r.sinks))
+	for sinkName := range r.sinks {
+		sinkNames = append(sinkNames, sinkName)
+	}
+	if len(sinkNames) == 0 {
+		sinkNames = append(sinkNames, sink.Default)
+	}
+	sort.Strings(sinkNames)
+	sinks := make([]blip.Sink, 0, len(sinkNames))
+	routes := make([]sink.Route, 0, len(sinkNames))
+	for _, sinkName := range sinkNames {
+		route, opts, _ := sink.ParseRoute(r.sinks[sinkName]) // validated in New
+		s, err := sink.Make(blip.SinkFactoryArgs{
+			SinkName:  sinkName,
+			MonitorId: g.monitorId,
+			Options:   opts,
+			Tags:      tags,
+		})
+		if err != nil {
+			return fmt.Errorf("sink %s: %s", sinkName, err)
+		}
+		sinks = append(sinks, s)
+		routes = append(routes, route)
+	}
+	g.sinks = sinks
+	g.routes = routes
+	return nil
+}
+
+// --------------------------------------------------------------------------
+
+type membership struct {
+	r     *rollup
+	value string // tag value
+}
+
+// memberSink is the sink added to member monitors. It saves metrics in the
+// Aggregator; it doesn't send anything.
+type memberSink struct {
+	a         *Aggregator
+	monitorId string
+	memberOf  []membership
+}
+
+var _ blip.Sink = &memberSink{}
+
+func (s *memberSink) Name() string {
+	return "aggregate"
+}
+
+func (s *memberSink) Send(ctx context.Context, m *blip.Metrics) error {
+	s.a.mux.Lock()
+	defer s.a.mux.Unlock()
+	for _, ms := range s.memberOf {
+		ms.r.record(ms.value, s.monitorId, m)
+	}
+	return nil
+}
+
+// record saves rollup metrics from the member monitor. Counters are converted
+// to per-second rates since the last value from the same member; the first value
+// of a counter, and values after a counter reset, are not saved. The caller must
+// lock the Aggregator.
+func (r *rollup) record(value, monitorId string, m *blip.Metrics) {
+	g, ok := r.groups[value]
+	if !ok {
+		g = &group{
+			monitorId: r.name + "/" + value,
+			members:   map[string]*member{},
+		}
+		r.groups[value] = g
+	}
+	mem, ok := g.members[monitorId]
+	if !ok {
+		mem = &member{
+			values: map[string]sample{},
+			raw:    map[string]counterTick{},
+		}
+		g.members[monitorId] = mem
+	}
+	mem.last = m.Begin
+
+	for domain, values := range m.Values {
+		metrics := r.metrics[domain]
+		if metrics == nil {
+			continue
+		}
+		for _, v := range values {
+			if _, ok := metrics[v.Name]; !ok {
+				continue
+			}
+			key := blip.MetricKey(domain, v.Name, v.Group)
+			switch v.Type {
+			case blip.CUMULATIVE_COUNTER, blip.DELTA_COUNTER:
+				last, ok := mem.raw[key]
+				if ok && !m.Begin.After(last.ts) {
+					continue // out of order (past interval)
+				}
+				mem.raw[key] = counterTick{value: v.Value, ts: m.Begin}
+				if !ok {
+					continue // first value
+				}
+				delta := v.Value
+				if v.Type == blip.CUMULATIVE_COUNTER {
+					if v.Value < last.value {
+						continue // counter reset
+					}
+					delta = v.Value - last.value
+				}
+				v.Value = delta / m.Begin.Sub(last.ts).Seconds()
+			}
+			v.Type = blip.GAUGE
+			v.Meta = nil
+			mem.values[key] = sample{domain: domain, value: v, ts: m.Begin}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 Block, Inc.
+
+package aggregate
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip"
+)
+
+func testConfig() blip.Config {
+	return blip.Config{
+		Aggregate: blip.ConfigAggregate{
+			"cluster": {
+				Tag:  "cluster",
+				Freq: "10s",
+				Metrics: map[string][]string{
+					"status.global.queries":         {"sum", "max"},
+					"status.global.threads_running": {"avg", "min"},
+				},
+			},
+		},
+	}
+}
+
+func send(t *testing.T, s blip.Sink, monitorId string, ts time.Time, queries, threads float64) {
+	t.Helper()
+	err := s.Send(context.Background(), &blip.Metrics{
+		Begin:     ts,
+		End:       ts,
+		MonitorId: monitorId,
+		Values: map[string][]blip.MetricValue{
+			"status.global": {
+				{Name: "queries", Value: queries, Type: blip.CUMULATIVE_COUNTER},
+				{Name: "threads_running", Value: threads, Type: blip.GAUGE},
+				{Name: "not_aggregated", Value: 1, Type: blip.GAUGE},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	a, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Monitor without the rollup tag is not a member
+	if s := a.Sink(blip.ConfigMonitor{MonitorId: "db0"}); s != nil {
+		t.Errorf("got sink for monitor without tag, expected nil")
+	}
+
+	s1 := a.Sink(blip.ConfigMonitor{MonitorId: "db1", Tags: map[string]string{"cluster": "payments"}})
+	s2 := a.Sink(blip.ConfigMonitor{MonitorId: "db2", Tags: map[string]string{"cluster": "payments"}})
+	if s1 == nil || s2 == nil {
+		t.Fatal("got nil sink for monitor with tag")
+	}
+
+	// Members aren't synchronized: db2 reports 1s after db1. Counters are
+	// aggregated as per-second rates: db1 = 100/10s, db2 = 200/10s.
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	send(t, s1, "db1", t0, 100, 2)
+	send(t, s2, "db2", t0.Add(1*time.Second), 50, 6)
+	send(t, s1, "db1", t0.Add(10*time.Second), 200, 2)
+	send(t, s2, "db2", t0.Add(11*time.Second), 250, 4)
+
+	r := a.rollups[0]
+	g := r.groups["payments"]
+	if g == nil {
+		t.Fatal("group payments not created")
+	}
+	m := r.aggregate(g, t0.Add(20*time.Second))
+	if m == nil {
+		t.Fatal("got nil metrics")
+	}
+	if m.MonitorId != "cluster/payments" {
+		t.Errorf("MonitorId = %s, expected cluster/payments", m.MonitorId)
+	}
+	sort.Slice(m.Values["status.global"], func(i, j int) bool {
+		return m.Values["status.global"][i].Name < m.Values["status.global"][j].Name
+	})
+	expect := map[string][]blip.MetricValue{
+		DOMAIN: {
+			{Name: "members", Value: 2, Type: blip.GAUGE},
+		},
+		"status.global": {
+			{Name: "queries_max", Value: 20, Type: blip.GAUGE},
+			{Name: "queries_sum", Value: 30, Type: blip.GAUGE},
+			{Name: "threads_running_avg", Value: 3, Type: blip.GAUGE},
+			{Name: "threads_running_min", Value: 2, Type: blip.GAUGE},
+		},
+	}
+	if diff := deep.Equal(m.Values, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// db2 stops reporting: after stale (2x freq = 20s), only db1 is aggregated
+	send(t, s1, "db1", t0.Add(40*time.Second), 500, 8)
+	m = r.aggregate(g, t0.Add(40*time.Second))
+	if m == nil {
+		t.Fatal("got nil metrics")
+	}
+	if diff := deep.Equal(m.Values[DOMAIN], []blip.MetricValue{{Name: "members", Value: 1, Type: blip.GAUGE}}); diff != nil {
+		t.Error(diff)
+	}
+
+	// min-members not met
+	r.minMembers = 2
+	if m := r.aggregate(g, t0.Add(40*time.Second)); m != nil {
+		t.Errorf("got metrics, expected nil when min-members not met: %+v", m)
+	}
+
+	// Members that haven't reported for 5x stale are removed
+	r.aggregate(g, t0.Add(10*time.Minute))
+	if len(g.members) != 0 {
+		t.Errorf("%d members, expected 0", len(g.members))
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	cfg := testConfig()
+	r := cfg.Aggregate["cluster"]
+	r.Metrics = map[string][]string{"queries": {"sum"}}
+	cfg.Aggregate["cluster"] = r
+	if _, err := New(cfg); err == nil {
+		t.Errorf("no error for metric without domain")
+	}
+
+	cfg = testConfig()
+	r = cfg.Aggregate["cluster"]
+	r.Metrics = map[string][]string{"status.global.queries": {"median"}}
+	cfg.Aggregate["cluster"] = r
+	if _, err := New(cfg); err == nil {
+		t.Errorf("no error for invalid function")
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -76,6 +78,25 @@ type MetricValue struct {
 	Meta map[string]string
 }
 
+// MetricKey returns a unique key for the metric like "status.global/queries"
+// or "size.table/bytes/db=test,tbl=t1" (group keys sorted). It's used to track
+// metric values across intervals, like delta and cumulative counters.
+func MetricKey(domain, name string, group map[string]string) string {
+	key := domain + "/" + name
+	if len(group) == 0 {
+		return key
+	}
+	keys := make([]string, 0, len(group))
+	for k := range group {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = k + "=" + group[k]
+	}
+	return key + "/" + strings.Join(keys, ",")
+}
+
 // Sink sends metrics to an external destination.
 type Sink interface {
 	// Send sends metrics to the sink. It must respect the context timeout, if any.
@@ -243,3 +264,23 @@ func TimeLimit(p float64, d, max time.Duration) time.Duration {
 	ns := float64(d)
 	return time.Duration(ns - math.Min(ns*p, float64(max)))
 }
+
+// Logfmt returns key-value pairs (key1, value1, key2, value2, ...) in logfmt
+// format: key1=value1 key2=value2. Values are quoted if empty or if they have
+// a space, equal sign, quote, or non-printable character.
+func Logfmt(kv ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(kv[i])
+		b.WriteByte('=')
+		v := kv[i+1]
+		if v == "" || strings.ContainsAny(v, " =") || strconv.Quote(v) != `"`+v+`"` {
+			v = strconv.Quote(v)
+		}
+		b.WriteString(v)
+	}
+	return b.String()
+}
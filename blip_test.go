@@ -45,3 +45,21 @@ func TestTimeLimit(t *testing.T) {
 		}
 	}
 }
+
+func TestLogfmt(t *testing.T) {
+	got := blip.Logfmt("a", "1", "b", "", "c", "x y", "d", `q"`, "e", "k=v", "f", "line\n")
+	expect := `a=1 b="" c="x y" d="q\"" e="k=v" f="line\n"`
+	if got != expect {
+		t.Errorf("got %s, expected %s", got, expect)
+	}
+}
+
+func TestMetricKey(t *testing.T) {
+	if got := blip.MetricKey("status.global", "queries", nil); got != "status.global/queries" {
+		t.Errorf("got %s, expected status.global/queries", got)
+	}
+	got := blip.MetricKey("size.table", "bytes", map[string]string{"tbl": "t1", "db": "test"})
+	if got != "size.table/bytes/db=test,tbl=t1" {
+		t.Errorf("got %s, expected size.table/bytes/db=test,tbl=t1", got)
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+
+	ver "github.com/hashicorp/go-version"
 )
 
 // Collector collects metrics for a single metric domain.
@@ -40,8 +43,37 @@ type CollectorHelp struct {
 	Groups      []CollectorKeyValue
 	Meta        []CollectorKeyValue
 	Metrics     []CollectorMetric
+
+	// FixedMetrics is true if Metrics lists every metric that the collector
+	// collects. If true, the plan loader validates plan metric names against
+	// Metrics. Collectors that collect arbitrary metrics (like status.global)
+	// or metric patterns (like pN) must leave this false.
+	FixedMetrics bool
+
+	// Consumers are performance_schema consumers (setup_consumers.NAME) that
+	// must be enabled for the collector to report metrics. Checked by blip --doctor.
+	Consumers []string
+
+	// MinVersion is the minimum MySQL version required, like "8.0.0". Empty
+	// means any version. It's not compared to MariaDB versions, which are not
+	// MySQL versions: if set, MariaDB is not supported unless Flavors lists
+	// FLAVOR_MARIADB.
+	MinVersion string
+
+	// Flavors are the supported MySQL flavors: FLAVOR_MYSQL, FLAVOR_PERCONA,
+	// and so forth. Empty means all flavors.
+	Flavors []string
 }
 
+// MySQL flavors for CollectorHelp.Flavors, detected by sqlutil.Flavor.
+const (
+	FLAVOR_MYSQL   = "mysql"
+	FLAVOR_PERCONA = "percona"
+	FLAVOR_MARIADB = "mariadb"
+	FLAVOR_AURORA  = "aurora"
+	FLAVOR_RDS     = "rds"
+)
+
 type CollectorHelpOption struct {
 	Name    string
 	Desc    string            // describes Name
@@ -107,6 +139,89 @@ func (h CollectorHelp) Validate(opts map[string]string) error {
 	return nil
 }
 
+// ValidateMetrics returns nil if all the given metrics are valid, else it returns
+// an error for the first invalid metric. If FixedMetrics is false, all metrics
+// are valid because the collector does not declare a fixed list of metrics.
+func (h CollectorHelp) ValidateMetrics(metrics []string) error {
+	if !h.FixedMetrics {
+		return nil
+	}
+METRICS:
+	for _, givenName := range metrics {
+		for _, m := range h.Metrics {
+			if givenName == m.Name {
+				continue METRICS
+			}
+		}
+		return fmt.Errorf("unknown metric: %s (run 'blip --print-domains' to list collector metrics)", givenName)
+	}
+	return nil
+}
+
+// ValidateErrors returns nil if all the given error policy keys are valid,
+// else it returns an error for the first invalid key.
+func (h CollectorHelp) ValidateErrors(errs map[string]string) error {
+	for givenKey := range errs {
+		if _, ok := h.Errors[givenKey]; !ok {
+			return fmt.Errorf("unknown error policy: %s (run 'blip --print-domains' to list collector errors)", givenKey)
+		}
+	}
+	return nil
+}
+
+// Supports returns nil if the collector supports the MySQL flavor and version,
+// else it returns an error that describes the requirements. If flavor or version
+// is unknown (empty), it's presumed to be supported.
+func (h CollectorHelp) Supports(flavor, version string) error {
+	if flavor != "" && len(h.Flavors) > 0 {
+		ok := false
+		for _, f := range h.Flavors {
+			if f == flavor {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%s does not support MySQL flavor %s (requires %s)", h.Domain, flavor, h.Requires())
+		}
+	}
+	if flavor == FLAVOR_MARIADB && h.MinVersion != "" {
+		for _, f := range h.Flavors {
+			if f == FLAVOR_MARIADB {
+				return nil // MinVersion is a MySQL version
+			}
+		}
+		return fmt.Errorf("%s does not support MariaDB (requires %s)", h.Domain, h.Requires())
+	}
+	if version != "" && h.MinVersion != "" {
+		v, err := ver.NewVersion(version)
+		if err != nil {
+			return nil // unknown version
+		}
+		min, err := ver.NewVersion(h.MinVersion)
+		if err != nil {
+			return nil // shouldn't happen
+		}
+		if v.LessThan(min) {
+			return fmt.Errorf("%s does not support MySQL %s (requires %s)", h.Domain, version, h.Requires())
+		}
+	}
+	return nil
+}
+
+// Requires returns the MySQL requirements like "MySQL >= 8.0.0; flavor mysql, rds",
+// or an empty string if there are none.
+func (h CollectorHelp) Requires() string {
+	req := []string{}
+	if h.MinVersion != "" {
+		req = append(req, "MySQL >= "+h.MinVersion)
+	}
+	if len(h.Flavors) > 0 {
+		req = append(req, "flavor "+strings.Join(h.Flavors, ", "))
+	}
+	return strings.Join(req, "; ")
+}
+
 // CollectorFactoryArgs are provided by Blip to a CollectorFactory when making
 // a Collector. The factory must use the args to create the collector.
 type CollectorFactoryArgs struct {
@@ -125,6 +240,12 @@ type CollectorFactoryArgs struct {
 	// in Blip is keyed on monitor ID.
 	MonitorId string
 
+	// Flavor and Version are the MySQL flavor (FLAVOR_ const) and version, like
+	// "8.0.32", detected by the monitor each time it prepares a plan. They are
+	// empty if unknown. Collectors must use these instead of querying the version.
+	Flavor  string
+	Version string
+
 	// Validate is true only when the plan loader is validating collectors.
 	// Do not use this field.
 	Validate bool
@@ -0,0 +1,53 @@
+// Copyright 2024 Block, Inc.
+
+package blip_test
+
+import (
+	"testing"
+
+	"github.com/cashapp/blip"
+)
+
+func TestCollectorHelpSupports(t *testing.T) {
+	help := blip.CollectorHelp{
+		Domain:     "test",
+		MinVersion: "8.0.0",
+		Flavors:    []string{blip.FLAVOR_MYSQL, blip.FLAVOR_RDS},
+	}
+	var testCases = []struct {
+		flavor  string
+		version string
+		ok      bool
+	}{
+		{blip.FLAVOR_MYSQL, "8.0.32", true},
+		{blip.FLAVOR_RDS, "8.0.0", true},
+		{blip.FLAVOR_MYSQL, "5.7.44", false},    // too old
+		{blip.FLAVOR_MARIADB, "10.11.2", false}, // flavor not supported
+		{"", "", true},                          // unknown presumed supported
+		{blip.FLAVOR_MYSQL, "", true},
+	}
+	for _, tc := range testCases {
+		err := help.Supports(tc.flavor, tc.version)
+		if tc.ok && err != nil {
+			t.Errorf("%s %s: got error '%s', expected supported", tc.flavor, tc.version, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("%s %s: supported, expected error", tc.flavor, tc.version)
+		}
+	}
+
+	// MinVersion is not compared to MariaDB versions
+	help = blip.CollectorHelp{Domain: "test", MinVersion: "8.0.0"}
+	if err := help.Supports(blip.FLAVOR_MARIADB, "10.11.2"); err == nil {
+		t.Errorf("MariaDB 10.11.2 supported by MinVersion 8.0.0, expected error")
+	}
+	help.Flavors = []string{blip.FLAVOR_MYSQL, blip.FLAVOR_MARIADB}
+	if err := help.Supports(blip.FLAVOR_MARIADB, "5.5.0"); err != nil {
+		t.Errorf("got error '%s' for MariaDB in Flavors, expected supported", err)
+	}
+
+	// No requirements: everything supported
+	if err := (blip.CollectorHelp{}).Supports(blip.FLAVOR_MARIADB, "10.0.0"); err != nil {
+		t.Errorf("got error '%s' for collector with no requirements", err)
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"crypto/x509"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -134,9 +136,13 @@ func fileExists(filePath string) bool {
 // Config represents the Blip startup configuration.
 type Config struct {
 	// Blip server
+	Aggregate     ConfigAggregate     `yaml:"aggregate,omitempty"`
 	API           ConfigAPI           `yaml:"api,omitempty"`
+	Events        ConfigEvents        `yaml:"events,omitempty"`
 	HTTP          ConfigHTTP          `yaml:"http,omitempty"`
+	Maintenance   ConfigMaintenance   `yaml:"maintenance,omitempty"`
 	MonitorLoader ConfigMonitorLoader `yaml:"monitor-loader,omitempty"`
+	Scheduler     ConfigScheduler     `yaml:"scheduler,omitempty"`
 	Sinks         ConfigSinks         `yaml:"sinks,omitempty"`
 
 	// Monitor defaults
@@ -144,8 +150,10 @@ type Config struct {
 	Exporter  ConfigExporter         `yaml:"exporter,omitempty"`
 	HA        ConfigHighAvailability `yaml:"ha,omitempty"`
 	Heartbeat ConfigHeartbeat        `yaml:"heartbeat,omitempty"`
+	LoadShed  ConfigLoadShed         `yaml:"load-shed,omitempty"`
 	MySQL     ConfigMySQL            `yaml:"mysql,omitempty"`
 	Plans     ConfigPlans            `yaml:"plans,omitempty"`
+	Relabel   ConfigRelabel          `yaml:"relabel,omitempty"`
 	Tags      map[string]string      `yaml:"tags,omitempty"`
 	TLS       ConfigTLS              `yaml:"tls,omitempty"`
 
@@ -155,13 +163,17 @@ type Config struct {
 func DefaultConfig() Config {
 	return Config{
 		API:           DefaultConfigAPI(),
+		Events:        DefaultConfigEvents(),
+		Maintenance:   DefaultConfigMaintenance(),
 		MonitorLoader: DefaultConfigMonitorLoader(),
+		Scheduler:     DefaultConfigScheduler(),
 		Sinks:         DefaultConfigSinks(),
 
 		AWS:       DefaultConfigAWS(),
 		Exporter:  DefaultConfigExporter(),
 		HA:        DefaultConfigHA(),
 		Heartbeat: DefaultConfigHeartbeat(),
+		LoadShed:  DefaultConfigLoadShed(),
 		MySQL:     DefaultConfigMySQL(),
 		Plans:     DefaultConfigPlans(),
 		TLS:       DefaultConfigTLS(),
@@ -175,18 +187,30 @@ func DefaultConfig() Config {
 
 func (c Config) Validate() error {
 	// Blip server
+	if err := c.Aggregate.Validate(); err != nil {
+		return err
+	}
 	if err := c.API.Validate(); err != nil {
 		return err
 	}
+	if err := c.Events.Validate(); err != nil {
+		return err
+	}
 	if err := c.HTTP.Validate(); err != nil {
 		return err
 	}
 	if err := c.Sinks.Validate(); err != nil {
 		return err
 	}
+	if err := c.Maintenance.Validate(); err != nil {
+		return err
+	}
 	if err := c.MonitorLoader.Validate(); err != nil {
 		return err
 	}
+	if err := c.Scheduler.Validate(); err != nil {
+		return err
+	}
 	// Monitor defaults
 	if err := c.AWS.Validate(); err != nil {
 		return err
@@ -200,12 +224,18 @@ func (c Config) Validate() error {
 	if err := c.Heartbeat.Validate(); err != nil {
 		return err
 	}
+	if err := c.LoadShed.Validate(); err != nil {
+		return err
+	}
 	if err := c.MySQL.Validate(); err != nil {
 		return err
 	}
 	if err := c.Plans.Validate(); err != nil {
 		return err
 	}
+	if err := c.Relabel.Validate(); err != nil {
+		return err
+	}
 	if err := c.TLS.Validate(); err != nil {
 		return err
 	}
@@ -214,17 +244,23 @@ func (c Config) Validate() error {
 
 func (c *Config) InterpolateEnvVars() {
 	// Blip server
+	c.Aggregate.InterpolateEnvVars()
 	c.API.InterpolateEnvVars()
+	c.Events.InterpolateEnvVars()
 	c.HTTP.InterpolateEnvVars()
 	c.Sinks.InterpolateEnvVars()
+	c.Maintenance.InterpolateEnvVars()
 	c.MonitorLoader.InterpolateEnvVars()
+	c.Scheduler.InterpolateEnvVars()
 	// Monitor defaults
 	c.AWS.InterpolateEnvVars()
 	c.Exporter.InterpolateEnvVars()
 	c.HA.InterpolateEnvVars()
 	c.Heartbeat.InterpolateEnvVars()
+	c.LoadShed.InterpolateEnvVars()
 	c.MySQL.InterpolateEnvVars()
 	c.Plans.InterpolateEnvVars()
+	c.Relabel.InterpolateEnvVars()
 	c.TLS.InterpolateEnvVars()
 	for k, v := range c.Tags {
 		c.Tags[k] = interpolateEnv(v)
@@ -233,25 +269,131 @@ func (c *Config) InterpolateEnvVars() {
 
 func (c *Config) ApplyDefaults(b Config) {
 	c.API.ApplyDefaults(b)
+	c.Events.ApplyDefaults(b)
 	c.HTTP.ApplyDefaults(b)
+	c.Maintenance.ApplyDefaults(b)
 	c.MonitorLoader.ApplyDefaults(b)
+	c.Scheduler.ApplyDefaults(b)
 	// Blip doesn't set defaults for sinks; they're responsible for that
 	// when created
 }
 
+// REDACTED replaces secrets in Config.Redacted.
+const REDACTED = "..."
+
+// secretOpt matches sink option names that are secrets, like "api-key-auth"
+// (datadog) and "auth-token" (signalfx). File names ("-file") are not secrets.
+var secretOpt = regexp.MustCompile(`(key|token|password|secret)(-auth)?$`)
+
+// Redacted returns a copy of the config with secrets redacted: MySQL passwords,
+// sink options that are secrets, API auth tokens and passwords, webhook headers,
+// the HTTP proxy password, and webhook URLs (see RedactWebhookURL). The API uses
+// it for GET /config.
+func (c Config) Redacted() Config {
+	if c.MySQL.Password != "" {
+		c.MySQL.Password = REDACTED
+	}
+	c.HTTP.Proxy = redactURL(c.HTTP.Proxy)
+	c.Sinks = c.Sinks.redacted()
+
+	tokens := make([]ConfigAPIToken, len(c.API.Auth.Tokens))
+	for i, t := range c.API.Auth.Tokens {
+		t.Token = REDACTED
+		tokens[i] = t
+	}
+	c.API.Auth.Tokens = tokens
+	users := make([]ConfigAPIUser, len(c.API.Auth.Users))
+	for i, u := range c.API.Auth.Users {
+		u.Password = REDACTED
+		users[i] = u
+	}
+	c.API.Auth.Users = users
+
+	webhooks := make([]ConfigWebhook, len(c.Events.Webhooks))
+	for i, w := range c.Events.Webhooks {
+		w.URL = RedactWebhookURL(w.URL)
+		if len(w.Headers) > 0 {
+			headers := map[string]string{}
+			for k := range w.Headers {
+				headers[k] = REDACTED
+			}
+			w.Headers = headers
+		}
+		webhooks[i] = w
+	}
+	c.Events.Webhooks = webhooks
+
+	if c.Aggregate != nil {
+		agg := ConfigAggregate{}
+		for name, r := range c.Aggregate {
+			r.Sinks = r.Sinks.redacted()
+			agg[name] = r
+		}
+		c.Aggregate = agg
+	}
+
+	monitors := make([]ConfigMonitor, len(c.Monitors))
+	for i, m := range c.Monitors {
+		if m.Password != "" {
+			m.Password = REDACTED
+		}
+		m.Sinks = m.Sinks.redacted()
+		monitors[i] = m
+	}
+	c.Monitors = monitors
+	return c
+}
+
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), REDACTED)
+	}
+	return u.String()
+}
+
+// RedactWebhookURL returns the URL with everything after the host redacted,
+// like "https://hooks.example.com/...", because webhook URLs often have a secret
+// in the path or query. A password is redacted, too.
+func RedactWebhookURL(s string) string {
+	u, err := url.Parse(redactURL(s))
+	if err != nil {
+		return REDACTED
+	}
+	if u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+		u.Path = "/" + REDACTED
+		u.RawPath = ""
+		u.RawQuery = ""
+		u.Fragment = ""
+	}
+	return u.String()
+}
+
 // ///////////////////////////////////////////////////////////////////////////
 // Blip server
 // ///////////////////////////////////////////////////////////////////////////
 
 type ConfigAPI struct {
-	Bind    string `yaml:"bind"`
-	Disable bool   `yaml:"disable,omitempty"`
+	Bind    string        `yaml:"bind"`
+	Disable bool          `yaml:"disable,omitempty"`
+	TLS     ConfigAPITLS  `yaml:"tls,omitempty"`
+	Auth    ConfigAPIAuth `yaml:"auth,omitempty"`
 }
 
 const (
 	DEFAULT_API_BIND = "127.0.0.1:7522"
 )
 
+// API scopes. Read-only endpoints require SCOPE_READ or SCOPE_ADMIN. Endpoints
+// that change Blip (start/stop/reload monitors, toggle debug) require SCOPE_ADMIN.
+const (
+	SCOPE_READ  = "read"
+	SCOPE_ADMIN = "admin"
+)
+
 func DefaultConfigAPI() ConfigAPI {
 	return ConfigAPI{
 		Bind: DEFAULT_API_BIND,
@@ -266,17 +408,409 @@ func (c ConfigAPI) Validate() error {
 		return fmt.Errorf("api.bind: %s", err)
 	}
 	ln.Close()
-	return nil
+	if err := c.TLS.Validate(); err != nil {
+		return err
+	}
+	return c.Auth.Validate()
 }
 
 func (c *ConfigAPI) InterpolateEnvVars() {
 	c.Bind = interpolateEnv(c.Bind)
+	c.TLS.InterpolateEnvVars()
+	c.Auth.InterpolateEnvVars()
 }
 
 func (c *ConfigAPI) ApplyDefaults(b Config) {
 	if c.Bind == "" {
 		c.Bind = b.API.Bind
 	}
+	c.Auth.ApplyDefaults(b)
+}
+
+// ConfigAPITLS enables TLS for the API. If ClientCA is set, clients must present
+// a certificate signed by it (mTLS).
+type ConfigAPITLS struct {
+	Cert     string `yaml:"cert,omitempty"`
+	Key      string `yaml:"key,omitempty"`
+	ClientCA string `yaml:"client-ca,omitempty"`
+}
+
+func (c ConfigAPITLS) Validate() error {
+	if c.Cert == "" && c.Key == "" && c.ClientCA == "" {
+		return nil // no TLS
+	}
+	if c.Cert == "" || c.Key == "" {
+		return fmt.Errorf("api.tls: cert and key are required")
+	}
+	if !fileExists(c.Cert) {
+		return fmt.Errorf("api.tls.cert: %s: file does not exist", c.Cert)
+	}
+	if !fileExists(c.Key) {
+		return fmt.Errorf("api.tls.key: %s: file does not exist", c.Key)
+	}
+	if c.ClientCA != "" && !fileExists(c.ClientCA) {
+		return fmt.Errorf("api.tls.client-ca: %s: file does not exist", c.ClientCA)
+	}
+	return nil
+}
+
+func (c *ConfigAPITLS) InterpolateEnvVars() {
+	c.Cert = interpolateEnv(c.Cert)
+	c.Key = interpolateEnv(c.Key)
+	c.ClientCA = interpolateEnv(c.ClientCA)
+}
+
+// Set returns true if TLS is enabled for the API.
+func (c ConfigAPITLS) Set() bool {
+	return c.Cert != "" && c.Key != ""
+}
+
+// LoadTLS returns the tls.Config for the API. ConfigAPITLS.Validate must be
+// called first.
+func (c ConfigAPITLS) LoadTLS() (*tls.Config, error) {
+	if !c.Set() {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+	if err != nil {
+		return nil, fmt.Errorf("api.tls: %s", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.ClientCA != "" {
+		caCert, err := os.ReadFile(c.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("api.tls.client-ca: %s", err)
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("api.tls.client-ca: %s: no valid PEM certificates", c.ClientCA)
+		}
+		tlsConfig.ClientCAs = caCertPool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// ConfigAPIAuth configures API authentication. If no tokens or users are set,
+// authentication is disabled and all clients have admin scope.
+type ConfigAPIAuth struct {
+	Tokens []ConfigAPIToken `yaml:"tokens,omitempty"`
+	Users  []ConfigAPIUser  `yaml:"users,omitempty"`
+}
+
+// ConfigAPIToken is a bearer token: "Authorization: Bearer <token>".
+type ConfigAPIToken struct {
+	Token string `yaml:"token"`
+	Scope string `yaml:"scope,omitempty"`
+}
+
+// ConfigAPIUser is a basic auth username and password.
+type ConfigAPIUser struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Scope    string `yaml:"scope,omitempty"`
+}
+
+func (c ConfigAPIAuth) Validate() error {
+	for i, t := range c.Tokens {
+		if t.Token == "" {
+			return fmt.Errorf("api.auth.tokens[%d]: token not set", i)
+		}
+		if err := validScope(t.Scope); err != nil {
+			return fmt.Errorf("api.auth.tokens[%d]: %s", i, err)
+		}
+	}
+	for i, u := range c.Users {
+		if u.Username == "" || u.Password == "" {
+			return fmt.Errorf("api.auth.users[%d]: username and password are required", i)
+		}
+		if err := validScope(u.Scope); err != nil {
+			return fmt.Errorf("api.auth.users[%d]: %s", i, err)
+		}
+	}
+	return nil
+}
+
+func validScope(scope string) error {
+	switch scope {
+	case "", SCOPE_READ, SCOPE_ADMIN: // "" = SCOPE_READ (default)
+		return nil
+	}
+	return fmt.Errorf("invalid scope: %s: valid values: %s, %s", scope, SCOPE_READ, SCOPE_ADMIN)
+}
+
+func (c *ConfigAPIAuth) InterpolateEnvVars() {
+	for i := range c.Tokens {
+		c.Tokens[i].Token = interpolateEnv(c.Tokens[i].Token)
+	}
+	for i := range c.Users {
+		c.Users[i].Username = interpolateEnv(c.Users[i].Username)
+		c.Users[i].Password = interpolateEnv(c.Users[i].Password)
+	}
+}
+
+func (c *ConfigAPIAuth) ApplyDefaults(b Config) {
+	for i := range c.Tokens {
+		if c.Tokens[i].Scope == "" {
+			c.Tokens[i].Scope = SCOPE_READ
+		}
+	}
+	for i := range c.Users {
+		if c.Users[i].Scope == "" {
+			c.Users[i].Scope = SCOPE_READ
+		}
+	}
+}
+
+// Enabled returns true if any tokens or users are set.
+func (c ConfigAPIAuth) Enabled() bool {
+	return len(c.Tokens) > 0 || len(c.Users) > 0
+}
+
+// --------------------------------------------------------------------------
+
+// ConfigAggregate configures cross-monitor rollups, keyed on rollup name.
+// See package aggregate.
+type ConfigAggregate map[string]ConfigRollup
+
+// ConfigRollup is one rollup: monitors with the same value for tag Tag are
+// aggregated, and the rollup metrics are sent to sinks as a synthetic monitor.
+type ConfigRollup struct {
+	Tag        string              `yaml:"tag"`
+	Metrics    map[string][]string `yaml:"metrics"` // domain.metric: [sum, max, min, avg]
+	Freq       string              `yaml:"freq,omitempty"`
+	Stale      string              `yaml:"stale,omitempty"`
+	MinMembers uint                `yaml:"min-members,omitempty"`
+	Sinks      ConfigSinks         `yaml:"sinks,omitempty"`
+	Tags       map[string]string   `yaml:"tags,omitempty"`
+}
+
+const (
+	AGGREGATE_SUM = "sum"
+	AGGREGATE_MAX = "max"
+	AGGREGATE_MIN = "min"
+	AGGREGATE_AVG = "avg"
+
+	DEFAULT_AGGREGATE_FREQ = "10s"
+)
+
+func (c ConfigAggregate) Validate() error {
+	for name, r := range c {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("aggregate.%s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func (c ConfigAggregate) InterpolateEnvVars() {
+	for name, r := range c {
+		r.Sinks.InterpolateEnvVars()
+		for k, v := range r.Tags {
+			r.Tags[k] = interpolateEnv(v)
+		}
+		c[name] = r
+	}
+}
+
+func (r ConfigRollup) Validate() error {
+	if r.Tag == "" {
+		return fmt.Errorf("tag not set; a tag is required to group monitors")
+	}
+	if len(r.Metrics) == 0 {
+		return fmt.Errorf("metrics not set; at least one metric is required")
+	}
+	for metric, fns := range r.Metrics {
+		if i := strings.LastIndex(metric, "."); i <= 0 || i == len(metric)-1 {
+			return fmt.Errorf("invalid metric: %s (must be domain.metric)", metric)
+		}
+		if len(fns) == 0 {
+			return fmt.Errorf("metric %s: no aggregate functions", metric)
+		}
+		for _, fn := range fns {
+			switch fn {
+			case AGGREGATE_SUM, AGGREGATE_MAX, AGGREGATE_MIN, AGGREGATE_AVG:
+			default:
+				return fmt.Errorf("metric %s: invalid aggregate function: %s (valid values: %s, %s, %s, %s)",
+					metric, fn, AGGREGATE_SUM, AGGREGATE_MAX, AGGREGATE_MIN, AGGREGATE_AVG)
+			}
+		}
+	}
+	for k, v := range map[string]string{"freq": r.Freq, "stale": r.Stale} {
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s: %s", k, v, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("invalid %s: %s: must be greater than zero", k, v)
+		}
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+
+// ConfigEvents configures the event log format and built-in event receivers in
+// addition to the event log. Webhooks POST events as JSON to a URL.
+type ConfigEvents struct {
+	LogFormat string          `yaml:"log-format,omitempty"`
+	Webhooks  []ConfigWebhook `yaml:"webhooks,omitempty"`
+}
+
+// Log formats for the event log (config.events.log-format) and the log sink.
+const (
+	LOG_FORMAT_TEXT   = "text"
+	LOG_FORMAT_JSON   = "json"
+	LOG_FORMAT_LOGFMT = "logfmt"
+)
+
+// ValidLogFormat returns an error if the log format is not valid.
+func ValidLogFormat(format string) error {
+	switch format {
+	case LOG_FORMAT_TEXT, LOG_FORMAT_JSON, LOG_FORMAT_LOGFMT:
+		return nil
+	}
+	return fmt.Errorf("%s: must be %s, %s, or %s", format, LOG_FORMAT_TEXT, LOG_FORMAT_JSON, LOG_FORMAT_LOGFMT)
+}
+
+// ConfigWebhook configures one event webhook. Events are filtered by name
+// (or pattern) and error flag, deduplicated by name and monitor ID within the
+// Dedup window, queued (up to QueueSize), and sent in batches of up to
+// BatchSize events at least every BatchWait. Failed batches are retried up to
+// Retries times.
+type ConfigWebhook struct {
+	URL       string            `yaml:"url"`
+	Events    []string          `yaml:"events,omitempty"`
+	Errors    bool              `yaml:"errors,omitempty"`
+	Headers   map[string]string `yaml:"headers,omitempty"`
+	BatchSize string            `yaml:"batch-size,omitempty"`
+	BatchWait string            `yaml:"batch-wait,omitempty"`
+	Dedup     string            `yaml:"dedup,omitempty"`
+	QueueSize string            `yaml:"queue-size,omitempty"`
+	Timeout   string            `yaml:"timeout,omitempty"`
+	Retries   string            `yaml:"retries,omitempty"`
+}
+
+const (
+	DEFAULT_WEBHOOK_BATCH_SIZE = "10"
+	DEFAULT_WEBHOOK_BATCH_WAIT = "1s"
+	DEFAULT_WEBHOOK_QUEUE_SIZE = "1000"
+	DEFAULT_WEBHOOK_TIMEOUT    = "5s"
+	DEFAULT_WEBHOOK_RETRIES    = "3"
+)
+
+func DefaultConfigEvents() ConfigEvents {
+	return ConfigEvents{
+		LogFormat: LOG_FORMAT_TEXT,
+	}
+}
+
+func (c ConfigEvents) Validate() error {
+	if c.LogFormat != "" {
+		if err := ValidLogFormat(c.LogFormat); err != nil {
+			return fmt.Errorf("invalid config.events.log-format: %s", err)
+		}
+	}
+	for i, w := range c.Webhooks {
+		if err := w.Validate(); err != nil {
+			return fmt.Errorf("invalid config.events.webhooks[%d]: %s", i, err)
+		}
+	}
+	return nil
+}
+
+func (c *ConfigEvents) InterpolateEnvVars() {
+	c.LogFormat = interpolateEnv(c.LogFormat)
+	for i := range c.Webhooks {
+		c.Webhooks[i].InterpolateEnvVars()
+	}
+}
+
+func (c *ConfigEvents) ApplyDefaults(b Config) {
+	if c.LogFormat == "" {
+		c.LogFormat = b.Events.LogFormat
+	}
+	for i := range c.Webhooks {
+		c.Webhooks[i].ApplyDefaults(b)
+	}
+}
+
+func (c ConfigWebhook) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url: %s: must be an http or https URL", RedactWebhookURL(c.URL))
+	}
+	for _, e := range c.Events {
+		if _, err := path.Match(e, ""); err != nil {
+			return fmt.Errorf("events: %s: invalid pattern: %s", e, err)
+		}
+	}
+	for k, v := range map[string]string{"batch-size": c.BatchSize, "queue-size": c.QueueSize} {
+		if v == "" {
+			continue
+		}
+		if n, err := strconv.ParseUint(v, 10, 32); err != nil || n == 0 {
+			return fmt.Errorf("%s: %s: must be an integer greater than zero", k, v)
+		}
+	}
+	if c.Retries != "" {
+		if _, err := strconv.ParseUint(c.Retries, 10, 32); err != nil {
+			return fmt.Errorf("retries: %s: must be an integer greater than or equal to zero", c.Retries)
+		}
+	}
+	for k, v := range map[string]string{"batch-wait": c.BatchWait, "dedup": c.Dedup, "timeout": c.Timeout} {
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %s", k, v, err)
+		}
+		if d < 0 || (d == 0 && k != "dedup") {
+			return fmt.Errorf("%s: %s: must be greater than zero", k, v)
+		}
+	}
+	return nil
+}
+
+func (c *ConfigWebhook) InterpolateEnvVars() {
+	c.URL = interpolateEnv(c.URL)
+	for k, v := range c.Headers {
+		c.Headers[k] = interpolateEnv(v)
+	}
+	c.BatchSize = interpolateEnv(c.BatchSize)
+	c.BatchWait = interpolateEnv(c.BatchWait)
+	c.Dedup = interpolateEnv(c.Dedup)
+	c.QueueSize = interpolateEnv(c.QueueSize)
+	c.Timeout = interpolateEnv(c.Timeout)
+	c.Retries = interpolateEnv(c.Retries)
+}
+
+func (c *ConfigWebhook) ApplyDefaults(b Config) {
+	if c.BatchSize == "" {
+		c.BatchSize = DEFAULT_WEBHOOK_BATCH_SIZE
+	}
+	if c.BatchWait == "" {
+		c.BatchWait = DEFAULT_WEBHOOK_BATCH_WAIT
+	}
+	if c.QueueSize == "" {
+		c.QueueSize = DEFAULT_WEBHOOK_QUEUE_SIZE
+	}
+	if c.Timeout == "" {
+		c.Timeout = DEFAULT_WEBHOOK_TIMEOUT
+	}
+	if c.Retries == "" {
+		c.Retries = DEFAULT_WEBHOOK_RETRIES
+	}
 }
 
 // --------------------------------------------------------------------------
@@ -305,7 +839,131 @@ func (c *ConfigHTTP) ApplyDefaults(b Config) {
 
 // --------------------------------------------------------------------------
 
+// ConfigMaintenance configures maintenance windows that mute monitors: error
+// events are sent as info events, and the monitor collects Plan (or pauses if
+// not set). Windows can also be added by the API.
+type ConfigMaintenance struct {
+	Plan    string                    `yaml:"plan,omitempty"`
+	Windows []ConfigMaintenanceWindow `yaml:"windows,omitempty"`
+}
+
+// ConfigMaintenanceWindow is one maintenance window for the monitors by ID or
+// tags (all tags must match). Start and End are RFC 3339 times; or, Duration is
+// the length of the window from Start. Start is required in the config file
+// (else the window restarts when Blip restarts), but API windows default Start
+// to now.
+type ConfigMaintenanceWindow struct {
+	Id       string            `yaml:"id,omitempty"`
+	Monitors []string          `yaml:"monitors,omitempty"`
+	Tags     map[string]string `yaml:"tags,omitempty"`
+	Start    string            `yaml:"start,omitempty"`
+	End      string            `yaml:"end,omitempty"`
+	Duration string            `yaml:"duration,omitempty"`
+	Plan     string            `yaml:"plan,omitempty"`
+	Reason   string            `yaml:"reason,omitempty"`
+}
+
+func DefaultConfigMaintenance() ConfigMaintenance {
+	return ConfigMaintenance{}
+}
+
+func (c ConfigMaintenance) Validate() error {
+	for i, w := range c.Windows {
+		if err := w.Validate(); err != nil {
+			return fmt.Errorf("invalid config.maintenance.windows[%d]: %s", i, err)
+		}
+		if w.Start == "" {
+			return fmt.Errorf("invalid config.maintenance.windows[%d]: start must be set", i)
+		}
+	}
+	return nil
+}
+
+func (c *ConfigMaintenance) InterpolateEnvVars() {
+	c.Plan = interpolateEnv(c.Plan)
+	for i := range c.Windows {
+		c.Windows[i].InterpolateEnvVars()
+	}
+}
+
+func (c *ConfigMaintenance) ApplyDefaults(b Config) {
+	if c.Plan == "" {
+		c.Plan = b.Maintenance.Plan
+	}
+	for i := range c.Windows {
+		if c.Windows[i].Plan == "" {
+			c.Windows[i].Plan = c.Plan
+		}
+	}
+}
+
+// Times returns the start and end times of the window. If Start is not set,
+// it returns now as the start time. The window must be valid (see Validate).
+func (c ConfigMaintenanceWindow) Times(now time.Time) (time.Time, time.Time) {
+	start := now
+	if c.Start != "" {
+		start, _ = time.Parse(time.RFC3339, c.Start)
+	}
+	if c.End != "" {
+		end, _ := time.Parse(time.RFC3339, c.End)
+		return start, end
+	}
+	d, _ := time.ParseDuration(c.Duration)
+	return start, start.Add(d)
+}
+
+func (c ConfigMaintenanceWindow) Validate() error {
+	if len(c.Monitors) == 0 && len(c.Tags) == 0 {
+		return fmt.Errorf("monitors or tags must be set")
+	}
+	var start time.Time
+	if c.Start != "" {
+		var err error
+		start, err = time.Parse(time.RFC3339, c.Start)
+		if err != nil {
+			return fmt.Errorf("start: %s: must be an RFC 3339 time like 2024-05-01T02:00:00Z", c.Start)
+		}
+	}
+	switch {
+	case c.End != "" && c.Duration != "":
+		return fmt.Errorf("end and duration are mutually exclusive")
+	case c.End != "":
+		end, err := time.Parse(time.RFC3339, c.End)
+		if err != nil {
+			return fmt.Errorf("end: %s: must be an RFC 3339 time like 2024-05-01T04:00:00Z", c.End)
+		}
+		if !start.IsZero() && !end.After(start) {
+			return fmt.Errorf("end %s is not after start %s", c.End, c.Start)
+		}
+	case c.Duration != "":
+		d, err := time.ParseDuration(c.Duration)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("duration: %s: must be a duration greater than zero like 2h", c.Duration)
+		}
+	default:
+		return fmt.Errorf("end or duration must be set")
+	}
+	return nil
+}
+
+func (c *ConfigMaintenanceWindow) InterpolateEnvVars() {
+	c.Id = interpolateEnv(c.Id)
+	for i := range c.Monitors {
+		c.Monitors[i] = interpolateEnv(c.Monitors[i])
+	}
+	for k, v := range c.Tags {
+		c.Tags[k] = interpolateEnv(v)
+	}
+	c.Start = interpolateEnv(c.Start)
+	c.End = interpolateEnv(c.End)
+	c.Duration = interpolateEnv(c.Duration)
+	c.Plan = interpolateEnv(c.Plan)
+}
+
+// --------------------------------------------------------------------------
+
 type ConfigMonitorLoader struct {
+	APIFile  string                   `yaml:"api-file,omitempty"`
 	Files    []string                 `yaml:"files,omitempty"`
 	StopLoss string                   `yaml:"stop-loss,omitempty"`
 	AWS      ConfigMonitorLoaderAWS   `yaml:"aws,omitempty"`
@@ -343,6 +1001,7 @@ func (c ConfigMonitorLoader) Validate() error {
 
 func (c *ConfigMonitorLoader) InterpolateEnvVars() {
 	c.StopLoss = interpolateEnv(c.StopLoss)
+	c.APIFile = interpolateEnv(c.APIFile)
 	for i := range c.Files {
 		c.Files[i] = interpolateEnv(c.Files[i])
 	}
@@ -351,6 +1010,73 @@ func (c *ConfigMonitorLoader) InterpolateEnvVars() {
 func (c *ConfigMonitorLoader) ApplyDefaults(b Config) {
 }
 
+// --------------------------------------------------------------------------
+
+// ConfigScheduler configures the shared scheduler that drives metrics collection
+// for all monitors: one ticker for all monitors instead of one LCO ticker per
+// monitor (other monitor goroutines are not affected), and an optional limit on
+// the number of domains collecting at once across all monitors (MaxCollect).
+// Jitter spreads monitors across each 1s tick.
+type ConfigScheduler struct {
+	Disable         bool   `yaml:"disable,omitempty"`
+	CollectParallel string `yaml:"collect-parallel,omitempty"`
+	Jitter          string `yaml:"jitter,omitempty"`
+	MaxCollect      string `yaml:"max-collect,omitempty"`
+}
+
+const (
+	DEFAULT_SCHEDULER_COLLECT_PARALLEL = "2"
+	DEFAULT_SCHEDULER_JITTER           = "1s"
+)
+
+func DefaultConfigScheduler() ConfigScheduler {
+	return ConfigScheduler{
+		CollectParallel: DEFAULT_SCHEDULER_COLLECT_PARALLEL,
+		Jitter:          DEFAULT_SCHEDULER_JITTER,
+	}
+}
+
+func (c ConfigScheduler) Validate() error {
+	if c.CollectParallel != "" {
+		if n, err := strconv.ParseUint(c.CollectParallel, 10, 32); err != nil || n == 0 {
+			return fmt.Errorf("invalid config.scheduler.collect-parallel: %s: must be an integer greater than zero", c.CollectParallel)
+		}
+	}
+	if c.MaxCollect != "" {
+		if _, err := strconv.ParseUint(c.MaxCollect, 10, 32); err != nil {
+			return fmt.Errorf("invalid config.scheduler.max-collect: %s: must be an integer (0 = no limit)", c.MaxCollect)
+		}
+	}
+	if c.Jitter != "" {
+		d, err := time.ParseDuration(c.Jitter)
+		if err != nil {
+			return fmt.Errorf("invalid config.scheduler.jitter: %s: %s", c.Jitter, err)
+		}
+		if d < 0 || d > time.Second {
+			return fmt.Errorf("invalid config.scheduler.jitter: %s: must be between 0s and 1s", c.Jitter)
+		}
+	}
+	return nil
+}
+
+func (c *ConfigScheduler) InterpolateEnvVars() {
+	c.CollectParallel = interpolateEnv(c.CollectParallel)
+	c.Jitter = interpolateEnv(c.Jitter)
+	c.MaxCollect = interpolateEnv(c.MaxCollect)
+}
+
+func (c *ConfigScheduler) ApplyDefaults(b Config) {
+	if c.CollectParallel == "" {
+		c.CollectParallel = b.Scheduler.CollectParallel
+	}
+	if c.Jitter == "" {
+		c.Jitter = b.Scheduler.Jitter
+	}
+	if c.MaxCollect == "" {
+		c.MaxCollect = b.Scheduler.MaxCollect
+	}
+}
+
 // ///////////////////////////////////////////////////////////////////////////
 // Monitor
 // ///////////////////////////////////////////////////////////////////////////
@@ -375,8 +1101,10 @@ type ConfigMonitor struct {
 	Exporter  ConfigExporter         `yaml:"exporter,omitempty"`
 	HA        ConfigHighAvailability `yaml:"ha,omitempty"`
 	Heartbeat ConfigHeartbeat        `yaml:"heartbeat,omitempty"`
+	LoadShed  ConfigLoadShed         `yaml:"load-shed,omitempty"`
 	Plans     ConfigPlans            `yaml:"plans,omitempty"`
 	Plan      string                 `yaml:"plan,omitempty"`
+	Relabel   ConfigRelabel          `yaml:"relabel,omitempty"`
 	Sinks     ConfigSinks            `yaml:"sinks,omitempty"`
 	TLS       ConfigTLS              `yaml:"tls,omitempty"`
 
@@ -399,6 +1127,7 @@ func DefaultConfigMonitor() ConfigMonitor {
 		Exporter:  DefaultConfigExporter(),
 		HA:        DefaultConfigHA(),
 		Heartbeat: DefaultConfigHeartbeat(),
+		LoadShed:  DefaultConfigLoadShed(),
 		Plans:     DefaultConfigPlans(),
 		Sinks:     DefaultConfigSinks(),
 		TLS:       DefaultConfigTLS(),
@@ -406,6 +1135,12 @@ func DefaultConfigMonitor() ConfigMonitor {
 }
 
 func (c ConfigMonitor) Validate() error {
+	if err := c.LoadShed.Validate(); err != nil {
+		return err
+	}
+	if err := c.Relabel.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -446,6 +1181,7 @@ func (c *ConfigMonitor) ApplyDefaults(b Config) {
 	c.Exporter.ApplyDefaults(b)
 	c.HA.ApplyDefaults(b)
 	c.Heartbeat.ApplyDefaults(b)
+	c.LoadShed.ApplyDefaults(b)
 	c.Plans.ApplyDefaults(b)
 	c.Sinks.ApplyDefaults(b)
 	c.TLS.ApplyDefaults(b)
@@ -470,8 +1206,10 @@ func (c *ConfigMonitor) InterpolateEnvVars() {
 	c.Exporter.InterpolateEnvVars()
 	c.HA.InterpolateEnvVars()
 	c.Heartbeat.InterpolateEnvVars()
+	c.LoadShed.InterpolateEnvVars()
 	c.Plans.InterpolateEnvVars()
 	c.Plan = interpolateEnv(c.Plan)
+	c.Relabel.InterpolateEnvVars()
 	c.Sinks.InterpolateEnvVars()
 	c.TLS.InterpolateEnvVars()
 }
@@ -495,8 +1233,10 @@ func (c *ConfigMonitor) InterpolateMonitor() {
 	c.Exporter.InterpolateMonitor(c)
 	c.HA.InterpolateMonitor(c)
 	c.Heartbeat.InterpolateMonitor(c)
+	c.LoadShed.InterpolateMonitor(c)
 	c.Plans.InterpolateMonitor(c)
 	c.Plan = c.interpolateMon(c.Plan)
+	c.Relabel.InterpolateMonitor(c)
 	c.Sinks.InterpolateMonitor(c)
 	c.TLS.InterpolateMonitor(c)
 }
@@ -724,6 +1464,98 @@ func (c *ConfigHeartbeat) InterpolateMonitor(m *ConfigMonitor) {
 
 // --------------------------------------------------------------------------
 
+// ConfigLoadShed configures adaptive load shedding: when MySQL is overloaded
+// (Threads_running >= ThreadsRunning), the engine skips expensive domains until
+// MySQL has not been overloaded for the Recover duration. Expensive domains are
+// Domains and, if Cost is set, domains that take at least Cost to collect on
+// average.
+type ConfigLoadShed struct {
+	ThreadsRunning string   `yaml:"threads-running,omitempty"`
+	Cost           string   `yaml:"cost,omitempty"`
+	Recover        string   `yaml:"recover,omitempty"`
+	Domains        []string `yaml:"domains,omitempty"`
+}
+
+const (
+	DEFAULT_LOAD_SHED_RECOVER = "1m"
+)
+
+// DefaultLoadShedDomains are the default expensive domains for load shedding
+// if config.load-shed.domains is not set.
+var DefaultLoadShedDomains = []string{
+	"query.response-time",
+	"size.database",
+	"size.table",
+	"wait.io.table",
+}
+
+func DefaultConfigLoadShed() ConfigLoadShed {
+	return ConfigLoadShed{}
+}
+
+// Enabled returns true if load shedding is enabled (threads-running is set).
+func (c ConfigLoadShed) Enabled() bool {
+	return c.ThreadsRunning != ""
+}
+
+func (c ConfigLoadShed) Validate() error {
+	if !c.Enabled() {
+		if c.Cost != "" || c.Recover != "" || len(c.Domains) > 0 {
+			return fmt.Errorf("invalid config.load-shed: threads-running is not set but other values are set; set threads-running to enable load shedding")
+		}
+		return nil
+	}
+	if n, err := strconv.ParseUint(c.ThreadsRunning, 10, 64); err != nil || n == 0 {
+		return fmt.Errorf("invalid config.load-shed.threads-running: %s: must be an integer greater than zero", c.ThreadsRunning)
+	}
+	for k, v := range map[string]string{"cost": c.Cost, "recover": c.Recover} {
+		if v == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(v); err != nil {
+			return fmt.Errorf("invalid config.load-shed.%s: %s: %s", k, v, err)
+		}
+	}
+	return nil
+}
+
+func (c *ConfigLoadShed) ApplyDefaults(b Config) {
+	if c.ThreadsRunning == "" {
+		c.ThreadsRunning = b.LoadShed.ThreadsRunning
+	}
+	if c.Cost == "" {
+		c.Cost = b.LoadShed.Cost
+	}
+	if c.Recover == "" {
+		c.Recover = b.LoadShed.Recover
+	}
+	if len(c.Domains) == 0 {
+		c.Domains = b.LoadShed.Domains
+	}
+	if c.Enabled() {
+		if c.Recover == "" {
+			c.Recover = DEFAULT_LOAD_SHED_RECOVER
+		}
+		if len(c.Domains) == 0 {
+			c.Domains = append([]string{}, DefaultLoadShedDomains...) // copy
+		}
+	}
+}
+
+func (c *ConfigLoadShed) InterpolateEnvVars() {
+	c.ThreadsRunning = interpolateEnv(c.ThreadsRunning)
+	c.Cost = interpolateEnv(c.Cost)
+	c.Recover = interpolateEnv(c.Recover)
+}
+
+func (c *ConfigLoadShed) InterpolateMonitor(m *ConfigMonitor) {
+	c.ThreadsRunning = m.interpolateMon(c.ThreadsRunning)
+	c.Cost = m.interpolateMon(c.Cost)
+	c.Recover = m.interpolateMon(c.Recover)
+}
+
+// --------------------------------------------------------------------------
+
 // Not implemented yet; placeholders
 
 type ConfigHighAvailability struct{}
@@ -824,25 +1656,42 @@ type ConfigPlans struct {
 	Monitor             *ConfigMonitor   `yaml:"monitor,omitempty"`
 	Change              ConfigPlanChange `yaml:"change,omitempty"`
 	DisableDefaultPlans bool             `yaml:"disable-default-plans"`
+	Validation          string           `yaml:"validation,omitempty"`
 }
 
 const (
 	DEFAULT_PLANS_TABLE = "blip.plans"
+
+	PLANS_VALIDATION_STRICT  = "strict"  // invalid metrics and error policies are errors
+	PLANS_VALIDATION_LENIENT = "lenient" // invalid metrics and error policies are warnings (events)
 )
 
 func DefaultConfigPlans() ConfigPlans {
-	return ConfigPlans{}
+	return ConfigPlans{
+		Validation: PLANS_VALIDATION_LENIENT,
+	}
 }
 
 func (c ConfigPlans) Validate() error {
+	if c.Validation != "" && c.Validation != PLANS_VALIDATION_STRICT && c.Validation != PLANS_VALIDATION_LENIENT {
+		return fmt.Errorf("invalid config.plans.validation: %s; valid values: strict, lenient", c.Validation)
+	}
 	return nil
 }
 
+// Strict returns true if plan validation is strict.
+func (c ConfigPlans) Strict() bool {
+	return c.Validation == PLANS_VALIDATION_STRICT
+}
+
 func (c *ConfigPlans) ApplyDefaults(b Config) {
 	if len(c.Files) == 0 && len(b.Plans.Files) > 0 {
 		c.Files = make([]string, len(b.Plans.Files))
 		copy(c.Files, b.Plans.Files)
 	}
+	if c.Validation == "" {
+		c.Validation = b.Plans.Validation
+	}
 	c.Change.ApplyDefaults(b)
 }
 
@@ -851,6 +1700,7 @@ func (c *ConfigPlans) InterpolateEnvVars() {
 		c.Files[i] = interpolateEnv(c.Files[i])
 	}
 	c.Table = interpolateEnv(c.Table)
+	c.Validation = interpolateEnv(c.Validation)
 	c.Change.InterpolateEnvVars()
 }
 
@@ -944,6 +1794,24 @@ func (c ConfigSinks) Validate() error {
 	return nil
 }
 
+// redacted returns a copy of the sinks with secret options redacted.
+func (c ConfigSinks) redacted() ConfigSinks {
+	if c == nil {
+		return nil
+	}
+	r := make(ConfigSinks, len(c))
+	for sink, opts := range c {
+		r[sink] = make(map[string]string, len(opts))
+		for k, v := range opts {
+			if secretOpt.MatchString(k) && v != "" {
+				v = REDACTED
+			}
+			r[sink][k] = v
+		}
+	}
+	return r
+}
+
 func (c ConfigSinks) ApplyDefaults(b Config) {
 	for bk, bv := range b.Sinks {
 		opts := c[bk]
@@ -975,6 +1843,156 @@ func (c ConfigSinks) InterpolateMonitor(m *ConfigMonitor) {
 
 // --------------------------------------------------------------------------
 
+// ConfigRelabel is a list of rules that drop, rename, and tag metrics before
+// they're sent to sinks. Rules are applied to all sinks, then sink rules are
+// applied to only that sink. Monitor rules are appended to config.relabel rules
+// (global rules first) by ConfigMonitor.RelabelRules. See package relabel.
+type ConfigRelabel struct {
+	Rules []ConfigRelabelRule            `yaml:"rules,omitempty"`
+	Sinks map[string][]ConfigRelabelRule `yaml:"sinks,omitempty"`
+}
+
+// ConfigRelabelRule is one relabel rule. Domain, Name, and Group are regular
+// expressions that a metric must match (all of them) for the rule to apply.
+// They're anchored (must match the whole value), and empty matches all.
+type ConfigRelabelRule struct {
+	Action string            `yaml:"action"`
+	Domain string            `yaml:"domain,omitempty"`
+	Name   string            `yaml:"name,omitempty"`
+	Group  map[string]string `yaml:"group,omitempty"`
+
+	Replacement string `yaml:"replacement,omitempty"` // rename
+	Tag         string `yaml:"tag,omitempty"`         // tag
+	Value       string `yaml:"value,omitempty"`       // tag
+	Source      string `yaml:"source,omitempty"`      // tag, hashmod
+	Modulus     uint   `yaml:"modulus,omitempty"`     // hashmod
+	Shard       uint   `yaml:"shard,omitempty"`       // hashmod
+}
+
+const (
+	RELABEL_KEEP    = "keep"
+	RELABEL_DROP    = "drop"
+	RELABEL_RENAME  = "rename"
+	RELABEL_TAG     = "tag"
+	RELABEL_HASHMOD = "hashmod"
+)
+
+// Relabel sources for ConfigRelabelRule.Source. Group and meta sources
+// are prefixes: "group.db" is the value of group key db.
+const (
+	RELABEL_SOURCE_MONITOR = "monitor"
+	RELABEL_SOURCE_DOMAIN  = "domain"
+	RELABEL_SOURCE_NAME    = "name"
+	RELABEL_SOURCE_METRIC  = "metric" // domain.name
+	RELABEL_SOURCE_GROUP   = "group."
+	RELABEL_SOURCE_META    = "meta."
+)
+
+func (c ConfigRelabel) Validate() error {
+	for i, r := range c.Rules {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("relabel.rules[%d]: %s", i, err)
+		}
+	}
+	for sinkName, rules := range c.Sinks {
+		for i, r := range rules {
+			if err := r.Validate(); err != nil {
+				return fmt.Errorf("relabel.sinks.%s[%d]: %s", sinkName, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (r ConfigRelabelRule) Validate() error {
+	for _, re := range []string{r.Domain, r.Name} {
+		if _, err := regexp.Compile(re); err != nil {
+			return fmt.Errorf("invalid regex: %s: %s", re, err)
+		}
+	}
+	for k, re := range r.Group {
+		if _, err := regexp.Compile(re); err != nil {
+			return fmt.Errorf("invalid group.%s regex: %s: %s", k, re, err)
+		}
+	}
+	switch r.Action {
+	case RELABEL_KEEP, RELABEL_DROP:
+	case RELABEL_RENAME:
+		if r.Replacement == "" {
+			return fmt.Errorf("action rename requires replacement")
+		}
+	case RELABEL_TAG:
+		if r.Tag == "" {
+			return fmt.Errorf("action tag requires tag")
+		}
+		if (r.Value == "") == (r.Source == "") {
+			return fmt.Errorf("action tag requires value or source (not both)")
+		}
+	case RELABEL_HASHMOD:
+		if r.Modulus == 0 {
+			return fmt.Errorf("action hashmod requires modulus > 0")
+		}
+		if r.Shard >= r.Modulus {
+			return fmt.Errorf("invalid shard: %d (must be less than modulus %d)", r.Shard, r.Modulus)
+		}
+	default:
+		return fmt.Errorf("invalid action: %s (valid values: %s, %s, %s, %s, %s)",
+			r.Action, RELABEL_KEEP, RELABEL_DROP, RELABEL_RENAME, RELABEL_TAG, RELABEL_HASHMOD)
+	}
+	switch {
+	case r.Source == "", r.Source == RELABEL_SOURCE_MONITOR, r.Source == RELABEL_SOURCE_DOMAIN,
+		r.Source == RELABEL_SOURCE_NAME, r.Source == RELABEL_SOURCE_METRIC:
+	case strings.HasPrefix(r.Source, RELABEL_SOURCE_GROUP) && len(r.Source) > len(RELABEL_SOURCE_GROUP):
+	case strings.HasPrefix(r.Source, RELABEL_SOURCE_META) && len(r.Source) > len(RELABEL_SOURCE_META):
+	default:
+		return fmt.Errorf("invalid source: %s (valid values: monitor, domain, name, metric, group.KEY, meta.KEY)", r.Source)
+	}
+	return nil
+}
+
+// RelabelRules returns the relabel rules for the sink in the order they're
+// applied: config.relabel rules (b), monitor rules, then config.relabel and
+// monitor rules for the sink. Global rules are merged here, not by ApplyDefaults,
+// so they're merged once no matter how many times defaults are applied. Global
+// rules are copied and %{monitor.X} is replaced with monitor values.
+func (c ConfigMonitor) RelabelRules(b ConfigRelabel, sinkName string) []ConfigRelabelRule {
+	rules := make([]ConfigRelabelRule, 0, len(b.Rules)+len(c.Relabel.Rules)+len(b.Sinks[sinkName])+len(c.Relabel.Sinks[sinkName]))
+	for _, r := range b.Rules {
+		r.Value = c.interpolateMon(r.Value)
+		rules = append(rules, r)
+	}
+	rules = append(rules, c.Relabel.Rules...)
+	for _, r := range b.Sinks[sinkName] {
+		r.Value = c.interpolateMon(r.Value)
+		rules = append(rules, r)
+	}
+	return append(rules, c.Relabel.Sinks[sinkName]...)
+}
+
+func (c *ConfigRelabel) InterpolateEnvVars() {
+	for i := range c.Rules {
+		c.Rules[i].Value = interpolateEnv(c.Rules[i].Value)
+	}
+	for _, rules := range c.Sinks {
+		for i := range rules {
+			rules[i].Value = interpolateEnv(rules[i].Value)
+		}
+	}
+}
+
+func (c *ConfigRelabel) InterpolateMonitor(m *ConfigMonitor) {
+	for i := range c.Rules {
+		c.Rules[i].Value = m.interpolateMon(c.Rules[i].Value)
+	}
+	for _, rules := range c.Sinks {
+		for i := range rules {
+			rules[i].Value = m.interpolateMon(rules[i].Value)
+		}
+	}
+}
+
+// --------------------------------------------------------------------------
+
 type ConfigTLS struct {
 	CA         string `yaml:"ca,omitempty"`   // ssl-ca
 	Cert       string `yaml:"cert,omitempty"` // ssl-cert
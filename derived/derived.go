@@ -0,0 +1,341 @@
+// Copyright 2024 Block, Inc.
+
+// Package derived provides derived metrics: metrics computed from other metrics
+// collected in the same interval, like connection utilization from
+// status.global.threads_connected and var.global.max_connections.
+//
+// Derived metrics are not collected by a collector. They are declared in a plan
+// using the pseudo-domain "derived", where each option is a derived metric name
+// and its expression:
+//
+//	kpi:
+//	  freq: 5s
+//	  collect:
+//	    status.global:
+//	      metrics: [threads_connected]
+//	    var.global:
+//	      metrics: [max_connections]
+//	    derived:
+//	      options:
+//	        connection_utilization: "status.global.threads_connected / var.global.max_connections"
+//
+// The monitor.Engine evaluates derived metrics after collecting all domains at a
+// level, and reports them as gauges in domain "derived".
+package derived
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cashapp/blip"
+)
+
+// DOMAIN is the pseudo-domain for derived metrics in plans.
+const DOMAIN = "derived"
+
+var validNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// Metric is one derived metric: a name and an expression over other metrics.
+type Metric struct {
+	Name string   // derived metric name
+	Expr string   // original expression
+	Refs []string // metrics referenced by the expression, like "status.global.threads_running"
+	root node
+}
+
+// Parse parses a derived metric expression. The expression can use numbers,
+// metrics referenced by domain and name (like status.global.threads_running),
+// operators + - * /, and parentheses. Because domain names can contain hyphens
+// (like query.response-time), subtraction must have a space before the minus
+// sign when it follows a metric name.
+func Parse(name, expr string) (Metric, error) {
+	if !validNameRegex.MatchString(name) {
+		return Metric{}, fmt.Errorf("invalid derived metric name: %s (does not match /%s/)", name, validNameRegex)
+	}
+	p := &parser{expr: expr}
+	if err := p.tokenize(); err != nil {
+		return Metric{}, fmt.Errorf("derived metric %s: %s", name, err)
+	}
+	root, err := p.parseExpr()
+	if err != nil {
+		return Metric{}, fmt.Errorf("derived metric %s: %s", name, err)
+	}
+	if p.pos < len(p.tokens) {
+		return Metric{}, fmt.Errorf("derived metric %s: unexpected %s", name, p.tokens[p.pos].val)
+	}
+	return Metric{
+		Name: name,
+		Expr: expr,
+		Refs: p.refs,
+		root: root,
+	}, nil
+}
+
+// Metrics parses all derived metrics in the options of a derived domain in a
+// plan: option key is the derived metric name, option value is the expression.
+// The returned metrics are sorted by name.
+func Metrics(opts map[string]string) ([]Metric, error) {
+	names := make([]string, 0, len(opts))
+	for name := range opts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := make([]Metric, len(names))
+	for i, name := range names {
+		m, err := Parse(name, opts[name])
+		if err != nil {
+			return nil, err
+		}
+		metrics[i] = m
+	}
+	return metrics, nil
+}
+
+// Eval evaluates the derived metric using the given values, which are keyed on
+// domain like blip.Metrics.Values. Only ungrouped values can be referenced.
+// It returns an error if a referenced metric has no value, or the result is
+// not a number (like division by zero).
+func (m Metric) Eval(values map[string][]blip.MetricValue) (float64, error) {
+	v, err := m.root.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("%s is not a number", m.Name)
+	}
+	return v, nil
+}
+
+// Value returns the derived metric as a blip.MetricValue, and false if it cannot
+// be evaluated.
+func (m Metric) Value(values map[string][]blip.MetricValue) (blip.MetricValue, bool) {
+	v, err := m.Eval(values)
+	if err != nil {
+		blip.Debug("derived metric %s: %s", m.Name, err)
+		return blip.MetricValue{}, false
+	}
+	return blip.MetricValue{
+		Name:  m.Name,
+		Value: v,
+		Type:  blip.GAUGE,
+	}, true
+}
+
+// --------------------------------------------------------------------------
+
+type node interface {
+	eval(values map[string][]blip.MetricValue) (float64, error)
+}
+
+type number float64
+
+func (n number) eval(map[string][]blip.MetricValue) (float64, error) {
+	return float64(n), nil
+}
+
+type ref struct {
+	domain string
+	metric string
+}
+
+func (r ref) eval(values map[string][]blip.MetricValue) (float64, error) {
+	for _, v := range values[r.domain] {
+		if v.Name == r.metric && len(v.Group) == 0 {
+			return v.Value, nil
+		}
+	}
+	return 0, fmt.Errorf("no value for %s.%s", r.domain, r.metric)
+}
+
+type neg struct {
+	n node
+}
+
+func (u neg) eval(values map[string][]blip.MetricValue) (float64, error) {
+	v, err := u.n.eval(values)
+	return -v, err
+}
+
+type binary struct {
+	op          byte
+	left, right node
+}
+
+func (b binary) eval(values map[string][]blip.MetricValue) (float64, error) {
+	l, err := b.left.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	r, err := b.right.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	switch b.op {
+	case '+':
+		return l + r, nil
+	case '-':
+		return l - r, nil
+	case '*':
+		return l * r, nil
+	}
+	if r == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	return l / r, nil
+}
+
+// --------------------------------------------------------------------------
+
+const (
+	tokNumber = iota
+	tokRef
+	tokOp
+)
+
+type token struct {
+	typ int
+	val string
+}
+
+type parser struct {
+	expr   string
+	tokens []token
+	pos    int
+	refs   []string
+}
+
+func isRefChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *parser) tokenize() error {
+	s := p.expr
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.IndexByte("+-*/()", c) >= 0:
+			p.tokens = append(p.tokens, token{tokOp, string(c)})
+			i++
+		case (c >= '0' && c <= '9') || c == '.':
+			j := i
+			for j < len(s) && ((s[j] >= '0' && s[j] <= '9') || s[j] == '.') {
+				j++
+			}
+			p.tokens = append(p.tokens, token{tokNumber, s[i:j]})
+			i = j
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			j := i
+			for j < len(s) && isRefChar(s[j]) {
+				j++
+			}
+			p.tokens = append(p.tokens, token{tokRef, s[i:j]})
+			i = j
+		default:
+			return fmt.Errorf("invalid character '%c' at position %d", c, i+1)
+		}
+	}
+	if len(p.tokens) == 0 {
+		return fmt.Errorf("empty expression")
+	}
+	return nil
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// expr = term { ("+" | "-") term }
+func (p *parser) parseExpr() (node, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || t.typ != tokOp || (t.val != "+" && t.val != "-") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: t.val[0], left: left, right: right}
+	}
+}
+
+// term = unary { ("*" | "/") unary }
+func (p *parser) parseTerm() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || t.typ != tokOp || (t.val != "*" && t.val != "/") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: t.val[0], left: left, right: right}
+	}
+}
+
+// unary = "-" unary | primary
+// primary = number | ref | "(" expr ")"
+func (p *parser) parseUnary() (node, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	switch t.typ {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %s", t.val)
+		}
+		return number(f), nil
+	case tokRef:
+		i := strings.LastIndex(t.val, ".")
+		if i <= 0 || i == len(t.val)-1 {
+			return nil, fmt.Errorf("invalid metric: %s (must be domain.metric)", t.val)
+		}
+		if t.val[:i] == DOMAIN {
+			return nil, fmt.Errorf("invalid metric: %s (cannot reference derived metrics)", t.val)
+		}
+		p.refs = append(p.refs, t.val)
+		return ref{domain: t.val[:i], metric: t.val[i+1:]}, nil
+	}
+	switch t.val {
+	case "-":
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return neg{n}, nil
+	case "(":
+		n, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); !ok || t.val != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return n, nil
+	}
+	return nil, fmt.Errorf("unexpected %s", t.val)
+}
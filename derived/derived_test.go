@@ -0,0 +1,129 @@
+// Copyright 2024 Block, Inc.
+
+package derived_test
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/derived"
+)
+
+var values = map[string][]blip.MetricValue{
+	"status.global": {
+		{Name: "threads_connected", Value: 50, Type: blip.GAUGE},
+		{Name: "innodb_buffer_pool_read_requests", Value: 1000, Type: blip.CUMULATIVE_COUNTER},
+		{Name: "innodb_buffer_pool_reads", Value: 10, Type: blip.CUMULATIVE_COUNTER},
+		{Name: "zero", Value: 0, Type: blip.GAUGE},
+	},
+	"var.global": {
+		{Name: "max_connections", Value: 200, Type: blip.GAUGE},
+	},
+	"query.response-time": {
+		{Name: "p99", Value: 300, Type: blip.GAUGE},
+	},
+	"size.table": {
+		{Name: "bytes", Value: 1, Type: blip.GAUGE, Group: map[string]string{"db": "d", "tbl": "t"}},
+	},
+}
+
+func TestEval(t *testing.T) {
+	var testCases = []struct {
+		expr   string
+		expect float64
+	}{
+		{"status.global.threads_connected / var.global.max_connections", 0.25},
+		{"1 - status.global.innodb_buffer_pool_reads / status.global.innodb_buffer_pool_read_requests", 0.99},
+		{"(1 + 2) * 3", 9},
+		{"1 + 2 * 3", 7},
+		{"-status.global.threads_connected + 100", 50},
+		{"query.response-time.p99 - 100", 200}, // hyphen in domain
+		{"10 / 4", 2.5},
+	}
+	for _, tc := range testCases {
+		m, err := derived.Parse("m", tc.expr)
+		if err != nil {
+			t.Errorf("%s: parse error: %s", tc.expr, err)
+			continue
+		}
+		got, err := m.Eval(values)
+		if err != nil {
+			t.Errorf("%s: eval error: %s", tc.expr, err)
+			continue
+		}
+		if got != tc.expect {
+			t.Errorf("%s = %f, expected %f", tc.expr, got, tc.expect)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	// Valid expressions that can't be evaluated: not reported
+	for _, expr := range []string{
+		"status.global.threads_connected / status.global.zero", // division by zero
+		"status.global.nonexistent + 1",                        // not collected
+		"size.table.bytes * 2",                                 // grouped
+	} {
+		m, err := derived.Parse("m", expr)
+		if err != nil {
+			t.Errorf("%s: parse error: %s", expr, err)
+			continue
+		}
+		if _, err := m.Eval(values); err == nil {
+			t.Errorf("%s: no eval error, expected one", expr)
+		}
+		if _, ok := m.Value(values); ok {
+			t.Errorf("%s: Value returned ok, expected false", expr)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"threads_connected",   // no domain
+		"derived.other * 2",   // derived ref
+		"status.global.x % 2", // invalid operator
+		"status.global.x status.global.y",
+	} {
+		if _, err := derived.Parse("m", expr); err == nil {
+			t.Errorf("%s: no parse error, expected one", expr)
+		}
+	}
+	if _, err := derived.Parse("bad-name", "1"); err == nil {
+		t.Errorf("no error for invalid metric name, expected one")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	metrics, err := derived.Metrics(map[string]string{
+		"util": "status.global.threads_connected / var.global.max_connections",
+		"abc":  "1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, m := range metrics {
+		names = append(names, m.Name)
+	}
+	if diff := deep.Equal(names, []string{"abc", "util"}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(metrics[1].Refs, []string{"status.global.threads_connected", "var.global.max_connections"}); diff != nil {
+		t.Error(diff)
+	}
+
+	v, ok := metrics[1].Value(values)
+	if !ok {
+		t.Fatal("Value returned false, expected true")
+	}
+	expect := blip.MetricValue{Name: "util", Value: 0.25, Type: blip.GAUGE}
+	if diff := deep.Equal(v, expect); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -4,10 +4,13 @@
 package event
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cashapp/blip"
@@ -61,12 +64,27 @@ func SetReceiver(r Receiver) {
 var subscribers = []Receiver{}
 var submux = &sync.Mutex{}
 
+// Subscribe adds a Receiver that receives all events after the main receiver.
+// Like all receivers, it must not block.
 func Subscribe(r Receiver) {
 	submux.Lock()
 	subscribers = append(subscribers, r)
 	submux.Unlock()
 }
 
+// Unsubscribe removes a Receiver added by Subscribe. The Receiver must be
+// comparable, like a pointer (for example, *Stream).
+func Unsubscribe(r Receiver) {
+	submux.Lock()
+	defer submux.Unlock()
+	for i := range subscribers {
+		if subscribers[i] == r {
+			subscribers = append(subscribers[:i:i], subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
 func RemoveSubscribers() {
 	submux.Lock()
 	subscribers = []Receiver{}
@@ -100,7 +118,31 @@ func Errorf(eventName string, msg string, args ...interface{}) {
 	})
 }
 
+var muted = map[string]bool{} // keyed on monitor ID
+var mutemux = &sync.Mutex{}
+
+// Mute mutes or unmutes error events for the monitor. Muted error events are
+// sent as info events (Error is false) with the message prefixed "(muted) ".
+// Monitors are muted during maintenance windows.
+func Mute(monitorId string, mute bool) {
+	mutemux.Lock()
+	if mute {
+		muted[monitorId] = true
+	} else {
+		delete(muted, monitorId)
+	}
+	mutemux.Unlock()
+}
+
 func send(e Event) {
+	if e.Error && e.MonitorId != "" {
+		mutemux.Lock()
+		if muted[e.MonitorId] {
+			e.Error = false
+			e.Message = "(muted) " + e.Message
+		}
+		mutemux.Unlock()
+	}
 	receiver.Recv(e)
 	submux.Lock()
 	for _, s := range subscribers {
@@ -154,34 +196,108 @@ func (s MonitorReceiver) Errorf(eventName string, msg string, args ...interface{
 var stdout = log.New(os.Stdout, "", log.LstdFlags|log.Lmicroseconds)
 var stderr = log.New(os.Stderr, "", log.LstdFlags|log.Lmicroseconds)
 
+// Loggers for structured formats (JSON and logfmt) that have their own ts
+var stdoutLine = log.New(os.Stdout, "", 0)
+var stderrLine = log.New(os.Stderr, "", 0)
+
+var logFormat atomic.Value // string
+
+// SetLogFormat sets the default format for Log: blip.LOG_FORMAT_TEXT (default),
+// blip.LOG_FORMAT_JSON, or blip.LOG_FORMAT_LOGFMT. Server.Boot sets it from
+// config.events.log-format after loading the config. The format is not validated.
+func SetLogFormat(format string) {
+	logFormat.Store(format)
+}
+
+// LogFormat returns the default format for Log set by SetLogFormat.
+func LogFormat() string {
+	if f, ok := logFormat.Load().(string); ok && f != "" {
+		return f
+	}
+	return blip.LOG_FORMAT_TEXT
+}
+
 // Log is the default Receiver that uses the Go built-in log package to print
 // certain events to STDOUT and error events to STDERR. Call SetReceiver to
 // override this default.
+//
+// Events are printed in Format, or the format set by SetLogFormat if not set.
+// The text format is human-readable. The JSON and logfmt formats print one
+// event per line with keys ts, event, monitor_id, message, and error, without
+// the log package prefix.
 type Log struct {
 	All      bool
+	Format   string
 	internal bool
 }
 
 func (s Log) Recv(e Event) {
 	// Always print error events to STDERR
 	if e.Error {
-		stderr.Printf("[%-25s] [%s] ERROR: %s", e.Event, e.MonitorId, e.Message)
+		s.print(e)
 		return
 	}
 
 	// Log all events? If true, then log to stdout.
 	if s.All {
-		stdout.Printf("[%-25s] [%s] %s", e.Event, e.MonitorId, e.Message)
+		s.print(e)
 		return
 	}
 
 	// If debugging, print all events
 	if blip.Debugging {
-		stdout.Printf("[%-25s] [%s] %s", e.Event, e.MonitorId, e.Message)
+		s.print(e)
 		return
 	}
 }
 
+// print prints the event in the log format: error events to STDERR, else STDOUT.
+func (s Log) print(e Event) {
+	format := s.Format
+	if format == "" {
+		format = LogFormat()
+	}
+	out := stdoutLine
+	if e.Error {
+		out = stderrLine
+	}
+	switch format {
+	case blip.LOG_FORMAT_JSON:
+		bytes, _ := json.Marshal(logEvent{
+			Ts:        e.Ts.Format(time.RFC3339Nano),
+			Event:     e.Event,
+			MonitorId: e.MonitorId,
+			Message:   e.Message,
+			Error:     e.Error,
+		})
+		out.Println(string(bytes))
+	case blip.LOG_FORMAT_LOGFMT:
+		line := blip.Logfmt(
+			"ts", e.Ts.Format(time.RFC3339Nano),
+			"event", e.Event,
+			"monitor_id", e.MonitorId,
+			"message", e.Message,
+			"error", strconv.FormatBool(e.Error),
+		)
+		out.Println(line)
+	default:
+		if e.Error {
+			stderr.Printf("[%-25s] [%s] ERROR: %s", e.Event, e.MonitorId, e.Message)
+		} else {
+			stdout.Printf("[%-25s] [%s] %s", e.Event, e.MonitorId, e.Message)
+		}
+	}
+}
+
+// logEvent is an Event printed by Log in JSON format.
+type logEvent struct {
+	Ts        string `json:"ts"`
+	Event     string `json:"event"`
+	MonitorId string `json:"monitor_id"`
+	Message   string `json:"message"`
+	Error     bool   `json:"error"`
+}
+
 // --------------------------------------------------------------------------
 
 // Tee connects multiple Receiver, like the Unix tee command. It implements
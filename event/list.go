@@ -4,25 +4,30 @@ package event
 
 // Blip events (non-monitor)
 const (
-	BOOT_CONFIG_INVALID   = "boot-config-invalid"
-	BOOT_CONFIG_LOADED    = "boot-config-loaded"
-	BOOT_CONFIG_LOADING   = "boot-config-loading"
-	BOOT_ERROR            = "boot-error"
-	BOOT_START            = "boot-start"
-	BOOT_SUCCESS          = "boot-success"
-	MONITORS_LOADED       = "monitors-loaded"
-	MONITORS_LOADING      = "monitors-loading"
-	MONITORS_RELOAD_ERROR = "monitors-reload-error"
-	MONITORS_STARTED      = "monitors-started"
-	MONITORS_STARTING     = "monitors-starting"
-	MONITORS_STOPLOSS     = "monitors-stoploss"
-	MONITOR_LOADER_PANIC  = "monitor-loader-panic"
-	PLANS_LOAD_MONITOR    = "plans-load-monitor"
-	PLANS_LOAD_SHARED     = "plans-load-shared"
-	SERVER_API_PANIC      = "server-api-panic"
-	SERVER_API_ERROR      = "server-api-error"
-	SERVER_RUN            = "server-run"
-	SERVER_STOPPED        = "server-stopped"
+	AGGREGATE_ERROR          = "aggregate-error"
+	BOOT_CONFIG_INVALID      = "boot-config-invalid"
+	BOOT_CONFIG_LOADED       = "boot-config-loaded"
+	BOOT_CONFIG_LOADING      = "boot-config-loading"
+	BOOT_ERROR               = "boot-error"
+	BOOT_START               = "boot-start"
+	BOOT_SUCCESS             = "boot-success"
+	MONITORS_LOADED          = "monitors-loaded"
+	MONITORS_LOADING         = "monitors-loading"
+	MONITORS_RELOAD_ERROR    = "monitors-reload-error"
+	MONITORS_STARTED         = "monitors-started"
+	MONITORS_STARTING        = "monitors-starting"
+	MONITORS_STOPLOSS        = "monitors-stoploss"
+	MONITOR_ADDED            = "monitor-added"
+	MONITOR_LOADER_PANIC     = "monitor-loader-panic"
+	MONITOR_REMOVED          = "monitor-removed"
+	MONITOR_REPLACED         = "monitor-replaced"
+	PLANS_LOAD_MONITOR       = "plans-load-monitor"
+	PLANS_LOAD_SHARED        = "plans-load-shared"
+	PLANS_VALIDATION_WARNING = "plans-validation-warning"
+	SERVER_API_PANIC         = "server-api-panic"
+	SERVER_API_ERROR         = "server-api-error"
+	SERVER_RUN               = "server-run"
+	SERVER_STOPPED           = "server-stopped"
 )
 
 // Monitor events
@@ -36,11 +41,19 @@ const (
 	ENGINE_PREPARE_ERROR     = "engine-prepare-error"
 	ENGINE_PREPARE_SUCCESS   = "engine-prepare-success"
 	ENGINE_EMR_TIMEOUT       = "engine-emr-timeout"
+	ENGINE_LOAD_SHED         = "engine-load-shed"
+	ENGINE_LOAD_SHED_END     = "engine-load-shed-end"
+	ENGINE_UNSUPPORTED       = "engine-unsupported"
 	LCO_COLLECT_PANIC        = "lco-collect-panic"
+	LCO_CONDITIONS_CHANGED   = "lco-conditions-changed"
 	LCO_RECEIVER_PANIC       = "lco-receiver-panic"
+	LCO_SCHEDULED_SKIPPED    = "lco-scheduled-skipped"
 	LCO_PAUSED               = "lco-paused"
 	LCO_RUNNING              = "lco-running"
 	LCO_METRICS_FAULT        = "lco-metrics-fault"
+	MAINTENANCE_END          = "maintenance-end"
+	MAINTENANCE_ERROR        = "maintenance-error"
+	MAINTENANCE_START        = "maintenance-start"
 	MONITOR_CONNECTED        = "connected"
 	MONITOR_CONNECTING       = "connecting"
 	MONITOR_ERROR            = "monitor-error"
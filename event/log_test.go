@@ -0,0 +1,46 @@
+// Copyright 2024 Block, Inc.
+
+package event
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/cashapp/blip"
+)
+
+func TestLogFormats(t *testing.T) {
+	defer func(l *log.Logger) { stderrLine = l }(stderrLine)
+	var buf bytes.Buffer
+	stderrLine = log.New(&buf, "", 0)
+
+	e := Event{
+		Ts:        time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Event:     COLLECTOR_PANIC,
+		MonitorId: "db1",
+		Message:   "status.global: panic",
+		Error:     true,
+	}
+	expect := map[string]string{
+		blip.LOG_FORMAT_JSON:   `{"ts":"2024-05-01T12:00:00Z","event":"collector-panic","monitor_id":"db1","message":"status.global: panic","error":true}` + "\n",
+		blip.LOG_FORMAT_LOGFMT: `ts=2024-05-01T12:00:00Z event=collector-panic monitor_id=db1 message="status.global: panic" error=true` + "\n",
+	}
+	for format, want := range expect {
+		buf.Reset()
+		Log{Format: format}.Recv(e)
+		if got := buf.String(); got != want {
+			t.Errorf("%s: got %s, expected %s", format, got, want)
+		}
+	}
+
+	// Default format set by SetLogFormat
+	defer SetLogFormat("")
+	SetLogFormat(blip.LOG_FORMAT_LOGFMT)
+	buf.Reset()
+	Log{}.Recv(e)
+	if got := buf.String(); got != expect[blip.LOG_FORMAT_LOGFMT] {
+		t.Errorf("default format: got %s, expected logfmt", got)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2024 Block, Inc.
+
+package event
+
+import (
+	"path"
+	"sync"
+	"time"
+)
+
+// Filter matches events by monitor ID, event name, and error. Zero values match
+// all events. Event can be a pattern like "engine-*" (see path.Match).
+type Filter struct {
+	MonitorId string
+	Event     string
+	Errors    bool // only error events
+}
+
+// Match returns true if the event matches the filter.
+func (f Filter) Match(e Event) bool {
+	if f.MonitorId != "" && e.MonitorId != f.MonitorId {
+		return false
+	}
+	if f.Event != "" {
+		if ok, _ := path.Match(f.Event, e.Event); !ok {
+			return false
+		}
+	}
+	if f.Errors && !e.Error {
+		return false
+	}
+	return true
+}
+
+// --------------------------------------------------------------------------
+
+// Buffer is a Receiver that keeps the most recent events in memory: a ring
+// buffer of fixed size. When full, it drops the oldest event. Subscribe it
+// to receive events, then call Since to get them.
+type Buffer struct {
+	*sync.Mutex
+	events []Event
+	next   int
+	full   bool
+}
+
+var _ Receiver = &Buffer{}
+
+// NewBuffer returns a Buffer that keeps the last size events.
+func NewBuffer(size int) *Buffer {
+	return &Buffer{
+		Mutex:  &sync.Mutex{},
+		events: make([]Event, size),
+	}
+}
+
+func (b *Buffer) Recv(e Event) {
+	b.Lock()
+	b.events[b.next] = e
+	b.next = (b.next + 1) % len(b.events)
+	if b.next == 0 {
+		b.full = true
+	}
+	b.Unlock()
+}
+
+// Since returns buffered events after the time that match the filter, oldest
+// first. If since is zero, it returns all buffered events that match.
+func (b *Buffer) Since(since time.Time, f Filter) []Event {
+	b.Lock()
+	defer b.Unlock()
+	first := 0
+	n := b.next
+	if b.full {
+		first = b.next
+		n = len(b.events)
+	}
+	events := []Event{}
+	for i := 0; i < n; i++ {
+		e := b.events[(first+i)%len(b.events)]
+		if !e.Ts.After(since) || !f.Match(e) {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// --------------------------------------------------------------------------
+
+// Stream is a Receiver that sends events that match its filter to a buffered
+// channel. It never blocks: if the channel is full (the reader is too slow),
+// it drops the event and counts it. Subscribe it to receive events, read from
+// Events, and call Unsubscribe when done.
+type Stream struct {
+	filter  Filter
+	c       chan Event
+	mux     *sync.Mutex
+	dropped uint
+}
+
+var _ Receiver = &Stream{}
+
+// NewStream returns a Stream that buffers up to size events.
+func NewStream(size int, f Filter) *Stream {
+	return &Stream{
+		filter: f,
+		c:      make(chan Event, size),
+		mux:    &sync.Mutex{},
+	}
+}
+
+func (s *Stream) Recv(e Event) {
+	if !s.filter.Match(e) {
+		return
+	}
+	select {
+	case s.c <- e:
+	default:
+		s.mux.Lock()
+		s.dropped++
+		s.mux.Unlock()
+	}
+}
+
+// Events returns the channel of events.
+func (s *Stream) Events() <-chan Event {
+	return s.c
+}
+
+// Dropped returns the number of events dropped since the last call, and resets
+// the count.
+func (s *Stream) Dropped() uint {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	n := s.dropped
+	s.dropped = 0
+	return n
+}
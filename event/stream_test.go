@@ -0,0 +1,89 @@
+// Copyright 2024 Block, Inc.
+
+package event_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip/event"
+)
+
+func names(events []event.Event) []string {
+	n := []string{}
+	for _, e := range events {
+		n = append(n, e.Event)
+	}
+	return n
+}
+
+func TestBuffer(t *testing.T) {
+	b := event.NewBuffer(3)
+	if got := b.Since(time.Time{}, event.Filter{}); len(got) != 0 {
+		t.Errorf("got %d events from empty buffer, expected 0", len(got))
+	}
+
+	t0 := time.Now()
+	b.Recv(event.Event{Ts: t0, Event: "e1"})
+	b.Recv(event.Event{Ts: t0.Add(1 * time.Second), Event: "e2", MonitorId: "db1"})
+	if diff := deep.Equal(names(b.Since(time.Time{}, event.Filter{})), []string{"e1", "e2"}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Buffer wraps: e1 dropped, oldest first
+	b.Recv(event.Event{Ts: t0.Add(2 * time.Second), Event: "e3", Error: true})
+	b.Recv(event.Event{Ts: t0.Add(3 * time.Second), Event: "e4", MonitorId: "db1"})
+	if diff := deep.Equal(names(b.Since(time.Time{}, event.Filter{})), []string{"e2", "e3", "e4"}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Since is exclusive
+	if diff := deep.Equal(names(b.Since(t0.Add(2*time.Second), event.Filter{})), []string{"e4"}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Filters
+	if diff := deep.Equal(names(b.Since(time.Time{}, event.Filter{MonitorId: "db1"})), []string{"e2", "e4"}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(names(b.Since(time.Time{}, event.Filter{Errors: true})), []string{"e3"}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(names(b.Since(time.Time{}, event.Filter{Event: "e[34]"})), []string{"e3", "e4"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestStream(t *testing.T) {
+	s := event.NewStream(2, event.Filter{MonitorId: "db1"})
+	event.Subscribe(s)
+	defer event.Unsubscribe(s)
+
+	// Stream never blocks: 3rd event is dropped because buffer size is 2
+	m := event.MonitorReceiver{MonitorId: "db1"}
+	m.Send("e1")
+	event.Send("e2") // filtered: no monitor ID
+	m.Send("e3")
+	m.Send("e4")
+	if n := s.Dropped(); n != 1 {
+		t.Errorf("dropped %d events, expected 1", n)
+	}
+	if n := s.Dropped(); n != 0 {
+		t.Errorf("dropped %d events after reset, expected 0", n)
+	}
+	got := []string{(<-s.Events()).Event, (<-s.Events()).Event}
+	if diff := deep.Equal(got, []string{"e1", "e3"}); diff != nil {
+		t.Error(diff)
+	}
+
+	// No events after Unsubscribe
+	event.Unsubscribe(s)
+	m.Send("e5")
+	select {
+	case e := <-s.Events():
+		t.Errorf("received event %s after Unsubscribe", e.Event)
+	default:
+	}
+}
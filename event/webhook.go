@@ -0,0 +1,299 @@
+// Copyright 2024 Block, Inc.
+
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cashapp/blip"
+)
+
+// Webhook is a Receiver that POSTs events as JSON to a URL: config.events.webhooks.
+// Recv never blocks: events that match the filter are queued, and events are
+// dropped if the queue is full. Run sends queued events in batches. Subscribe
+// it to receive events, then call Run.
+//
+// Events with the same name and monitor ID are deduplicated: if dedup is set,
+// only the first is sent per dedup window. Failed batches are retried up to
+// retries times. Webhook send errors are printed to STDERR, not sent as events,
+// because the events could be sent to the webhook. The URL is redacted in errors
+// because the path or query can contain a secret.
+type Webhook struct {
+	cfg       blip.ConfigWebhook
+	url       string // redacted for errors
+	client    *http.Client
+	batchSize int
+	batchWait time.Duration
+	dedup     time.Duration
+	timeout   time.Duration
+	retries   int
+	q         chan Event
+	// --
+	mux     *sync.Mutex
+	last    map[string]time.Time // event name + monitor ID => last sent (dedup)
+	dropped uint                 // queue full
+}
+
+var _ Receiver = &Webhook{}
+
+// NewWebhook returns a Webhook that sends events using the HTTP client. The
+// config must be valid (see blip.ConfigWebhook.Validate). Empty values are set
+// to defaults.
+func NewWebhook(cfg blip.ConfigWebhook, client *http.Client) *Webhook {
+	cfg.ApplyDefaults(blip.DefaultConfig())
+	batchSize, _ := strconv.Atoi(cfg.BatchSize)
+	queueSize, _ := strconv.Atoi(cfg.QueueSize)
+	batchWait, _ := time.ParseDuration(cfg.BatchWait)
+	timeout, _ := time.ParseDuration(cfg.Timeout)
+	retries, _ := strconv.Atoi(cfg.Retries)
+	var dedup time.Duration
+	if cfg.Dedup != "" {
+		dedup, _ = time.ParseDuration(cfg.Dedup)
+	}
+	return &Webhook{
+		cfg:       cfg,
+		url:       blip.RedactWebhookURL(cfg.URL),
+		client:    client,
+		batchSize: batchSize,
+		batchWait: batchWait,
+		dedup:     dedup,
+		timeout:   timeout,
+		retries:   retries,
+		q:         make(chan Event, queueSize),
+		mux:       &sync.Mutex{},
+		last:      map[string]time.Time{},
+	}
+}
+
+// Match returns true if the event matches the webhook filter: config.events
+// (names or patterns) and config.errors. If neither is set, all events match.
+func (w *Webhook) Match(e Event) bool {
+	if w.cfg.Errors && !e.Error {
+		return false
+	}
+	if len(w.cfg.Events) == 0 {
+		return true
+	}
+	for _, pattern := range w.cfg.Events {
+		if ok, _ := path.Match(pattern, e.Event); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Webhook) Recv(e Event) {
+	if !w.Match(e) {
+		return
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.dedup > 0 {
+		k := e.Event + "/" + e.MonitorId
+		if last, ok := w.last[k]; ok && e.Ts.Sub(last) < w.dedup {
+			return // duplicate
+		}
+		w.last[k] = e.Ts
+	}
+	select {
+	case w.q <- e:
+	default:
+		w.dropped++
+	}
+}
+
+// webhookRetryWait is the wait before the first retry. It doubles for each retry.
+const webhookRetryWait = 250 * time.Millisecond
+
+// Run sends queued events until stopChan is closed. Events are sent when a
+// batch is full or every batch-wait, whichever is first. When stopChan is
+// closed, it sends queued events (best effort) and returns within timeout:
+// the timeout is one deadline for all sends and retries on stop, not per send.
+func (w *Webhook) Run(stopChan, doneChan chan struct{}) {
+	defer close(doneChan)
+
+	// Cancel sends and retries timeout after stopChan is closed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopChan:
+		case <-ctx.Done():
+			return
+		}
+		deadline := time.NewTimer(w.timeout)
+		defer deadline.Stop()
+		select {
+		case <-deadline.C:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(w.batchWait)
+	defer ticker.Stop()
+	batch := make([]Event, 0, w.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.sendRetry(ctx, batch); err != nil {
+			w.logError("%d events not sent: %s", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case e := <-w.q:
+			batch = append(batch, e)
+			if len(batch) == w.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			w.prune()
+		case <-stopChan:
+			for {
+				if ctx.Err() != nil {
+					if n := len(batch) + len(w.q); n > 0 {
+						w.logError("%d events not sent: timeout on stop", n)
+					}
+					return
+				}
+				select {
+				case e := <-w.q:
+					batch = append(batch, e)
+					if len(batch) == w.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Dropped returns the number of events dropped because the queue was full since
+// the last call, and resets the count.
+func (w *Webhook) Dropped() uint {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	n := w.dropped
+	w.dropped = 0
+	return n
+}
+
+// sendRetry sends the batch, retrying up to w.retries times if the error is
+// retryable, until ctx is canceled.
+func (w *Webhook) sendRetry(ctx context.Context, batch []Event) error {
+	if n := w.Dropped(); n > 0 {
+		w.logError("dropped %d events: queue full", n)
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	wait := webhookRetryWait
+	for retry := 0; ; retry++ {
+		err := w.send(ctx, body)
+		if err == nil {
+			blip.Debug("webhook %s: sent %d events", w.url, len(batch))
+			return nil
+		}
+		if !retryable(err) || retry == w.retries {
+			return err
+		}
+		blip.Debug("webhook %s: retry %d/%d in %s: %s", w.url, retry+1, w.retries, wait, err)
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+		wait *= 2
+	}
+}
+
+// statusError is an HTTP response status that's not 2xx.
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("HTTP status %d", int(e))
+}
+
+// retryable returns true for network errors, 5xx, and 429 (too many requests).
+// Other 4xx are not retried because the request won't change.
+func retryable(err error) bool {
+	var status statusError
+	if !errors.As(err, &status) {
+		return true // network error, timeout, etc.
+	}
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// send POSTs the JSON array of events.
+func (w *Webhook) send(ctx context.Context, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		if uerr, ok := err.(*url.Error); ok {
+			uerr.URL = w.url // redacted
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %w", w.url, statusError(resp.StatusCode))
+	}
+	return nil
+}
+
+// logError prints an error to STDERR in the event log format. It's not sent as
+// an event (see Webhook).
+func (w *Webhook) logError(msg string, args ...interface{}) {
+	Log{}.print(Event{
+		Ts:      time.Now(),
+		Event:   "event-webhook",
+		Message: fmt.Sprintf(msg, args...),
+		Error:   true,
+	})
+}
+
+// prune removes dedup entries older than the dedup window.
+func (w *Webhook) prune() {
+	if w.dedup == 0 {
+		return
+	}
+	now := time.Now()
+	w.mux.Lock()
+	for k, last := range w.last {
+		if now.Sub(last) >= w.dedup {
+			delete(w.last, k)
+		}
+	}
+	w.mux.Unlock()
+}
@@ -0,0 +1,182 @@
+// Copyright 2024 Block, Inc.
+
+package event_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/event"
+)
+
+func TestWebhook(t *testing.T) {
+	var mux sync.Mutex
+	batches := [][]event.Event{}
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []event.Event
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Error(err)
+		}
+		mux.Lock()
+		batches = append(batches, batch)
+		auth = r.Header.Get("Authorization")
+		mux.Unlock()
+	}))
+	defer ts.Close()
+
+	wh := event.NewWebhook(blip.ConfigWebhook{
+		URL:       ts.URL,
+		Events:    []string{event.MONITORS_STOPLOSS, "collector-*"},
+		Headers:   map[string]string{"Authorization": "Bearer t1"},
+		BatchSize: "2",
+		BatchWait: "1h", // only batch size and stop flush
+		Dedup:     "1m",
+	}, http.DefaultClient)
+
+	now := time.Now()
+	for _, e := range []event.Event{
+		{Ts: now, Event: event.MONITORS_STOPLOSS, Message: "1"},
+		{Ts: now, Event: event.SERVER_RUN, Message: "filtered"},
+		{Ts: now, Event: event.COLLECTOR_PANIC, MonitorId: "db1", Message: "2"},
+		{Ts: now.Add(time.Second), Event: event.COLLECTOR_PANIC, MonitorId: "db1", Message: "dedup"},
+		{Ts: now.Add(time.Second), Event: event.COLLECTOR_PANIC, MonitorId: "db2", Message: "3"},
+	} {
+		wh.Recv(e)
+	}
+
+	stopChan := make(chan struct{})
+	doneChan := make(chan struct{})
+	go wh.Run(stopChan, doneChan)
+	close(stopChan)
+	select {
+	case <-doneChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for Run to return")
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	got := [][]string{}
+	for _, b := range batches {
+		msgs := []string{}
+		for _, e := range b {
+			msgs = append(msgs, e.Message)
+		}
+		got = append(got, msgs)
+	}
+	expect := [][]string{{"1", "2"}, {"3"}}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+	if auth != "Bearer t1" {
+		t.Errorf("got Authorization header %q, expected Bearer t1", auth)
+	}
+}
+
+func TestWebhookQueueFull(t *testing.T) {
+	wh := event.NewWebhook(blip.ConfigWebhook{
+		URL:       "http://127.0.0.1:1",
+		Errors:    true,
+		QueueSize: "1",
+	}, http.DefaultClient)
+	wh.Recv(event.Event{Event: "e1"}) // not an error, filtered
+	wh.Recv(event.Event{Event: "e2", Error: true})
+	wh.Recv(event.Event{Event: "e3", Error: true}) // queue full, dropped; does not block
+	if n := wh.Dropped(); n != 1 {
+		t.Errorf("got %d dropped, expected 1", n)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	var mux sync.Mutex
+	calls := 0
+	events := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []event.Event
+		json.NewDecoder(r.Body).Decode(&batch)
+		mux.Lock()
+		defer mux.Unlock()
+		calls++
+		switch {
+		case batch[0].Event == event.COLLECTOR_PANIC:
+			w.WriteHeader(http.StatusBadRequest) // not retried
+		case calls < 3:
+			w.WriteHeader(http.StatusServiceUnavailable) // retried
+		default:
+			events = append(events, batch[0].Event)
+		}
+	}))
+	defer ts.Close()
+
+	wh := event.NewWebhook(blip.ConfigWebhook{
+		URL:       ts.URL,
+		BatchSize: "1",
+		BatchWait: "1h",
+		Retries:   "2",
+	}, http.DefaultClient)
+	wh.Recv(event.Event{Ts: time.Now(), Event: event.MONITORS_STOPLOSS})
+	wh.Recv(event.Event{Ts: time.Now(), Event: event.COLLECTOR_PANIC})
+
+	stopChan := make(chan struct{})
+	doneChan := make(chan struct{})
+	go wh.Run(stopChan, doneChan)
+	close(stopChan)
+	select {
+	case <-doneChan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for Run to return")
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	if diff := deep.Equal(events, []string{event.MONITORS_STOPLOSS}); diff != nil {
+		t.Error(diff)
+	}
+	if calls != 4 { // 3 for stoploss (2 retries), 1 for collector panic
+		t.Errorf("got %d calls, expected 4", calls)
+	}
+}
+
+func TestWebhookStopTimeout(t *testing.T) {
+	// Webhook that never responds: on stop, Run returns after one timeout
+	// for all batches and retries, not one timeout per send
+	block := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer ts.Close()
+	defer close(block)
+
+	wh := event.NewWebhook(blip.ConfigWebhook{
+		URL:       ts.URL,
+		BatchSize: "1",
+		BatchWait: "1h",
+		Timeout:   "200ms",
+		Retries:   "3",
+	}, http.DefaultClient)
+	for i := 0; i < 5; i++ {
+		wh.Recv(event.Event{Ts: time.Now(), Event: event.MONITORS_STOPLOSS})
+	}
+
+	stopChan := make(chan struct{})
+	doneChan := make(chan struct{})
+	go wh.Run(stopChan, doneChan)
+	t0 := time.Now()
+	close(stopChan)
+	select {
+	case <-doneChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for Run to return")
+	}
+	if d := time.Since(t0); d > time.Second {
+		t.Errorf("Run returned in %s, expected about 200ms", d)
+	}
+}
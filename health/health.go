@@ -0,0 +1,272 @@
+// Copyright 2024 Block, Inc.
+
+// Package health records Blip's own health metrics per monitor: running state,
+// collection runtimes and timeouts, collector errors, sink sends, Retry buffers,
+// heartbeat errors, and maintenance. Monitor components record values, and the
+// blip domain collector (metrics/blip) and the server API GET /metrics report
+// them. Unlike the status package, values are numbers, so Blip can alert on
+// itself being degraded.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cashapp/blip"
+)
+
+// Monitor records health metrics for one monitor. It's safe for concurrent use.
+// Use Get to get the Monitor for a monitor ID; do not create directly.
+type Monitor struct {
+	*sync.Mutex
+	collect     map[string]time.Duration // keyed on level/domain
+	errors      map[string]uint64        // keyed on domain
+	cmrTimeouts map[string]uint64        // keyed on domain
+	emrTimeouts map[string]uint64        // keyed on level
+	sinks       map[string]*Sink         // keyed on sink name
+	hbReadErr   uint64
+	hbWriteErr  uint64
+	running     bool
+	maintenance bool
+	err         string
+	state       string
+	plan        string
+	lastCollect map[string]time.Time // keyed on level
+}
+
+// Sink is health metrics for one sink.
+type Sink struct {
+	Sends       uint64        // LevelCollector calls to Sink.Send
+	Errors      uint64        // Sink.Send errors
+	SendTime    time.Duration // last Sink.Send runtime
+	Retry       bool          // true if the sink uses Retry
+	RetryBuffer int           // metrics buffered by Retry
+	RetryDrops  uint64        // metrics dropped by Retry because buffer full
+	RetryErrors uint64        // Retry errors sending to the real sink
+}
+
+// Snapshot is a copy of the health metrics for one monitor.
+type Snapshot struct {
+	Collect              map[string]map[string]time.Duration // level => domain => last runtime
+	CollectErrors        map[string]uint64                   // domain => errors
+	CMRTimeouts          map[string]uint64                   // domain => timeouts
+	EMRTimeouts          map[string]uint64                   // level => timeouts
+	Sinks                map[string]Sink                     // sink name => metrics
+	HeartbeatReadErrors  uint64
+	HeartbeatWriteErrors uint64
+	Running              bool                 // monitor running
+	Maintenance          bool                 // monitor in maintenance window
+	Error                string               // last monitor error, if any
+	State                string               // current state (blip.STATE_*)
+	Plan                 string               // current plan
+	LastCollect          map[string]time.Time // level => last successful collection
+}
+
+var (
+	mux      = &sync.Mutex{}
+	monitors = map[string]*Monitor{}
+)
+
+// Get returns the Monitor for the monitor ID, creating it if needed.
+func Get(monitorId string) *Monitor {
+	mux.Lock()
+	defer mux.Unlock()
+	m, ok := monitors[monitorId]
+	if !ok {
+		m = &Monitor{
+			Mutex:       &sync.Mutex{},
+			collect:     map[string]time.Duration{},
+			errors:      map[string]uint64{},
+			cmrTimeouts: map[string]uint64{},
+			emrTimeouts: map[string]uint64{},
+			sinks:       map[string]*Sink{},
+			lastCollect: map[string]time.Time{},
+		}
+		monitors[monitorId] = m
+	}
+	return m
+}
+
+// Remove removes the Monitor for the monitor ID. It's called when the monitor
+// is stopped and removed, like status.RemoveMonitor.
+func Remove(monitorId string) {
+	mux.Lock()
+	delete(monitors, monitorId)
+	mux.Unlock()
+}
+
+// Collect records one domain collection at the level: its runtime, and its
+// error, if any. A context.DeadlineExceeded error is a collector max runtime
+// (CMR) timeout. blip.ErrMore is not an error.
+func (m *Monitor) Collect(level, domain string, runtime time.Duration, err error) {
+	m.Lock()
+	defer m.Unlock()
+	if runtime > 0 {
+		m.collect[level+"/"+domain] = runtime
+	}
+	if err == nil || err == blip.ErrMore {
+		return
+	}
+	m.errors[domain]++
+	if errors.Is(err, context.DeadlineExceeded) {
+		m.cmrTimeouts[domain]++
+	}
+}
+
+// EMRTimeout records an engine max runtime (EMR) timeout at the level.
+func (m *Monitor) EMRTimeout(level string) {
+	m.Lock()
+	m.emrTimeouts[level]++
+	m.Unlock()
+}
+
+// SinkSend records one call to Sink.Send.
+func (m *Monitor) SinkSend(sink string, runtime time.Duration, err error) {
+	m.Lock()
+	defer m.Unlock()
+	s := m.sink(sink)
+	s.Sends++
+	s.SendTime = runtime
+	if err != nil {
+		s.Errors++
+	}
+}
+
+// RetryBuffer records the number of metrics buffered by the Retry sink.
+func (m *Monitor) RetryBuffer(sink string, n int, dropped bool) {
+	m.Lock()
+	defer m.Unlock()
+	s := m.sink(sink)
+	s.Retry = true
+	s.RetryBuffer = n
+	if dropped {
+		s.RetryDrops++
+	}
+}
+
+// RetryError records a Retry error sending to the real sink.
+func (m *Monitor) RetryError(sink string) {
+	m.Lock()
+	s := m.sink(sink)
+	s.Retry = true
+	s.RetryErrors++
+	m.Unlock()
+}
+
+func (m *Monitor) sink(name string) *Sink {
+	/* -- CALLER MUST LOCK -- */
+	s, ok := m.sinks[name]
+	if !ok {
+		s = &Sink{}
+		m.sinks[name] = s
+	}
+	return s
+}
+
+// HeartbeatError records a heartbeat read (reader) or write (writer) error.
+func (m *Monitor) HeartbeatError(write bool) {
+	m.Lock()
+	if write {
+		m.hbWriteErr++
+	} else {
+		m.hbReadErr++
+	}
+	m.Unlock()
+}
+
+// MonitorRunning records whether the monitor is running.
+func (m *Monitor) MonitorRunning(running bool) {
+	m.Lock()
+	m.running = running
+	m.Unlock()
+}
+
+// Maintenance records whether the monitor is in a maintenance window.
+func (m *Monitor) Maintenance(in bool) {
+	m.Lock()
+	m.maintenance = in
+	m.Unlock()
+}
+
+// MonitorError records the last monitor error, or clears it if err is nil.
+func (m *Monitor) MonitorError(err error) {
+	m.Lock()
+	if err != nil {
+		m.err = err.Error()
+	} else {
+		m.err = ""
+	}
+	m.Unlock()
+}
+
+// PlanChanged records the current state and plan.
+func (m *Monitor) PlanChanged(state, plan string) {
+	m.Lock()
+	m.state = state
+	m.plan = plan
+	m.Unlock()
+}
+
+// Collected records a successful collection (no errors) at the level.
+func (m *Monitor) Collected(level string, t time.Time) {
+	m.Lock()
+	m.lastCollect[level] = t
+	m.Unlock()
+}
+
+// Snapshot returns a copy of the current health metrics.
+func (m *Monitor) Snapshot() Snapshot {
+	m.Lock()
+	defer m.Unlock()
+	s := Snapshot{
+		Collect:              map[string]map[string]time.Duration{},
+		CollectErrors:        make(map[string]uint64, len(m.errors)),
+		CMRTimeouts:          make(map[string]uint64, len(m.cmrTimeouts)),
+		EMRTimeouts:          make(map[string]uint64, len(m.emrTimeouts)),
+		Sinks:                make(map[string]Sink, len(m.sinks)),
+		HeartbeatReadErrors:  m.hbReadErr,
+		HeartbeatWriteErrors: m.hbWriteErr,
+		Running:              m.running,
+		Maintenance:          m.maintenance,
+		Error:                m.err,
+		State:                m.state,
+		Plan:                 m.plan,
+		LastCollect:          make(map[string]time.Time, len(m.lastCollect)),
+	}
+	for k, v := range m.collect {
+		level, domain := splitKey(k)
+		if s.Collect[level] == nil {
+			s.Collect[level] = map[string]time.Duration{}
+		}
+		s.Collect[level][domain] = v
+	}
+	for k, v := range m.errors {
+		s.CollectErrors[k] = v
+	}
+	for k, v := range m.cmrTimeouts {
+		s.CMRTimeouts[k] = v
+	}
+	for k, v := range m.emrTimeouts {
+		s.EMRTimeouts[k] = v
+	}
+	for k, v := range m.sinks {
+		s.Sinks[k] = *v
+	}
+	for k, v := range m.lastCollect {
+		s.LastCollect[k] = v
+	}
+	return s
+}
+
+// splitKey splits "level/domain". Level names can contain "/" but domain names
+// cannot, so split on the last "/".
+func splitKey(k string) (string, string) {
+	for i := len(k) - 1; i >= 0; i-- {
+		if k[i] == '/' {
+			return k[:i], k[i+1:]
+		}
+	}
+	return "", k
+}
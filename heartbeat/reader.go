@@ -12,6 +12,7 @@ import (
 
 	"github.com/cashapp/blip"
 	"github.com/cashapp/blip/event"
+	"github.com/cashapp/blip/health"
 	"github.com/cashapp/blip/status"
 )
 
@@ -55,6 +56,7 @@ type BlipReader struct {
 	doneChan chan struct{}
 	isRepl   bool
 	event    event.MonitorReceiver
+	health   *health.Monitor
 	query    string
 }
 
@@ -84,6 +86,7 @@ func NewBlipReader(args BlipReaderArgs) *BlipReader {
 		lag:      -1, // no heartbeat
 		isRepl:   true,
 		event:    event.MonitorReceiver{MonitorId: args.MonitorId},
+		health:   health.Get(args.MonitorId),
 	}
 
 	// Create heartbeat read query
@@ -149,6 +152,7 @@ func (r *BlipReader) run() {
 				time.Sleep(NoHeartbeatWait)
 			default:
 				status.Monitor(r.monitorId, "error:"+status.HEARTBEAT_READER, "error: %s (retry in %s)", err.Error(), ReadErrorWait)
+				r.health.HeartbeatError(false)
 				time.Sleep(ReadErrorWait)
 			}
 			continue
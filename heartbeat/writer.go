@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/health"
 	"github.com/cashapp/blip/sqlutil"
 	"github.com/cashapp/blip/status"
 )
@@ -42,6 +43,7 @@ type Writer struct {
 	srcRole   string
 	freq      time.Duration
 	table     string
+	health    *health.Monitor
 }
 
 func NewWriter(monitorId string, db *sql.DB, cfg blip.ConfigHeartbeat) *Writer {
@@ -66,12 +68,13 @@ func NewWriter(monitorId string, db *sql.DB, cfg blip.ConfigHeartbeat) *Writer {
 		srcRole:   cfg.Role,
 		freq:      freq,
 		table:     sqlutil.SanitizeTable(cfg.Table, blip.DEFAULT_DATABASE),
+		health:    health.Get(monitorId),
 	}
 }
 
 func (w *Writer) Write(stopChan, doneChan chan struct{}) error {
 	defer close(doneChan)
-	defer status.Monitor(w.monitorId, status.HEARTBEAT_WRITER, "stopped")
+	defer status.MonitorState(w.monitorId, status.HEARTBEAT_WRITER, status.STATE_STOPPED, "stopped")
 
 	var (
 		err    error
@@ -108,7 +111,8 @@ func (w *Writer) Write(stopChan, doneChan chan struct{}) error {
 			status.Monitor(w.monitorId, status.HEARTBEAT_WRITER, "init: MySQL is read-only, sleeping %s", ReadOnlyWait)
 			time.Sleep(ReadOnlyWait)
 		} else {
-			status.Monitor(w.monitorId, status.HEARTBEAT_WRITER, "init: error: %s (sleeping %s)", err, InitErrorWait)
+			status.MonitorState(w.monitorId, status.HEARTBEAT_WRITER, status.STATE_ERROR, "init: error: %s (sleeping %s)", err, InitErrorWait)
+			w.health.HeartbeatError(true)
 			time.Sleep(InitErrorWait)
 		}
 
@@ -142,7 +146,8 @@ func (w *Writer) Write(stopChan, doneChan chan struct{}) error {
 				status.Monitor(w.monitorId, status.HEARTBEAT_WRITER, "MySQL is read-only, sleeping %s", ReadOnlyWait)
 				time.Sleep(ReadOnlyWait)
 			} else {
-				status.Monitor(w.monitorId, status.HEARTBEAT_WRITER, "write error: %s", err)
+				status.MonitorState(w.monitorId, status.HEARTBEAT_WRITER, status.STATE_ERROR, "write error: %s", err)
+				w.health.HeartbeatError(true)
 				// No special sleep on random errors; keep trying to write at freq
 			}
 		} else {
@@ -0,0 +1,153 @@
+// Copyright 2024 Block, Inc.
+
+// Package maintenance schedules maintenance windows that mute monitors. Windows
+// are added from the config file (config.maintenance) on boot and by the API.
+// Blip checks all monitors for an active window every second: during a window,
+// a monitor mutes error events and collects the window plan (or pauses).
+// Windows end automatically.
+package maintenance
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cashapp/blip"
+)
+
+// Window is a maintenance window for the monitors by ID or tags.
+type Window struct {
+	Id       string            `json:"id"`
+	Monitors []string          `json:"monitors,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"` // all must match
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end"`
+	Plan     string            `json:"plan,omitempty"` // empty = pause
+	Reason   string            `json:"reason,omitempty"`
+}
+
+// NewWindow returns a Window from a validated config. If the config does not
+// set a start time, the window starts now.
+func NewWindow(cfg blip.ConfigMaintenanceWindow, now time.Time) Window {
+	start, end := cfg.Times(now)
+	return Window{
+		Id:       cfg.Id,
+		Monitors: cfg.Monitors,
+		Tags:     cfg.Tags,
+		Start:    start,
+		End:      end,
+		Plan:     cfg.Plan,
+		Reason:   cfg.Reason,
+	}
+}
+
+// Match returns true if the window is for the monitor: the monitor ID is
+// listed, or the monitor has all the window tags.
+func (w Window) Match(monitorId string, tags map[string]string) bool {
+	for _, id := range w.Monitors {
+		if id == monitorId {
+			return true
+		}
+	}
+	if len(w.Tags) == 0 {
+		return false
+	}
+	for k, v := range w.Tags {
+		if tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Active returns true if now is in the window: [Start, End).
+func (w Window) Active(now time.Time) bool {
+	return !now.Before(w.Start) && now.Before(w.End)
+}
+
+var (
+	mux     = &sync.Mutex{}
+	windows = map[string]Window{} // keyed on window ID
+	n       uint                  // for window IDs
+)
+
+// Add adds the window and returns it. If the window ID is not set, a unique ID
+// is set. A window with the same ID is replaced.
+func Add(w Window) (Window, error) {
+	if !w.End.After(w.Start) {
+		return w, fmt.Errorf("window end %s is not after start %s", w.End, w.Start)
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	if w.Id == "" {
+		for {
+			n++
+			w.Id = fmt.Sprintf("mw%d", n)
+			if _, ok := windows[w.Id]; !ok {
+				break
+			}
+		}
+	}
+	windows[w.Id] = w
+	return w, nil
+}
+
+// Remove removes the window. It returns false if the window does not exist.
+// Monitors in the window end maintenance on their next check.
+func Remove(id string) bool {
+	mux.Lock()
+	defer mux.Unlock()
+	_, ok := windows[id]
+	delete(windows, id)
+	return ok
+}
+
+// RemoveAll removes all windows.
+func RemoveAll() {
+	mux.Lock()
+	windows = map[string]Window{}
+	mux.Unlock()
+}
+
+// List returns all active and future windows sorted by start time. Ended
+// windows are removed.
+func List() []Window {
+	now := time.Now()
+	mux.Lock()
+	defer mux.Unlock()
+	list := make([]Window, 0, len(windows))
+	for id, w := range windows {
+		if !now.Before(w.End) {
+			delete(windows, id) // ended
+			continue
+		}
+		list = append(list, w)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Start.Equal(list[j].Start) {
+			return list[i].Id < list[j].Id
+		}
+		return list[i].Start.Before(list[j].Start)
+	})
+	return list
+}
+
+// Active returns the active window for the monitor, if any. If several windows
+// are active, it returns the one that ends last.
+func Active(monitorId string, tags map[string]string, now time.Time) (Window, bool) {
+	mux.Lock()
+	defer mux.Unlock()
+	var active Window
+	found := false
+	for _, w := range windows {
+		if !w.Active(now) || !w.Match(monitorId, tags) {
+			continue
+		}
+		if !found || w.End.After(active.End) || (w.End.Equal(active.End) && w.Id < active.Id) {
+			active = w
+			found = true
+		}
+	}
+	return active, found
+}
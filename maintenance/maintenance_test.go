@@ -0,0 +1,91 @@
+// Copyright 2024 Block, Inc.
+
+package maintenance_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/maintenance"
+)
+
+func TestWindow(t *testing.T) {
+	defer maintenance.RemoveAll()
+	now := time.Now()
+
+	w := maintenance.Window{
+		Monitors: []string{"db1"},
+		Tags:     map[string]string{"env": "staging", "region": "us"},
+		Start:    now.Add(-time.Minute),
+		End:      now.Add(time.Hour),
+	}
+	matches := []struct {
+		monitorId string
+		tags      map[string]string
+		match     bool
+	}{
+		{"db1", nil, true},
+		{"db2", map[string]string{"env": "staging", "region": "us", "x": "y"}, true},
+		{"db2", map[string]string{"env": "staging"}, false}, // not all tags
+		{"db2", nil, false},
+	}
+	for _, m := range matches {
+		if got := w.Match(m.monitorId, m.tags); got != m.match {
+			t.Errorf("Match(%s, %v) = %t, expected %t", m.monitorId, m.tags, got, m.match)
+		}
+	}
+	if !w.Active(now) || w.Active(w.End) || w.Active(w.Start.Add(-time.Second)) {
+		t.Error("Active is wrong: window is [Start, End)")
+	}
+
+	// Add sets IDs, and Active returns the window that ends last
+	w1, err := maintenance.Add(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2, _ := maintenance.Add(maintenance.Window{Monitors: []string{"db1"}, Start: now, End: now.Add(2 * time.Hour), Plan: "debug"})
+	maintenance.Add(maintenance.Window{Id: "old", Monitors: []string{"db1"}, Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)})
+	maintenance.Add(maintenance.Window{Id: "future", Monitors: []string{"db1"}, Start: now.Add(time.Hour), End: now.Add(3 * time.Hour)})
+	if w1.Id == "" || w2.Id == "" || w1.Id == w2.Id {
+		t.Errorf("window IDs not unique: %s, %s", w1.Id, w2.Id)
+	}
+	got, ok := maintenance.Active("db1", nil, now)
+	if !ok || got.Id != w2.Id {
+		t.Errorf("Active(db1) = %+v, %t; expected %s", got, ok, w2.Id)
+	}
+	if _, ok := maintenance.Active("db3", nil, now); ok {
+		t.Error("db3 in maintenance")
+	}
+
+	// List removes ended windows and sorts by start
+	ids := []string{}
+	for _, w := range maintenance.List() {
+		ids = append(ids, w.Id)
+	}
+	if diff := deep.Equal(ids, []string{w1.Id, w2.Id, "future"}); diff != nil {
+		t.Error(diff)
+	}
+
+	if !maintenance.Remove(w2.Id) || maintenance.Remove(w2.Id) {
+		t.Error("Remove did not return true then false")
+	}
+	if got, _ := maintenance.Active("db1", nil, now); got.Id != w1.Id {
+		t.Errorf("Active(db1) = %s after Remove, expected %s", got.Id, w1.Id)
+	}
+
+	if _, err := maintenance.Add(maintenance.Window{Start: now, End: now}); err == nil {
+		t.Error("no error adding window with end = start")
+	}
+}
+
+func TestNewWindow(t *testing.T) {
+	now := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	w := maintenance.NewWindow(blip.ConfigMaintenanceWindow{Id: "w", Monitors: []string{"db1"}, Duration: "2h", Plan: "p", Reason: "upgrade"}, now)
+	expect := maintenance.Window{Id: "w", Monitors: []string{"db1"}, Start: now, End: now.Add(2 * time.Hour), Plan: "p", Reason: "upgrade"}
+	if diff := deep.Equal(w, expect); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -73,6 +73,7 @@ func (c *RDS) Help() blip.CollectorHelp {
 	return blip.CollectorHelp{
 		Domain:      DOMAIN,
 		Description: "Amazon RDS metrics like 'CPUUtilization' and 'FreeableMemory'",
+		Flavors:     []string{blip.FLAVOR_RDS, blip.FLAVOR_AURORA},
 		Options: map[string]blip.CollectorHelpOption{
 			OPT_DB_ID: {
 				Name:    OPT_DB_ID,
@@ -0,0 +1,214 @@
+// Copyright 2024 Block, Inc.
+
+// Package blipmetrics provides the blip domain: Blip self-metrics per monitor.
+package blipmetrics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/health"
+)
+
+const (
+	DOMAIN = "blip"
+)
+
+// metrics are all metrics in the blip domain, in the order they're reported.
+var metrics = []blip.CollectorMetric{
+	// Engine
+	{Name: "collect_time", Type: blip.GAUGE, Desc: "Last collection runtime (milliseconds) by level and domain"},
+	{Name: "collect_errors", Type: blip.CUMULATIVE_COUNTER, Desc: "Collector errors by domain"},
+	{Name: "cmr_timeouts", Type: blip.CUMULATIVE_COUNTER, Desc: "Collector max runtime (CMR) timeouts by domain"},
+	{Name: "emr_timeouts", Type: blip.CUMULATIVE_COUNTER, Desc: "Engine max runtime (EMR) timeouts by level"},
+
+	// Sinks
+	{Name: "sink_sends", Type: blip.CUMULATIVE_COUNTER, Desc: "Sink sends by sink"},
+	{Name: "sink_errors", Type: blip.CUMULATIVE_COUNTER, Desc: "Sink send errors by sink"},
+	{Name: "sink_send_time", Type: blip.GAUGE, Desc: "Last sink send runtime (milliseconds) by sink"},
+	{Name: "retry_buffer", Type: blip.GAUGE, Desc: "Metrics buffered by Retry by sink"},
+	{Name: "retry_drops", Type: blip.CUMULATIVE_COUNTER, Desc: "Metrics dropped by Retry (buffer full) by sink"},
+	{Name: "retry_errors", Type: blip.CUMULATIVE_COUNTER, Desc: "Retry errors sending to the sink by sink"},
+
+	// MySQL connection pool (sql.DBStats)
+	{Name: "db_open_connections", Type: blip.GAUGE, Desc: "Open connections to MySQL"},
+	{Name: "db_in_use", Type: blip.GAUGE, Desc: "Connections in use"},
+	{Name: "db_idle", Type: blip.GAUGE, Desc: "Idle connections"},
+	{Name: "db_wait_count", Type: blip.CUMULATIVE_COUNTER, Desc: "Waits for a connection"},
+	{Name: "db_wait_time", Type: blip.CUMULATIVE_COUNTER, Desc: "Time waited for a connection (milliseconds)"},
+	{Name: "db_max_idle_closed", Type: blip.CUMULATIVE_COUNTER, Desc: "Connections closed due to max idle connections"},
+	{Name: "db_max_idle_time_closed", Type: blip.CUMULATIVE_COUNTER, Desc: "Connections closed due to max idle time"},
+	{Name: "db_max_lifetime_closed", Type: blip.CUMULATIVE_COUNTER, Desc: "Connections closed due to max lifetime"},
+
+	// Maintenance
+	{Name: "maintenance", Type: blip.GAUGE, Desc: "1 if the monitor is in a maintenance window, else 0"},
+
+	// Heartbeat
+	{Name: "heartbeat_read_errors", Type: blip.CUMULATIVE_COUNTER, Desc: "Heartbeat read errors"},
+	{Name: "heartbeat_write_errors", Type: blip.CUMULATIVE_COUNTER, Desc: "Heartbeat write errors"},
+}
+
+// Blip collects metrics for the blip domain. Unlike other domains, it does not
+// query MySQL: it reports health metrics recorded by the monitor (see package
+// health), and connection pool stats from the monitor's *sql.DB.
+type Blip struct {
+	db      *sql.DB
+	health  *health.Monitor
+	atLevel map[string]map[string]bool // keyed on level, then metric name
+}
+
+var _ blip.Collector = &Blip{}
+
+func NewBlip(db *sql.DB, monitorId string) *Blip {
+	return &Blip{
+		db:      db,
+		health:  health.Get(monitorId),
+		atLevel: map[string]map[string]bool{},
+	}
+}
+
+func (c *Blip) Domain() string {
+	return DOMAIN
+}
+
+func (c *Blip) Help() blip.CollectorHelp {
+	return blip.CollectorHelp{
+		Domain:      DOMAIN,
+		Description: "Blip self-metrics: collection, sinks, MySQL connection pool, maintenance, and heartbeat",
+		Options:     map[string]blip.CollectorHelpOption{},
+		Groups: []blip.CollectorKeyValue{
+			{Key: "level", Value: "the plan level (collect_time and emr_timeouts)"},
+			{Key: "domain", Value: "the domain (collect_time, collect_errors, and cmr_timeouts)"},
+			{Key: "sink", Value: "the sink name (sink_* and retry_*)"},
+		},
+		Metrics:      metrics,
+		FixedMetrics: true,
+	}
+}
+
+func (c *Blip) Prepare(ctx context.Context, plan blip.Plan) (func(), error) {
+LEVEL:
+	for _, level := range plan.Levels {
+		dom, ok := level.Collect[DOMAIN]
+		if !ok {
+			continue LEVEL // not collected in this level
+		}
+
+		// No metrics listed = collect all metrics
+		m := map[string]bool{}
+		if len(dom.Metrics) == 0 {
+			for i := range metrics {
+				m[metrics[i].Name] = true
+			}
+		}
+		for _, name := range dom.Metrics {
+			valid := false
+			for i := range metrics {
+				if metrics[i].Name == name {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				return nil, fmt.Errorf("invalid collector metric: %s (run 'blip --print-domains' to list collector metrics)", name)
+			}
+			m[name] = true
+		}
+		c.atLevel[level.Name] = m
+	}
+	return nil, nil
+}
+
+func (c *Blip) Collect(ctx context.Context, levelName string) ([]blip.MetricValue, error) {
+	m, ok := c.atLevel[levelName]
+	if !ok {
+		return nil, nil
+	}
+
+	s := c.health.Snapshot()
+	values := []blip.MetricValue{}
+	add := func(name string, v float64, group map[string]string) {
+		if !m[name] {
+			return
+		}
+		values = append(values, blip.MetricValue{
+			Name:  name,
+			Value: v,
+			Type:  typeOf(name),
+			Group: group,
+		})
+	}
+
+	// Engine
+	for level, domains := range s.Collect {
+		for domain, d := range domains {
+			add("collect_time", ms(d), map[string]string{"level": level, "domain": domain})
+		}
+	}
+	for domain, n := range s.CollectErrors {
+		add("collect_errors", float64(n), map[string]string{"domain": domain})
+	}
+	for domain, n := range s.CMRTimeouts {
+		add("cmr_timeouts", float64(n), map[string]string{"domain": domain})
+	}
+	for level, n := range s.EMRTimeouts {
+		add("emr_timeouts", float64(n), map[string]string{"level": level})
+	}
+
+	// Sinks
+	for name, sink := range s.Sinks {
+		g := map[string]string{"sink": name}
+		if sink.Sends > 0 {
+			add("sink_sends", float64(sink.Sends), g)
+			add("sink_errors", float64(sink.Errors), g)
+			add("sink_send_time", ms(sink.SendTime), g)
+		}
+		if sink.Retry {
+			add("retry_buffer", float64(sink.RetryBuffer), g)
+			add("retry_drops", float64(sink.RetryDrops), g)
+			add("retry_errors", float64(sink.RetryErrors), g)
+		}
+	}
+
+	// MySQL connection pool
+	if c.db != nil {
+		db := c.db.Stats()
+		add("db_open_connections", float64(db.OpenConnections), nil)
+		add("db_in_use", float64(db.InUse), nil)
+		add("db_idle", float64(db.Idle), nil)
+		add("db_wait_count", float64(db.WaitCount), nil)
+		add("db_wait_time", ms(db.WaitDuration), nil)
+		add("db_max_idle_closed", float64(db.MaxIdleClosed), nil)
+		add("db_max_idle_time_closed", float64(db.MaxIdleTimeClosed), nil)
+		add("db_max_lifetime_closed", float64(db.MaxLifetimeClosed), nil)
+	}
+
+	// Maintenance
+	maint := 0.0
+	if s.Maintenance {
+		maint = 1
+	}
+	add("maintenance", maint, nil)
+
+	// Heartbeat
+	add("heartbeat_read_errors", float64(s.HeartbeatReadErrors), nil)
+	add("heartbeat_write_errors", float64(s.HeartbeatWriteErrors), nil)
+
+	return values, nil
+}
+
+func typeOf(name string) byte {
+	for i := range metrics {
+		if metrics[i].Name == name {
+			return metrics[i].Type
+		}
+	}
+	return blip.UNKNOWN
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 Block, Inc.
+
+package blipmetrics
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/health"
+	"github.com/cashapp/blip/test/mock"
+)
+
+func TestCollect(t *testing.T) {
+	monitorId := "TestCollect"
+	defer health.Remove(monitorId)
+
+	h := health.Get(monitorId)
+	h.Collect("kpi", "status.global", 20*time.Millisecond, nil)
+	h.Collect("kpi", "repl", 5*time.Millisecond, fmt.Errorf("access denied"))
+	h.Collect("kpi", "size.table", 0, fmt.Errorf("query: %w", context.DeadlineExceeded))
+	h.Collect("kpi", "status.global", 10*time.Millisecond, blip.ErrMore) // not an error
+	h.EMRTimeout("kpi")
+	h.SinkSend("log", 2*time.Millisecond, nil)
+	h.RetryBuffer("datadog", 1, false)
+	h.RetryBuffer("datadog", 3, true)
+	h.RetryError("datadog")
+	h.HeartbeatError(false)
+
+	c := NewBlip(mock.NewDB(), monitorId)
+	plan := blip.Plan{
+		Levels: map[string]blip.Level{
+			"kpi": {
+				Name: "kpi",
+				Collect: map[string]blip.Domain{
+					DOMAIN: {
+						Name:    DOMAIN,
+						Metrics: []string{"collect_time", "collect_errors", "cmr_timeouts", "emr_timeouts", "sink_sends", "retry_buffer", "retry_drops", "heartbeat_read_errors"},
+					},
+				},
+			},
+		},
+	}
+	if _, err := c.Prepare(context.Background(), plan); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Collect(context.Background(), "kpi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]float64{}
+	for _, v := range got {
+		k := v.Name
+		for _, g := range []string{"level", "domain", "sink"} {
+			if v.Group[g] != "" {
+				k += " " + v.Group[g]
+			}
+		}
+		values[k] = v.Value
+	}
+	expect := map[string]float64{
+		"collect_time kpi status.global": 10, // last runtime
+		"collect_time kpi repl":          5,
+		"collect_errors repl":            1,
+		"collect_errors size.table":      1,
+		"cmr_timeouts size.table":        1,
+		"emr_timeouts kpi":               1,
+		"sink_sends log":                 1,
+		"retry_buffer datadog":           3,
+		"retry_drops datadog":            1,
+		"heartbeat_read_errors":          1,
+	}
+	if diff := deep.Equal(values, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// No metrics listed = all metrics, including connection pool stats
+	plan.Levels["kpi"].Collect[DOMAIN] = blip.Domain{Name: DOMAIN}
+	c = NewBlip(mock.NewDB(), monitorId)
+	if _, err := c.Prepare(context.Background(), plan); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = c.Collect(context.Background(), "kpi")
+	seen := map[string]bool{}
+	for _, v := range got {
+		seen[v.Name] = true
+	}
+	for _, m := range metrics {
+		if !seen[m.Name] {
+			t.Errorf("metric %s not reported", m.Name)
+		}
+	}
+
+	// Invalid metric
+	plan.Levels["kpi"].Collect[DOMAIN] = blip.Domain{Name: DOMAIN, Metrics: []string{"foo"}}
+	if _, err := NewBlip(nil, monitorId).Prepare(context.Background(), plan); err == nil {
+		t.Error("no error for invalid metric")
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/cashapp/blip"
 	"github.com/cashapp/blip/metrics/aws.rds"
+	"github.com/cashapp/blip/metrics/blip"
 	"github.com/cashapp/blip/metrics/innodb"
 	"github.com/cashapp/blip/metrics/percona"
 	"github.com/cashapp/blip/metrics/query.response-time"
@@ -105,6 +106,10 @@ func PrintDomains() string {
 			help.Domain, help.Description,
 		)
 
+		if req := help.Requires(); req != "" {
+			out += "\tRequires: " + req + "\n\n"
+		}
+
 		// Options block
 		opts := make([]string, 0, len(help.Options))
 		for o := range help.Options {
@@ -159,6 +164,14 @@ func PrintDomains() string {
 			out += "\n"
 		}
 
+		if len(help.Consumers) > 0 {
+			out += "\tConsumers:\n"
+			for _, c := range help.Consumers {
+				out += "\t\t" + c + "\n"
+			}
+			out += "\n"
+		}
+
 		if len(help.Groups) > 0 {
 			out += "\tGroups:\n"
 			for _, kv := range help.Groups {
@@ -258,6 +271,8 @@ func (f *factory) Make(domain string, args blip.CollectorFactoryArgs) (blip.Coll
 			return nil, err
 		}
 		return awsrds.NewRDS(awsrds.NewCloudWatchClient(awsConfig)), nil
+	case "blip":
+		return blipmetrics.NewBlip(args.DB, args.MonitorId), nil
 	case "innodb":
 		return innodb.NewInnoDB(args.DB), nil
 	case "percona.response-time":
@@ -265,11 +280,11 @@ func (f *factory) Make(domain string, args blip.CollectorFactoryArgs) (blip.Coll
 	case "query.response-time":
 		return queryresponsetime.NewResponseTime(args.DB), nil
 	case "repl":
-		return repl.NewRepl(args.DB), nil
+		return repl.NewRepl(args.DB, args.Flavor, args.Version), nil
 	case "repl.lag":
 		return repllag.NewLag(args.DB), nil
 	case "size.binlog":
-		return sizebinlog.NewBinlog(args.DB), nil
+		return sizebinlog.NewBinlog(args.DB, args.Flavor, args.Version), nil
 	case "size.database":
 		return sizedatabase.NewDatabase(args.DB), nil
 	case "size.table":
@@ -294,6 +309,7 @@ func (f *factory) Make(domain string, args blip.CollectorFactoryArgs) (blip.Coll
 // the same domain in the switch statement above (in factory.Make).
 var builtinCollectors = []string{
 	"aws.rds",
+	"blip",
 	"innodb",
 	"percona.response-time",
 	"query.response-time",
@@ -85,6 +85,7 @@ func (c *QRT) Help() blip.CollectorHelp {
 	return blip.CollectorHelp{
 		Domain:      blip_domain,
 		Description: "Collect QRT (Query Response Time) metrics",
+		Flavors:     []string{blip.FLAVOR_PERCONA, blip.FLAVOR_MARIADB}, // query_response_time plugin
 		Options: map[string]blip.CollectorHelpOption{
 			OPT_REAL_PERCENTILES: {
 				Name:    OPT_REAL_PERCENTILES,
@@ -72,6 +72,8 @@ func (c *ResponseTime) Help() blip.CollectorHelp {
 	return blip.CollectorHelp{
 		Domain:      DOMAIN,
 		Description: "Collect metrics for query response time",
+		MinVersion:  "8.0.0", // performance_schema.events_statements_histogram_global
+		Flavors:     []string{blip.FLAVOR_MYSQL, blip.FLAVOR_PERCONA, blip.FLAVOR_AURORA, blip.FLAVOR_RDS},
 		Options: map[string]blip.CollectorHelpOption{
 			OPT_REAL_PERCENTILES: {
 				Name:    OPT_REAL_PERCENTILES,
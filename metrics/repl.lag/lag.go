@@ -139,6 +139,7 @@ func (c *Lag) Help() blip.CollectorHelp {
 				Desc: "Replication worker usage (percentage)",
 			},
 		},
+		FixedMetrics: true,
 	}
 }
 
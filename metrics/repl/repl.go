@@ -40,8 +40,10 @@ type Repl struct {
 
 var _ blip.Collector = &Repl{}
 
-func NewRepl(db *sql.DB) *Repl {
-	return &Repl{
+// NewRepl returns a Repl collector for the MySQL flavor and version, which are
+// empty if unknown (see blip.CollectorFactoryArgs).
+func NewRepl(db *sql.DB, flavor, version string) *Repl {
+	c := &Repl{
 		db: db,
 		// --
 		atLevel: map[string]replMetrics{},
@@ -52,6 +54,13 @@ func NewRepl(db *sql.DB) *Repl {
 		statusQuery:     "SHOW SLAVE STATUS", // SHOW REPLICA STATUS as of 8.022
 		newTerms:        false,
 	}
+	// SHOW REPLICA STATUS as of MySQL 8.0.22. MariaDB versions are not MySQL
+	// versions, so keep the old terms.
+	if flavor != blip.FLAVOR_MARIADB && sqlutil.VersionGTE(version, "8.0.22") {
+		c.statusQuery = "SHOW REPLICA STATUS"
+		c.newTerms = true
+	}
+	return c
 }
 
 func (c *Repl) Domain() string {
@@ -80,6 +89,7 @@ func (c *Repl) Help() blip.CollectorHelp {
 				Desc: "1=running (no error), 0=not running, -1=not a replica",
 			},
 		},
+		FixedMetrics: true,
 		Errors: map[string]blip.CollectorHelpError{
 			ERR_NO_ACCESS: {
 				Name:    ERR_NO_ACCESS,
@@ -91,8 +101,6 @@ func (c *Repl) Help() blip.CollectorHelp {
 }
 
 func (c *Repl) Prepare(ctx context.Context, plan blip.Plan) (func(), error) {
-	haveVersion := false
-
 LEVEL:
 	for _, level := range plan.Levels {
 		dom, ok := level.Collect[DOMAIN]
@@ -123,22 +131,6 @@ LEVEL:
 			}
 			blip.Debug("error policy: %s=%s", ERR_NO_ACCESS, c.errPolicy[ERR_NO_ACCESS])
 		}
-
-		// SHOW REPLICA STATUS as of 8.022
-		if haveVersion {
-			continue
-		}
-		major, _, patch := sqlutil.MySQLVersion(ctx, c.db)
-		if major == -1 {
-			blip.Debug("failed to get/parse MySQL version, ignoring")
-			continue
-		}
-		haveVersion = true
-		if major == 8 && patch >= 22 {
-			c.statusQuery = "SHOW REPLICA STATUS"
-			c.newTerms = true
-		}
-		blip.Debug("mysql %d.x.%d %s", major, patch, c.statusQuery)
 	}
 	return nil, nil
 }
@@ -33,10 +33,15 @@ type Binlog struct {
 
 var _ blip.Collector = &Binlog{}
 
-func NewBinlog(db *sql.DB) *Binlog {
+// NewBinlog returns a Binlog collector for the MySQL flavor and version, which
+// are empty if unknown (see blip.CollectorFactoryArgs).
+func NewBinlog(db *sql.DB, flavor, version string) *Binlog {
 	return &Binlog{
 		db: db,
 		// --
+		// As of MySQL 8.0.14, SHOW BINARY LOGS has 3 cols instead of 2.
+		// MariaDB versions are not MySQL versions, and MariaDB has 2 cols.
+		cols3:     flavor != blip.FLAVOR_MARIADB && sqlutil.VersionGTE(version, "8.0.14"),
 		errPolicy: map[string]*errors.Policy{},
 	}
 }
@@ -68,6 +73,7 @@ func (c *Binlog) Help() blip.CollectorHelp {
 				Desc: "Total size of all binary logs in bytes",
 			},
 		},
+		FixedMetrics: true,
 	}
 }
 
@@ -90,11 +96,6 @@ func (c *Binlog) Prepare(ctx context.Context, plan blip.Plan) (func(), error) {
 
 	dom := plan.Levels[atLevel].Collect[DOMAIN] // domain at which size.binlog is collected
 
-	// As of MySQL 8.0.14, SHOW BINARY LOGS has 3 cols instead of 2
-	if ok, _ := sqlutil.MySQLVersionGTE("8.0.14", c.db, ctx); ok {
-		c.cols3 = true
-	}
-
 	// Apply custom error policies, if any
 	c.errPolicy[ERR_NO_ACCESS] = errors.NewPolicy(dom.Errors[ERR_NO_ACCESS])
 	c.errPolicy[ERR_NO_BINLOGS] = errors.NewPolicy(dom.Errors[ERR_NO_BINLOGS])
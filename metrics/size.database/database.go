@@ -86,6 +86,7 @@ func (c *Database) Help() blip.CollectorHelp {
 				Desc: "Database size",
 			},
 		},
+		FixedMetrics: true,
 	}
 }
 
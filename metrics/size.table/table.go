@@ -79,6 +79,7 @@ func (t *Table) Help() blip.CollectorHelp {
 				Desc: "Table size",
 			},
 		},
+		FixedMetrics: true,
 	}
 }
 
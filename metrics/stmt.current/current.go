@@ -71,6 +71,8 @@ func (c *Current) Help() blip.CollectorHelp {
 				Desc: "The count of active slow queries",
 			},
 		},
+		FixedMetrics: true,
+		Consumers:    []string{"events_statements_current"},
 	}
 }
 
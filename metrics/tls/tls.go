@@ -47,6 +47,7 @@ func (c *TLS) Help() blip.CollectorHelp {
 				Desc: "True (1) if have_ssl = YES, else false (0)",
 			},
 		},
+		FixedMetrics: true,
 	}
 }
 
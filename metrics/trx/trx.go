@@ -55,6 +55,7 @@ func (c *Trx) Help() blip.CollectorHelp {
 				Desc: "The time of oldest transaction in seconds",
 			},
 		},
+		FixedMetrics: true,
 	}
 }
 
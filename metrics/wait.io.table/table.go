@@ -162,6 +162,7 @@ func (t *Table) Help() blip.CollectorHelp {
 				Default: errors.NewPolicy("").String(),
 			},
 		},
+		Consumers: []string{"global_instrumentation"},
 	}
 }
 
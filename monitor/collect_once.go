@@ -0,0 +1,114 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/plan"
+)
+
+// CollectOnceArgs are the arguments for CollectOnce.
+type CollectOnceArgs struct {
+	Config     blip.ConfigMonitor // monitor config (required)
+	DbMaker    blip.DbFactory     // makes the MySQL connection (required)
+	PlanLoader *plan.Loader       // shared plans must be loaded (required)
+	Plan       string             // plan name (optional; default: monitor plan)
+	Level      string             // level name (optional; default: least frequent level)
+	Interval   time.Duration      // if > 0, collect twice this time apart (optional)
+}
+
+// CollectOnce prepares one Engine for the plan, collects the level once (or
+// twice if Interval is set), and returns the metrics from each collection in
+// order. It does not start the monitor or send metrics to sinks.
+//
+// If the level isn't specified, it collects the least frequent level, which
+// collects all domains in the plan.
+//
+// This is used for blip --collect-once.
+func CollectOnce(ctx context.Context, args CollectOnceArgs) ([][]*blip.Metrics, error) {
+	cfg := args.Config
+	db, _, err := args.DbMaker.Make(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if err := args.PlanLoader.LoadMonitor(cfg, args.DbMaker); err != nil {
+		return nil, fmt.Errorf("while loading plans: %s", err)
+	}
+	planName := args.Plan
+	if planName == "" {
+		planName = cfg.Plan
+	}
+	p, err := args.PlanLoader.Plan(cfg.MonitorId, planName, db)
+	if err != nil {
+		return nil, err
+	}
+	p.MonitorId = cfg.MonitorId
+	p.InterpolateEnvVars()
+	p.InterpolateMonitor(&cfg)
+
+	// Same as LevelCollector.changePlan: sort (merge) levels before Prepare
+	levels := plan.Sort(&p)
+	levelName := args.Level
+	if levelName == "" {
+		// Highest level collects all domains except scheduled levels, which
+		// are sorted last
+		levelName = levels[len(levels)-1].Name
+		for i := len(levels) - 1; i >= 0; i-- {
+			if !levels[i].Scheduled() {
+				levelName = levels[i].Name
+				break
+			}
+		}
+	} else if _, ok := p.Levels[levelName]; !ok {
+		return nil, fmt.Errorf("plan %s has no level %s", p.Name, levelName)
+	}
+
+	engine := NewEngine(cfg, db)
+	defer engine.Stop()
+	if err := engine.Prepare(ctx, p, func() {}, func() {}); err != nil {
+		return nil, err
+	}
+
+	// Engine max runtime, same as the LevelCollector: based on the fastest
+	// level, or the level's own freq and window if it's scheduled
+	emr := blip.TimeLimit(0.1, levels[0].Freq, time.Second)
+	var scheduled *plan.SortedLevel
+	for i := range levels {
+		if levels[i].Name == levelName && levels[i].Scheduled() {
+			scheduled = &levels[i]
+		}
+	}
+	n := 1
+	if args.Interval > 0 {
+		n = 2
+	}
+	all := make([][]*blip.Metrics, 0, n)
+	for i := 1; i <= n; i++ {
+		if i > 1 {
+			select {
+			case <-time.After(args.Interval):
+			case <-ctx.Done():
+				return all, ctx.Err()
+			}
+		}
+		startTime := time.Now()
+		deadline := startTime.Add(emr)
+		if scheduled != nil {
+			deadline = scheduledDeadline(*scheduled, startTime)
+		}
+		emrCtx, emrCancel := context.WithDeadline(ctx, deadline)
+		metrics, err := engine.Collect(emrCtx, uint(i), levelName, startTime)
+		emrCancel()
+		all = append(all, metrics)
+		if err != nil {
+			return all, err
+		}
+	}
+	return all, nil
+}
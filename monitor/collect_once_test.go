@@ -0,0 +1,52 @@
+// Copyright 2024 Block, Inc.
+
+package monitor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/dbconn"
+	"github.com/cashapp/blip/monitor"
+	"github.com/cashapp/blip/plan"
+)
+
+func TestCollectOnce(t *testing.T) {
+	setup(t, "mysql57")
+
+	planName := "../test/plans/var_global.yaml"
+	moncfg := loadConfig(t, planName, "m1", "mysql57")
+
+	pl := plan.NewLoader(nil)
+	if err := pl.LoadShared(blip.ConfigPlans{Files: []string{planName}}, dbconn.NewConnFactory(nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	args := monitor.CollectOnceArgs{
+		Config:     moncfg,
+		DbMaker:    dbconn.NewConnFactory(nil, nil),
+		PlanLoader: pl,
+		Interval:   100 * time.Millisecond,
+	}
+	all, err := monitor.CollectOnce(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("got %d collections, expected 2 (--interval)", len(all))
+	}
+	for i := range all {
+		if len(all[i]) == 0 || len(all[i][0].Values["var.global"]) != 4 {
+			t.Errorf("collection %d: got %+v, expected 4 var.global metrics", i+1, all[i])
+		}
+	}
+
+	// Invalid level is an error, not a panic in Engine.Collect
+	args.Level = "nonexistent"
+	args.Interval = 0
+	if _, err := monitor.CollectOnce(context.Background(), args); err == nil {
+		t.Errorf("no error for invalid level, expected one")
+	}
+}
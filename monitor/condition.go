@@ -0,0 +1,186 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/sqlutil"
+)
+
+// conditions evaluates plan level and domain conditions (blip.Condition) for
+// one Engine.Prepare. MySQL values are queried only if needed by a condition,
+// and only once per Prepare (cached).
+type conditions struct {
+	ctx    context.Context
+	db     *sql.DB
+	state  string // monitor state, or "" if unknown (queried from MySQL)
+	flavor string
+
+	replica  *bool
+	readOnly *bool
+	tables   map[string]bool
+}
+
+func newConditions(ctx context.Context, db *sql.DB, state, flavor string) *conditions {
+	return &conditions{
+		ctx:    ctx,
+		db:     db,
+		state:  state,
+		flavor: flavor,
+		tables: map[string]bool{},
+	}
+}
+
+// eval returns true if the condition is true or nil. If false, it returns the
+// reason. If a MySQL value cannot be queried, it returns an error.
+func (c *conditions) eval(when *blip.Condition) (bool, string, error) {
+	if when == nil {
+		return true, "", nil
+	}
+	if when.Role != "" {
+		replica, err := c.isReplica()
+		if err != nil {
+			return false, "", err
+		}
+		role := blip.CONDITION_ROLE_SOURCE
+		if replica {
+			role = blip.CONDITION_ROLE_REPLICA
+		}
+		if role != when.Role {
+			return false, "role is " + role, nil
+		}
+	}
+	if len(when.State) > 0 {
+		state, err := c.monitorState()
+		if err != nil {
+			return false, "", err
+		}
+		if !in(state, when.State) {
+			return false, "state is " + state, nil
+		}
+	}
+	if when.Writable != nil {
+		ro, err := c.isReadOnly()
+		if err != nil {
+			return false, "", err
+		}
+		if *when.Writable == ro {
+			return false, fmt.Sprintf("read_only is %t", ro), nil
+		}
+	}
+	if when.Table != "" {
+		exists, err := c.tableExists(when.Table)
+		if err != nil {
+			return false, "", err
+		}
+		if !exists {
+			return false, "table " + when.Table + " does not exist", nil
+		}
+	}
+	if len(when.Flavor) > 0 && c.flavor != "" && !in(c.flavor, when.Flavor) {
+		return false, "flavor is " + c.flavor, nil // unknown flavor presumed to match
+	}
+	return true, "", nil
+}
+
+// changed returns true and the reason if the MySQL role or read_only is different
+// than when the conditions were evaluated. Only values queried for a condition
+// are checked, so it does nothing if no condition checks role, writable, or state
+// (without the plan changer). ctx is used instead of the Prepare ctx.
+func (c *conditions) changed(ctx context.Context) (bool, string, error) {
+	now := newConditions(ctx, c.db, c.state, c.flavor)
+	if c.replica != nil {
+		replica, err := now.isReplica()
+		if err != nil {
+			return false, "", err
+		}
+		if replica != *c.replica {
+			return true, fmt.Sprintf("replica changed from %t to %t", *c.replica, replica), nil
+		}
+	}
+	if c.readOnly != nil {
+		ro, err := now.isReadOnly()
+		if err != nil {
+			return false, "", err
+		}
+		if ro != *c.readOnly {
+			return true, fmt.Sprintf("read_only changed from %t to %t", *c.readOnly, ro), nil
+		}
+	}
+	return false, "", nil
+}
+
+func (c *conditions) isReplica() (bool, error) {
+	if c.replica != nil {
+		return *c.replica, nil
+	}
+	// SHOW SLAVE STATUS works on all versions; SHOW REPLICA STATUS as of 8.0.22
+	row, err := sqlutil.RowToMap(c.ctx, c.db, "SHOW SLAVE STATUS")
+	if err != nil {
+		row, err = sqlutil.RowToMap(c.ctx, c.db, "SHOW REPLICA STATUS")
+		if err != nil {
+			return false, fmt.Errorf("cannot check replica status: %s", err)
+		}
+	}
+	replica := len(row) > 0
+	c.replica = &replica
+	return replica, nil
+}
+
+func (c *conditions) isReadOnly() (bool, error) {
+	if c.readOnly != nil {
+		return *c.readOnly, nil
+	}
+	var ro int
+	if err := c.db.QueryRowContext(c.ctx, "SELECT @@read_only").Scan(&ro); err != nil {
+		return false, fmt.Errorf("cannot check read_only: %s", err)
+	}
+	readOnly := ro == 1
+	c.readOnly = &readOnly
+	return readOnly, nil
+}
+
+// monitorState returns the monitor state from the plan changer (LCO), or if
+// unknown (plan changer not enabled), active or read-only based on read_only.
+func (c *conditions) monitorState() (string, error) {
+	if c.state != "" {
+		return c.state, nil
+	}
+	ro, err := c.isReadOnly()
+	if err != nil {
+		return "", err
+	}
+	if ro {
+		return blip.STATE_READ_ONLY, nil
+	}
+	return blip.STATE_ACTIVE, nil
+}
+
+func (c *conditions) tableExists(table string) (bool, error) {
+	if exists, ok := c.tables[table]; ok {
+		return exists, nil
+	}
+	db, tbl, _ := strings.Cut(table, ".") // already validated
+	var n int
+	err := c.db.QueryRowContext(c.ctx,
+		"SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = ?", db, tbl).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("cannot check table %s: %s", table, err)
+	}
+	c.tables[table] = n > 0
+	return n > 0, nil
+}
+
+func in(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
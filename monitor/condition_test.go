@@ -0,0 +1,58 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cashapp/blip"
+)
+
+func TestConditionsNoQuery(t *testing.T) {
+	// Conditions that don't query MySQL: nil, state (known), and flavor
+	c := newConditions(context.Background(), nil, blip.STATE_ACTIVE, blip.FLAVOR_MYSQL)
+
+	tests := []struct {
+		when   *blip.Condition
+		ok     bool
+		reason string
+	}{
+		{nil, true, ""},
+		{&blip.Condition{State: []string{blip.STATE_ACTIVE, blip.STATE_READ_ONLY}}, true, ""},
+		{&blip.Condition{State: []string{blip.STATE_READ_ONLY}}, false, "state is active"},
+		{&blip.Condition{Flavor: []string{blip.FLAVOR_MYSQL}}, true, ""},
+		{&blip.Condition{Flavor: []string{blip.FLAVOR_PERCONA}}, false, "flavor is mysql"},
+	}
+	for _, test := range tests {
+		ok, reason, err := c.eval(test.when)
+		if err != nil {
+			t.Errorf("%+v: error: %s", test.when, err)
+		}
+		if ok != test.ok || reason != test.reason {
+			t.Errorf("%+v: got %t '%s', expected %t '%s'", test.when, ok, reason, test.ok, test.reason)
+		}
+	}
+
+	// Unknown flavor is presumed to match
+	c = newConditions(context.Background(), nil, blip.STATE_ACTIVE, "")
+	if ok, _, _ := c.eval(&blip.Condition{Flavor: []string{blip.FLAVOR_PERCONA}}); !ok {
+		t.Errorf("unknown flavor did not match")
+	}
+}
+
+func TestConditionsChangedNoQuery(t *testing.T) {
+	// Conditions that didn't query role or read_only never change, so changed
+	// doesn't query MySQL (nil db would panic)
+	c := newConditions(context.Background(), nil, blip.STATE_ACTIVE, blip.FLAVOR_MYSQL)
+	if _, _, err := c.eval(&blip.Condition{State: []string{blip.STATE_ACTIVE}}); err != nil {
+		t.Fatal(err)
+	}
+	changed, reason, err := c.changed(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Errorf("changed = true (%s), expected false", reason)
+	}
+}
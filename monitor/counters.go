@@ -0,0 +1,112 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cashapp/blip"
+)
+
+// counters converts CUMULATIVE_COUNTER metrics to deltas or per-second rates
+// for levels with blip.Level.Counters set. It's used only by the Engine, which
+// serializes calls to convert.
+//
+// The last value of every counter is saved on every collection, even at levels
+// that report cumulative counters, so a delta or rate is always since the last
+// time the counter was collected (at any level). The first value of a counter
+// is saved but not reported because there's no previous value. A counter reset
+// is detected when MySQL Uptime decreases (MySQL restarted), which clears all
+// saved values, or when a counter decreases (e.g. truncated performance_schema
+// table), which drops the value.
+type counters struct {
+	last   map[string]counterValue // keyed on blip.MetricKey
+	uptime int64                   // MySQL Uptime at last collection, or 0 if unknown
+}
+
+type counterValue struct {
+	value float64
+	ts    time.Time
+}
+
+func newCounters() *counters {
+	return &counters{
+		last: map[string]counterValue{},
+	}
+}
+
+// reset checks MySQL Uptime and clears saved values if MySQL restarted. Uptime
+// is ignored if zero (unknown).
+func (c *counters) reset(uptime int64) {
+	if uptime == 0 {
+		return
+	}
+	if uptime < c.uptime {
+		blip.Debug("Uptime decreased from %d to %d, resetting %d counters", c.uptime, uptime, len(c.last))
+		c.last = map[string]counterValue{}
+	}
+	c.uptime = uptime
+}
+
+// convert converts cumulative counters in m, in place, if mode is COUNTERS_DELTA
+// or COUNTERS_RATE. Either way, it saves the last value of every counter.
+func (c *counters) convert(m *blip.Metrics, mode string) {
+	convert := mode == blip.COUNTERS_DELTA || mode == blip.COUNTERS_RATE
+	for domain, values := range m.Values {
+		n := 0
+		for _, v := range values {
+			if v.Type != blip.CUMULATIVE_COUNTER {
+				values[n] = v
+				n++
+				continue
+			}
+			key := blip.MetricKey(domain, v.Name, v.Group)
+			last, ok := c.last[key]
+			if ok && !m.Begin.After(last.ts) {
+				// Past interval from a long-running collector: older than last
+				// value, so don't save it, and drop it if converting
+				if !convert {
+					values[n] = v
+					n++
+				}
+				continue
+			}
+			c.last[key] = counterValue{value: v.Value, ts: m.Begin}
+			if !convert {
+				values[n] = v
+				n++
+				continue
+			}
+			if !ok || v.Value < last.value {
+				continue // first value or counter reset: drop
+			}
+			delta := v.Value - last.value
+			if mode == blip.COUNTERS_DELTA {
+				v.Value = delta
+				v.Type = blip.DELTA_COUNTER
+			} else {
+				v.Value = delta / m.Begin.Sub(last.ts).Seconds()
+				v.Type = blip.GAUGE
+			}
+			values[n] = v
+			n++
+		}
+		if n == 0 {
+			delete(m.Values, domain)
+		} else {
+			m.Values[domain] = values[:n]
+		}
+	}
+}
+
+// mysqlUptime returns MySQL Uptime in seconds, or 0 on error.
+func mysqlUptime(ctx context.Context, db *sql.DB) int64 {
+	uptime, err := globalStatus(ctx, db, "Uptime")
+	if err != nil {
+		blip.Debug("cannot get Uptime: %s", err)
+		return 0
+	}
+	return uptime
+}
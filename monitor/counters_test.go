@@ -0,0 +1,100 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip"
+)
+
+func counterMetrics(begin time.Time, queries, threads float64) *blip.Metrics {
+	return &blip.Metrics{
+		Begin: begin,
+		Values: map[string][]blip.MetricValue{
+			"status.global": {
+				{Name: "queries", Value: queries, Type: blip.CUMULATIVE_COUNTER},
+				{Name: "threads_running", Value: threads, Type: blip.GAUGE},
+			},
+		},
+	}
+}
+
+func TestCountersDelta(t *testing.T) {
+	c := newCounters()
+	t0 := time.Now()
+
+	// First value: saved but dropped because there's no previous value
+	m := counterMetrics(t0, 100, 5)
+	c.reset(1000)
+	c.convert(m, blip.COUNTERS_DELTA)
+	expect := []blip.MetricValue{{Name: "threads_running", Value: 5, Type: blip.GAUGE}}
+	if diff := deep.Equal(m.Values["status.global"], expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Second value: delta
+	m = counterMetrics(t0.Add(5*time.Second), 150, 6)
+	c.reset(1005)
+	c.convert(m, blip.COUNTERS_DELTA)
+	expect = []blip.MetricValue{
+		{Name: "queries", Value: 50, Type: blip.DELTA_COUNTER},
+		{Name: "threads_running", Value: 6, Type: blip.GAUGE},
+	}
+	if diff := deep.Equal(m.Values["status.global"], expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// MySQL restarted (Uptime decreased): all values reset, so dropped again
+	m = counterMetrics(t0.Add(10*time.Second), 200, 7)
+	c.reset(3)
+	c.convert(m, blip.COUNTERS_DELTA)
+	expect = []blip.MetricValue{{Name: "threads_running", Value: 7, Type: blip.GAUGE}}
+	if diff := deep.Equal(m.Values["status.global"], expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestCountersRate(t *testing.T) {
+	c := newCounters()
+	t0 := time.Now()
+	c.convert(counterMetrics(t0, 100, 5), blip.COUNTERS_RATE)
+
+	m := counterMetrics(t0.Add(10*time.Second), 150, 5)
+	c.convert(m, blip.COUNTERS_RATE)
+	expect := []blip.MetricValue{
+		{Name: "queries", Value: 5, Type: blip.GAUGE}, // 50 / 10s
+		{Name: "threads_running", Value: 5, Type: blip.GAUGE},
+	}
+	if diff := deep.Equal(m.Values["status.global"], expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Counter decreased (reset) without Uptime change: dropped
+	m = counterMetrics(t0.Add(20*time.Second), 10, 5)
+	c.convert(m, blip.COUNTERS_RATE)
+	if len(m.Values["status.global"]) != 1 {
+		t.Errorf("got %+v, expected only threads_running", m.Values["status.global"])
+	}
+}
+
+func TestCountersCumulative(t *testing.T) {
+	// Cumulative (default) doesn't convert but saves values so that the next
+	// delta at another level is since the last collection
+	c := newCounters()
+	t0 := time.Now()
+	m := counterMetrics(t0, 100, 5)
+	c.convert(m, "")
+	if diff := deep.Equal(m, counterMetrics(t0, 100, 5)); diff != nil {
+		t.Error(diff)
+	}
+
+	m = counterMetrics(t0.Add(time.Second), 110, 5)
+	c.convert(m, blip.COUNTERS_DELTA)
+	if m.Values["status.global"][0].Value != 10 {
+		t.Errorf("got delta %f, expected 10", m.Values["status.global"][0].Value)
+	}
+}
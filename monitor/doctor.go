@@ -0,0 +1,467 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	myerr "github.com/go-mysql/errors"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/derived"
+	"github.com/cashapp/blip/metrics"
+	"github.com/cashapp/blip/plan"
+)
+
+// Problems found by Doctor. A domain has one problem or none (OK).
+const (
+	PROBLEM_NONE        = ""
+	PROBLEM_PRIVILEGES  = "missing privileges"
+	PROBLEM_CONSUMERS   = "performance_schema consumers disabled"
+	PROBLEM_PFS         = "performance_schema disabled"
+	PROBLEM_NO_TABLE    = "table does not exist"
+	PROBLEM_VERSION     = "MySQL version or flavor not supported"
+	PROBLEM_COLLECTOR   = "collector error"
+	PROBLEM_UNAVAILABLE = "monitor unavailable"
+)
+
+// DoctorTimeout is the timeout for each domain (prepare and collect) when
+// running Doctor.
+var DoctorTimeout = 10 * time.Second
+
+// Diagnosis is the result of Doctor for one monitor.
+type Diagnosis struct {
+	MonitorId string
+	Plans     []string          // plans checked
+	Error     string            // monitor-level error (connect, load plans), if any
+	Domains   []DomainDiagnosis // sorted by domain name
+	Grants    []string          // all GRANT statements needed, if any
+}
+
+// DomainDiagnosis is the result of Doctor for one domain in one plan.
+type DomainDiagnosis struct {
+	Plan        string
+	Level       string
+	Domain      string
+	Problem     string   // PROBLEM_ const; PROBLEM_NONE if OK
+	Error       string   // error from Prepare or Collect, if any
+	Fix         []string // SQL statements to fix the problem, if known
+	ErrorPolicy string   // collector error policy that handles the error, if any
+	Skipped     string   // why the domain is not collected (condition false), if skipped
+}
+
+// OK returns true if the monitor and all domains have no problems.
+func (d Diagnosis) OK() bool {
+	if d.Error != "" {
+		return false
+	}
+	for i := range d.Domains {
+		if d.Domains[i].Problem != PROBLEM_NONE {
+			return false
+		}
+	}
+	return true
+}
+
+func (d Diagnosis) String() string {
+	var b strings.Builder
+	if d.Error != "" {
+		fmt.Fprintf(&b, "%s: %s: %s\n", d.MonitorId, PROBLEM_UNAVAILABLE, d.Error)
+		return b.String()
+	}
+	nFail, nSkip := 0, 0
+	for i := range d.Domains {
+		if d.Domains[i].Skipped != "" {
+			nSkip++
+		} else if d.Domains[i].Problem != PROBLEM_NONE {
+			nFail++
+		}
+	}
+	skipped := ""
+	if nSkip > 0 {
+		skipped = fmt.Sprintf(", %d skipped", nSkip)
+	}
+	fmt.Fprintf(&b, "%s: plans %s: %d domains OK%s, %d failed\n", d.MonitorId, strings.Join(d.Plans, ", "), len(d.Domains)-nFail-nSkip, skipped, nFail)
+	for _, dd := range d.Domains {
+		if dd.Skipped != "" {
+			fmt.Fprintf(&b, "  SKIP  %s/%s/%s: %s\n", dd.Plan, dd.Level, dd.Domain, dd.Skipped)
+			continue
+		}
+		if dd.Problem == PROBLEM_NONE {
+			fmt.Fprintf(&b, "  OK    %s/%s/%s\n", dd.Plan, dd.Level, dd.Domain)
+			continue
+		}
+		fmt.Fprintf(&b, "  FAIL  %s/%s/%s: %s: %s\n", dd.Plan, dd.Level, dd.Domain, dd.Problem, dd.Error)
+		for _, fix := range dd.Fix {
+			fmt.Fprintf(&b, "        fix: %s\n", fix)
+		}
+		if dd.ErrorPolicy != "" {
+			fmt.Fprintf(&b, "        or set error policy %s (see blip --print-domains) to handle the error\n", dd.ErrorPolicy)
+		}
+	}
+	if len(d.Grants) > 0 {
+		fmt.Fprintf(&b, "  GRANT statements needed:\n")
+		for _, g := range d.Grants {
+			fmt.Fprintf(&b, "    %s\n", g)
+		}
+	}
+	return b.String()
+}
+
+// Doctor checks that the monitor can collect all domains in its plans: the plan
+// set by config.monitors.plan and every plan in config.monitors.plans.change.
+// It connects to MySQL, loads the monitor plans, then prepares and collects every
+// domain once (a dry run: metrics are not sent to sinks). It does not start the
+// monitor. Domain option truncate-table is disabled so that Doctor does not reset
+// performance_schema tables.
+//
+// This is used for blip --doctor.
+func Doctor(ctx context.Context, cfg blip.ConfigMonitor, dbMaker blip.DbFactory, planLoader *plan.Loader) Diagnosis {
+	d := Diagnosis{
+		MonitorId: cfg.MonitorId,
+		Domains:   []DomainDiagnosis{},
+		Grants:    []string{},
+	}
+
+	db, _, err := dbMaker.Make(cfg)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	defer db.Close()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	err = db.PingContext(pingCtx)
+	cancel()
+	if err != nil {
+		d.Error = fmt.Sprintf("while connecting to MySQL: %s", err)
+		return d
+	}
+
+	if err := planLoader.LoadMonitor(cfg, dbMaker); err != nil {
+		d.Error = fmt.Sprintf("while loading plans: %s", err)
+		return d
+	}
+
+	// Plans to check: monitor plan (or default plan), and plans by state.
+	// The state of each plan is used to evaluate plan conditions, like the
+	// engine: unknown (queried) for the monitor plan, else the plan state.
+	planNames := []string{cfg.Plan}
+	planState := map[string]string{cfg.Plan: blip.STATE_NONE}
+	for _, ps := range []struct{ name, state string }{
+		{cfg.Plans.Change.Offline.Plan, blip.STATE_OFFLINE},
+		{cfg.Plans.Change.Standby.Plan, blip.STATE_STANDBY},
+		{cfg.Plans.Change.ReadOnly.Plan, blip.STATE_READ_ONLY},
+		{cfg.Plans.Change.Active.Plan, blip.STATE_ACTIVE},
+	} {
+		name := ps.name
+		if name == "" {
+			continue
+		}
+		if _, ok := planState[name]; !ok {
+			planState[name] = ps.state
+		}
+		seen := false
+		for _, p := range planNames {
+			if p == name {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			planNames = append(planNames, name)
+		}
+	}
+
+	user := currentUser(ctx, db)
+	consumers, pfs := setupConsumers(ctx, db)
+	flavor, version := detectMySQL(ctx, db, cfg.MonitorId) // empty if unknown
+
+	grants := map[string]bool{}
+	for _, planName := range planNames {
+		p, err := planLoader.Plan(cfg.MonitorId, planName, db)
+		if err != nil {
+			d.Error = err.Error()
+			return d
+		}
+		d.Plans = append(d.Plans, p.Name)
+
+		// Dry run: don't truncate performance_schema tables
+		for levelName := range p.Levels {
+			for domainName, dom := range p.Levels[levelName].Collect {
+				if domainTruncates(domainName) {
+					if dom.Options == nil {
+						dom.Options = map[string]string{}
+					}
+					dom.Options["truncate-table"] = "no"
+					p.Levels[levelName].Collect[domainName] = dom
+				}
+			}
+		}
+
+		// Check each domain once at its most frequent level, which is the
+		// first level in sorted levels that collects the domain. Domains are
+		// skipped if their condition is false, like the engine does; plan.Sort
+		// applies level conditions to domains.
+		levels := plan.Sort(&p)
+		cond := newConditions(ctx, db, planState[planName], flavor)
+		checked := map[string]bool{}
+		domainDiags := []DomainDiagnosis{}
+		for _, level := range levels {
+			for domainName := range p.Levels[level.Name].Collect {
+				if checked[domainName] || domainName == derived.DOMAIN {
+					continue // derived metrics have no collector
+				}
+				checked[domainName] = true
+				if ok, reason, err := cond.eval(p.Levels[level.Name].Collect[domainName].When); !ok {
+					if err != nil {
+						reason = err.Error()
+					}
+					domainDiags = append(domainDiags, DomainDiagnosis{
+						Plan:    p.Name,
+						Level:   level.Name,
+						Domain:  domainName,
+						Skipped: "when: " + reason,
+					})
+					continue
+				}
+				dd := doctorDomain(ctx, cfg, db, p, level.Name, domainName, user, consumers, pfs, flavor, version)
+				for _, fix := range dd.Fix {
+					if strings.HasPrefix(fix, "GRANT") {
+						grants[fix] = true
+					}
+				}
+				domainDiags = append(domainDiags, dd)
+			}
+		}
+		sort.Slice(domainDiags, func(i, j int) bool { return domainDiags[i].Domain < domainDiags[j].Domain })
+		d.Domains = append(d.Domains, domainDiags...)
+	}
+
+	for g := range grants {
+		d.Grants = append(d.Grants, g)
+	}
+	sort.Strings(d.Grants)
+	return d
+}
+
+// domainTruncates returns true if the domain collector has option truncate-table.
+func domainTruncates(domain string) bool {
+	mc, err := metrics.Make(domain, blip.CollectorFactoryArgs{Validate: true})
+	if err != nil {
+		return false
+	}
+	_, ok := mc.Help().Options["truncate-table"]
+	return ok
+}
+
+func doctorDomain(ctx context.Context, cfg blip.ConfigMonitor, db *sql.DB, p blip.Plan, levelName, domainName, user string, consumers map[string]bool, pfs bool, flavor, version string) DomainDiagnosis {
+	dd := DomainDiagnosis{
+		Plan:   p.Name,
+		Level:  levelName,
+		Domain: domainName,
+	}
+
+	c, err := metrics.Make(domainName, blip.CollectorFactoryArgs{
+		Config:    cfg,
+		DB:        db,
+		MonitorId: cfg.MonitorId,
+		Flavor:    flavor,
+		Version:   version,
+	})
+	if err != nil {
+		dd.Problem = PROBLEM_COLLECTOR
+		dd.Error = err.Error()
+		return dd
+	}
+	help := c.Help()
+
+	// MySQL flavor and version that the collector requires. The engine skips
+	// unsupported domains, so remove the domain from the plan.
+	if err := help.Supports(flavor, version); err != nil {
+		dd.Problem = PROBLEM_VERSION
+		dd.Error = err.Error()
+		return dd
+	}
+
+	// Consumers that the collector requires. Consumers is nil if they couldn't
+	// be checked (e.g. no privileges), in which case Collect will probably fail.
+	if len(help.Consumers) > 0 && consumers != nil {
+		if !pfs {
+			dd.Problem = PROBLEM_PFS
+			dd.Error = "performance_schema is OFF"
+			dd.Fix = []string{"SET performance_schema=ON in my.cnf and restart MySQL"}
+			return dd
+		}
+		disabled := []string{}
+		for _, name := range help.Consumers {
+			if !consumers[name] {
+				disabled = append(disabled, name)
+			}
+		}
+		if len(disabled) > 0 {
+			dd.Problem = PROBLEM_CONSUMERS
+			dd.Error = strings.Join(disabled, ", ")
+			for _, name := range disabled {
+				dd.Fix = append(dd.Fix, fmt.Sprintf("UPDATE performance_schema.setup_consumers SET ENABLED='YES' WHERE NAME='%s';", name))
+			}
+			return dd
+		}
+	}
+
+	// Dry run: prepare and collect once
+	domainCtx, cancel := context.WithTimeout(ctx, DoctorTimeout)
+	defer cancel()
+	cleanup, err := c.Prepare(domainCtx, p)
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err == nil {
+		_, err = c.Collect(domainCtx, levelName)
+		if err == blip.ErrMore {
+			err = nil // long-running collector is ok
+		}
+	}
+	if err == nil {
+		return dd // OK
+	}
+
+	dd.Error = err.Error()
+	dd.Problem, dd.Fix = diagnose(err, user)
+	dd.ErrorPolicy = errorPolicy(help, err)
+	return dd
+}
+
+var (
+	reErrorCode     = regexp.MustCompile(`Error (\d+)`)
+	reNeedPriv      = regexp.MustCompile(`you need \(at least one of\) the (.+?) privilege`)
+	reCommandDenied = regexp.MustCompile(`(\w+) command denied to user '[^']*'@'[^']*' for table '([^']+)'`)
+	reDbDenied      = regexp.MustCompile(`to database '([^']+)'`)
+	reHandlesCode   = regexp.MustCompile(`(?i)error (\d+)`)
+)
+
+// errorCode returns the MySQL error code in err, or 0 if none. Collectors often
+// wrap MySQL errors as strings, so it falls back to parsing "Error N" in the message.
+func errorCode(err error) uint16 {
+	if code := myerr.MySQLErrorCode(err); code != 0 {
+		return code
+	}
+	m := reErrorCode.FindStringSubmatch(err.Error())
+	if len(m) != 2 {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return uint16(n)
+}
+
+// diagnose maps a collector error to a problem and statements to fix it.
+func diagnose(err error, user string) (string, []string) {
+	msg := err.Error()
+	switch errorCode(err) {
+	case 1227: // ER_SPECIFIC_ACCESS_DENIED_ERROR
+		m := reNeedPriv.FindStringSubmatch(msg)
+		if len(m) != 2 {
+			return PROBLEM_PRIVILEGES, nil
+		}
+		// "SUPER, REPLICATION CLIENT": never grant SUPER, so use the first other
+		priv := ""
+		for _, p := range strings.Split(m[1], ",") {
+			p = strings.TrimSpace(p)
+			if p != "" && p != "SUPER" {
+				priv = p
+				break
+			}
+		}
+		if priv == "" {
+			return PROBLEM_PRIVILEGES, nil
+		}
+		return PROBLEM_PRIVILEGES, []string{fmt.Sprintf("GRANT %s ON *.* TO %s;", priv, user)}
+	case 1142, 1143: // ER_TABLEACCESS_DENIED_ERROR, ER_COLUMNACCESS_DENIED_ERROR
+		m := reCommandDenied.FindStringSubmatch(msg)
+		if len(m) != 3 {
+			return PROBLEM_PRIVILEGES, nil
+		}
+		table := strings.ReplaceAll(m[2], "`", "")
+		if !strings.Contains(table, ".") {
+			table = "*.*" // older MySQL does not report the db
+		}
+		return PROBLEM_PRIVILEGES, []string{fmt.Sprintf("GRANT %s ON %s TO %s;", m[1], table, user)}
+	case 1044: // ER_DBACCESS_DENIED_ERROR
+		m := reDbDenied.FindStringSubmatch(msg)
+		if len(m) != 2 {
+			return PROBLEM_PRIVILEGES, nil
+		}
+		return PROBLEM_PRIVILEGES, []string{fmt.Sprintf("GRANT SELECT ON `%s`.* TO %s;", m[1], user)}
+	case 1146, 1109: // ER_NO_SUCH_TABLE, ER_UNKNOWN_TABLE
+		return PROBLEM_NO_TABLE, nil
+	case 1064, 1193: // ER_PARSE_ERROR, ER_UNKNOWN_SYSTEM_VARIABLE
+		return PROBLEM_VERSION, nil
+	}
+	if strings.Contains(strings.ToLower(msg), "version") {
+		return PROBLEM_VERSION, nil
+	}
+	return PROBLEM_COLLECTOR, nil
+}
+
+// errorPolicy returns the name of the collector error policy that handles err,
+// if any. Error policies declare the MySQL error they handle in Handles, like
+// "MySQL error 1146: Table ... doesn't exist".
+func errorPolicy(help blip.CollectorHelp, err error) string {
+	code := errorCode(err)
+	if code == 0 {
+		return ""
+	}
+	for name, e := range help.Errors {
+		m := reHandlesCode.FindStringSubmatch(e.Handles)
+		if len(m) == 2 && m[1] == strconv.Itoa(int(code)) {
+			return name
+		}
+	}
+	return ""
+}
+
+// currentUser returns the MySQL user like 'blip'@'%' for GRANT statements.
+func currentUser(ctx context.Context, db *sql.DB) string {
+	var user string
+	if err := db.QueryRowContext(ctx, "SELECT CURRENT_USER()").Scan(&user); err != nil {
+		return "'blip'@'%'"
+	}
+	i := strings.LastIndex(user, "@")
+	if i < 0 {
+		return "'" + user + "'"
+	}
+	return fmt.Sprintf("'%s'@'%s'", user[:i], user[i+1:])
+}
+
+// setupConsumers returns enabled performance_schema consumers, and false if
+// performance_schema is disabled. The map is nil if consumers can't be checked.
+func setupConsumers(ctx context.Context, db *sql.DB) (map[string]bool, bool) {
+	var pfs string
+	if err := db.QueryRowContext(ctx, "SELECT @@performance_schema").Scan(&pfs); err != nil {
+		return nil, true
+	}
+	if pfs != "1" && !blip.Bool(pfs) {
+		return map[string]bool{}, false
+	}
+	rows, err := db.QueryContext(ctx, "SELECT NAME, ENABLED FROM performance_schema.setup_consumers")
+	if err != nil {
+		return nil, true
+	}
+	defer rows.Close()
+	consumers := map[string]bool{}
+	for rows.Next() {
+		var name, enabled string
+		if err := rows.Scan(&name, &enabled); err != nil {
+			return nil, true
+		}
+		consumers[name] = blip.Bool(enabled)
+	}
+	return consumers, true
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Block, Inc.
+
+package monitor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/dbconn"
+	"github.com/cashapp/blip/monitor"
+	"github.com/cashapp/blip/plan"
+	"github.com/cashapp/blip/test"
+)
+
+func TestDoctorUnavailable(t *testing.T) {
+	// Doctor doesn't start the monitor, so a monitor that can't connect is
+	// reported as unavailable, not an error or a panic
+	moncfg := blip.ConfigMonitor{
+		MonitorId: "m1",
+		Username:  "root",
+		Password:  "test",
+		Hostname:  "127.0.0.1:1", // nothing listening
+		Plan:      "../test/plans/var_global.yaml",
+	}
+	moncfg.ApplyDefaults(blip.DefaultConfig())
+
+	d := monitor.Doctor(context.Background(), moncfg, dbconn.NewConnFactory(nil, nil), plan.NewLoader(nil))
+	if d.OK() {
+		t.Errorf("OK() = true, expected false")
+	}
+	if d.Error == "" {
+		t.Errorf("Error not set, expected connection error")
+	}
+	if d.MonitorId != "m1" {
+		t.Errorf("MonitorId = %s, expected m1", d.MonitorId)
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	_, db, err := test.Connection("mysql57")
+	if err != nil {
+		if test.Build {
+			t.Skip("mysql57 not running")
+		} else {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	planName := "../test/plans/var_global.yaml"
+	moncfg := blip.ConfigMonitor{
+		MonitorId: "m1",
+		Username:  "root",
+		Password:  "test",
+		Hostname:  "127.0.0.1:" + test.MySQLPort["mysql57"],
+		Plan:      planName,
+	}
+	moncfg.ApplyDefaults(blip.DefaultConfig())
+
+	pl := plan.NewLoader(nil)
+	if err := pl.LoadShared(blip.ConfigPlans{Files: []string{planName}}, dbconn.NewConnFactory(nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	d := monitor.Doctor(context.Background(), moncfg, dbconn.NewConnFactory(nil, nil), pl)
+	if !d.OK() {
+		t.Errorf("OK() = false, expected true:\n%s", d.String())
+	}
+	if len(d.Domains) != 1 || d.Domains[0].Domain != "var.global" {
+		t.Errorf("got domains %+v, expected 1 for var.global", d.Domains)
+	}
+}
+
+func TestDiagnosisSkipped(t *testing.T) {
+	// Domains skipped by a false condition are not problems
+	d := monitor.Diagnosis{
+		MonitorId: "m1",
+		Plans:     []string{"p1"},
+		Domains: []monitor.DomainDiagnosis{
+			{Plan: "p1", Level: "l1", Domain: "repl", Skipped: "when: role is source"},
+			{Plan: "p1", Level: "l1", Domain: "status.global"},
+		},
+	}
+	if !d.OK() {
+		t.Errorf("OK() = false, expected true")
+	}
+	expect := "m1: plans p1: 1 domains OK, 1 skipped, 0 failed\n" +
+		"  SKIP  p1/l1/repl: when: role is source\n" +
+		"  OK    p1/l1/status.global\n"
+	if got := d.String(); got != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expect)
+	}
+}
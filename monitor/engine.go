@@ -8,17 +8,21 @@ import (
 	"fmt"
 	"runtime"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/derived"
 	"github.com/cashapp/blip/event"
+	"github.com/cashapp/blip/health"
 	"github.com/cashapp/blip/metrics"
+	"github.com/cashapp/blip/sqlutil"
 	"github.com/cashapp/blip/status"
 )
 
-// CollectParallel sets how many domains to collect in parallel. Currently, this
-// is not configurable via Blip config; it can only be changed via integration.
+// CollectParallel sets how many domains to collect in parallel if there's no
+// Scheduler. With a Scheduler, config.scheduler.collect-parallel sets it.
 var CollectParallel = 2
 
 // collection is the metrics from one domain. The flow is roughly:
@@ -50,13 +54,26 @@ type Engine struct {
 	db        *sql.DB
 	monitorId string
 	// --
-	event event.MonitorReceiver
-	*sync.Mutex
+	event          event.MonitorReceiver
+	*sync.RWMutex  // Collect read locks; Prepare and Stop write lock
 	plan           blip.Plan
-	collectors     map[string]*clutch   // keyed on domain
-	collectAt      map[string][]*clutch // keyed on level, sorted ascending by CMR
-	checkAt        map[string][]*clutch // keyed on level
-	collectionChan chan collection
+	collectors     map[string]*clutch          // keyed on domain
+	collectAt      map[string][]*clutch        // keyed on level, sorted ascending by CMR
+	checkAt        map[string][]*clutch        // keyed on level
+	derivedAt      map[string][]derived.Metric // keyed on level
+	counters       *counters                   // converts counters if any level sets Counters
+	countersOn     bool                        // true if any level converts counters
+	loadShed       *loadShed                   // nil if config.load-shed not enabled
+	collectionChan chan collection             // collections from past intervals (long-running collectors)
+	sweepMux       *sync.Mutex                 // guards sweeps
+	sweeps         map[uint]chan collection    // keyed on interval, collections for running Collect calls
+	collectMux     *sync.Mutex                 // guards loadShed and counters between concurrent Collect calls
+	flavor         string                      // MySQL flavor, detected in Prepare (see detectMySQL)
+	version        string                      // MySQL version, detected in Prepare
+	state          string                      // monitor state for plan conditions (see setState)
+	cond           *conditions                 // plan conditions evaluated by last Prepare
+	scheduler      *Scheduler                  // nil if not shared (see Scheduler)
+	health         *health.Monitor
 }
 
 func NewEngine(cfg blip.ConfigMonitor, db *sql.DB) *Engine {
@@ -66,11 +83,18 @@ func NewEngine(cfg blip.ConfigMonitor, db *sql.DB) *Engine {
 		monitorId: cfg.MonitorId,
 		// --
 		event:          event.MonitorReceiver{MonitorId: cfg.MonitorId},
-		Mutex:          &sync.Mutex{},
+		RWMutex:        &sync.RWMutex{},
 		collectors:     map[string]*clutch{},
 		collectAt:      map[string][]*clutch{},
 		checkAt:        map[string][]*clutch{},
+		derivedAt:      map[string][]derived.Metric{},
+		counters:       newCounters(),
+		loadShed:       newLoadShed(cfg.LoadShed),
 		collectionChan: make(chan collection, len(metrics.List())*2),
+		sweepMux:       &sync.Mutex{},
+		sweeps:         map[uint]chan collection{},
+		collectMux:     &sync.Mutex{},
+		health:         health.Get(cfg.MonitorId),
 	}
 }
 
@@ -82,6 +106,28 @@ func (e *Engine) DB() *sql.DB {
 	return e.db
 }
 
+// setState sets the monitor state for evaluating plan conditions (blip.Condition)
+// in the next call to Prepare. The LCO calls it before Prepare on state change.
+func (e *Engine) setState(state string) {
+	e.Lock()
+	e.state = state
+	e.Unlock()
+}
+
+// conditionsChanged returns true and the reason if MySQL values that the plan
+// conditions depend on (role and read_only) changed since Prepare, in which case
+// the plan must be prepared again to re-evaluate the conditions. The plan changer
+// does this on state change, so this is only needed without it.
+func (e *Engine) conditionsChanged(ctx context.Context) (bool, string, error) {
+	e.RLock()
+	cond := e.cond
+	e.RUnlock()
+	if cond == nil {
+		return false, "", nil
+	}
+	return cond.changed(ctx)
+}
+
 // Prepare prepares the engine to collect metrics for the plan. The engine
 // must be successfully prepared for Collect() to work because Prepare()
 // initializes metric collectors for every level of the plan. Prepare() can
@@ -120,27 +166,67 @@ func (e *Engine) Prepare(ctx context.Context, plan blip.Plan, before, after func
 		return lerr
 	}
 
+	// Detect MySQL flavor and version every time because Prepare is called
+	// after reconnecting to MySQL (see LevelCollector.changePlan), and MySQL
+	// might have been upgraded or failed over to a different instance.
+	flavor, version := detectMySQL(ctx, e.db, e.monitorId)
+	e.Lock()
+	e.flavor, e.version = flavor, version
+	e.Unlock()
+
 	// Find minimum intervals (freq) for plan and each domain.
 	minFreq, domainFreq := plan.Freq()
 
 	// Create and prepare metric collectors for every level. Return on error
 	// because the error might be fatal, e.g. something misconfigured and the
 	// plan cannot work.
-	collectors := map[string]*clutch{}  // keyed on domain
-	collectAt := map[string][]*clutch{} // keyed on level
-	domainsAt := map[string][]string{}  // keyed on level
-	allDomains := map[string]bool{}     // keyed on level
+	collectors := map[string]*clutch{}         // keyed on domain
+	collectAt := map[string][]*clutch{}        // keyed on level
+	domainsAt := map[string][]string{}         // keyed on level
+	allDomains := map[string]bool{}            // keyed on level
+	unsupported := map[string]string{}         // keyed on domain => reason
+	derivedAt := map[string][]derived.Metric{} // keyed on level
+	e.Lock()
+	cond := newConditions(ctx, e.db, e.state, flavor)
+	e.Unlock()
+	skippedWhen := []string{} // level/domain (reason)
 	for levelName, level := range plan.Levels {
 		domains := make([]string, 0, len(level.Collect))
 		domainsAt[levelName] = make([]string, 0, len(level.Collect))
 
 		for domain := range level.Collect {
-			// At this level, collect this domain (sorted by domain freq below)
-			domains = append(domains, domain)
-			allDomains[domain] = true
+			// Skip domain at this level if its condition is false. If the
+			// condition can't be checked, skip the domain rather than fail
+			// Prepare, which would be retried forever.
+			ok, reason, err := cond.eval(level.Collect[domain].When)
+			if err != nil {
+				reason = err.Error()
+			}
+			if !ok {
+				skippedWhen = append(skippedWhen, fmt.Sprintf("%s/%s (%s)", levelName, domain, reason))
+				continue
+			}
+
+			// Derived metrics are computed by the engine after collecting
+			// the other domains, not by a collector
+			if domain == derived.DOMAIN {
+				dm, err := derived.Metrics(level.Collect[domain].Options)
+				if err != nil {
+					lerr = fmt.Errorf("while preparing %s/%s/%s: %s", plan.Name, levelName, domain, err)
+					return lerr
+				}
+				derivedAt[levelName] = dm
+				continue
+			}
+
+			if _, ok := unsupported[domain]; ok {
+				continue // skip at all levels
+			}
 
 			// Make collector first time it's seen (they're unique in a plan)
 			if _, ok := collectors[domain]; ok {
+				domains = append(domains, domain) // collect at this level
+				allDomains[domain] = true
 				continue // already seen
 			}
 			c, err := metrics.Make(
@@ -149,6 +235,8 @@ func (e *Engine) Prepare(ctx context.Context, plan blip.Plan, before, after func
 					Config:    e.cfg,
 					DB:        e.db,
 					MonitorId: e.monitorId,
+					Flavor:    flavor,
+					Version:   version,
 				},
 			)
 			if err != nil {
@@ -156,6 +244,17 @@ func (e *Engine) Prepare(ctx context.Context, plan blip.Plan, before, after func
 				return lerr
 			}
 
+			// Skip domains the collector doesn't support on this MySQL instead
+			// of failing Prepare, which would be retried forever
+			if err := c.Help().Supports(flavor, version); err != nil {
+				unsupported[domain] = err.Error()
+				continue
+			}
+
+			// At this level, collect this domain (sorted by domain freq below)
+			domains = append(domains, domain)
+			allDomains[domain] = true
+
 			status.Monitor(e.monitorId, status.ENGINE_PREPARE, "%s: prepare collector %s", plan.Name, domain)
 			cleanup, err := c.Prepare(ctx, plan)
 			if err != nil {
@@ -168,13 +267,14 @@ func (e *Engine) Prepare(ctx context.Context, plan blip.Plan, before, after func
 			// if EMR (engine max runtime) expires but CMR (collector max runtime)
 			// allows the collector to keep running.
 			collectors[domain] = &clutch{ // new clutch
-				c:              c,
-				cleanup:        cleanup,
-				domain:         domain,
-				cmr:            blip.TimeLimit(0.2, domainFreq[domain], 2*time.Second), // collector interval minus 20% (max 2s)
-				collectionChan: e.collectionChan,
-				event:          e.event,
-				Mutex:          &sync.Mutex{},
+				c:         c,
+				cleanup:   cleanup,
+				domain:    domain,
+				cmr:       blip.TimeLimit(0.2, domainFreq[domain], 2*time.Second), // collector interval minus 20% (max 2s)
+				deliver:   e.deliver,
+				event:     e.event,
+				scheduler: e.scheduler,
+				Mutex:     &sync.Mutex{},
 			}
 		}
 
@@ -230,12 +330,49 @@ func (e *Engine) Prepare(ctx context.Context, plan blip.Plan, before, after func
 	e.collectors = collectors // new mcs
 	e.plan = plan             // new plan
 	e.collectAt = collectAt   // new levels
+	e.derivedAt = derivedAt   // new derived metrics
+	e.cond = cond             // conditions evaluated for new plan
+	e.countersOn = false
+	for _, level := range plan.Levels {
+		if level.Counters == blip.COUNTERS_DELTA || level.Counters == blip.COUNTERS_RATE {
+			e.countersOn = true
+			break
+		}
+	}
 
 	e.Unlock() // UNLOCK plan ---------------------------------------
 
 	status.Monitor(e.monitorId, status.ENGINE_PLAN, plan.Name)
 	e.event.Sendf(event.ENGINE_PREPARE_SUCCESS, plan.Name)
 
+	// Report domains skipped because MySQL doesn't support them, or clear the
+	// status if the new plan has none
+	if len(unsupported) > 0 {
+		skipped := make([]string, 0, len(unsupported))
+		for domain := range unsupported {
+			skipped = append(skipped, domain)
+		}
+		sort.Strings(skipped)
+		reasons := make([]string, len(skipped))
+		for i, domain := range skipped {
+			reasons[i] = unsupported[domain]
+		}
+		status.Monitor(e.monitorId, status.ENGINE_UNSUPPORTED, "%s: skipped domains: %s", plan.Name, strings.Join(reasons, "; "))
+		e.event.Sendf(event.ENGINE_UNSUPPORTED, "%s: skipped domains: %s", plan.Name, strings.Join(reasons, "; "))
+	} else {
+		status.RemoveComponent(e.monitorId, status.ENGINE_UNSUPPORTED)
+	}
+
+	// Report domains skipped because their conditions are false, or clear the
+	// status if none
+	if len(skippedWhen) > 0 {
+		sort.Strings(skippedWhen)
+		status.Monitor(e.monitorId, status.ENGINE_CONDITIONS, "%s: skipped: %s", plan.Name, strings.Join(skippedWhen, "; "))
+		blip.Debug("%s: %s: skipped by condition: %v", e.monitorId, plan.Name, skippedWhen)
+	} else {
+		status.RemoveComponent(e.monitorId, status.ENGINE_CONDITIONS)
+	}
+
 	status.Monitor(e.monitorId, status.ENGINE_PREPARE, "%s: level-collector after callback", plan.Name)
 	after() // notify caller (lco.changePlan) that we have swapped the plan
 
@@ -255,11 +392,15 @@ func (e *Engine) Prepare(ctx context.Context, plan blip.Plan, before, after func
 // Both metrics and an error can be returned in the case of partially success:
 // some collectors work but others fail. Caller should check returned metrics
 // even if an error is returned.
+//
+// Collect can be called concurrently for different levels and intervals: the
+// LCO collects scheduled levels in a goroutine so they don't block the other
+// levels. The interval must be unique.
 func (e *Engine) Collect(emrCtx context.Context, interval uint, levelName string, startTime time.Time) ([]*blip.Metrics, error) {
 	// Don't change plans or stop while collecting. Engine max runtime (emrCtx)
 	// ensures this collection won't take too long and block Prepare or Stop.
-	e.Lock()
-	defer e.Unlock()
+	e.RLock()
+	defer e.RUnlock()
 
 	// Collection ID for status and logging, paired with monitor ID like "db1.local: myPlan/kpi/5"
 	coId := fmt.Sprintf("%s/%s/%d", e.plan.Name, levelName, interval)
@@ -274,11 +415,29 @@ func (e *Engine) Collect(emrCtx context.Context, interval uint, levelName string
 		return []*blip.Metrics{&blip.Metrics{Values: map[string][]blip.MetricValue{}}}, nil // see return guarantee in Collect comment
 	}
 	blip.Debug("%s: %s: collect", e.monitorId, coId)
+
+	// Skip expensive domains if MySQL is overloaded (config.load-shed)
+	if e.loadShed != nil {
+		e.collectMux.Lock()
+		domains = e.shedLoad(emrCtx, coId, domains, startTime)
+		e.collectMux.Unlock()
+	}
+
+	// Receive collections for this interval on its own channel so concurrent
+	// Collect calls don't receive each other's collections (see deliver)
+	sweep := make(chan collection, len(domains)*2)
+	e.sweepMux.Lock()
+	e.sweeps[interval] = sweep
+	e.sweepMux.Unlock()
+	defer e.endSweep(interval, sweep)
+
 	status.Monitor(e.monitorId, status.ENGINE_COLLECT, coId+": collecting")
 
-	// Collect metrics for each domain in parallel (limit: CollectParallel)
-	sem := make(chan bool, CollectParallel) // semaphore for CollectParallel
-	for i := 0; i < CollectParallel; i++ {
+	// Collect metrics for each domain in parallel (limit: CollectParallel or
+	// config.scheduler.collect-parallel)
+	parallel := e.scheduler.collectParallel()
+	sem := make(chan bool, parallel) // semaphore for CollectParallel
+	for i := 0; i < parallel; i++ {
 		sem <- true
 	}
 
@@ -295,6 +454,13 @@ func (e *Engine) Collect(emrCtx context.Context, interval uint, levelName string
 	for _, cl := range domains {
 		select {
 		case <-sem:
+			// Wait for global budget (config.scheduler.max-collect), if any,
+			// which cl.collect releases
+			if !e.scheduler.acquire(emrCtx) {
+				sem <- true
+				blip.Debug("EMR timeout waiting for scheduler max-collect")
+				break
+			}
 			go cl.collect(*m, sem)
 			running[cl.c.Domain()] = true
 		case <-emrCtx.Done():
@@ -321,43 +487,87 @@ func (e *Engine) Collect(emrCtx context.Context, interval uint, levelName string
 SWEEP:
 	for len(running) > 0 {
 		status.Monitor(e.monitorId, status.ENGINE_COLLECT, "%s: receiving metrics, %d collectors running", coId, len(running))
+		var c collection
 		select {
-		case c := <-e.collectionChan:
-			/*
-				DO NOT USE c.Values!
-				That's the embedded collection.(blip.Metrics).Values.
-				Use only c.vals.
-			*/
-			if c.Interval == interval { // this interval/collection
-				delete(running, c.domain)
-				if n := len(c.vals); n > 0 {
-					metrics[0].Values[c.domain] = c.vals
-					nValues += n
-				}
-				errs[c.domain] = c.err // save all, including nil
-			} else { // past interval/collection
-				// Merge with existing past interval metrics, else append new *blip.Metrics
-				merged := false
-				for _, m := range metrics {
-					if m.Interval != c.Interval {
-						continue
-					}
-					m.Values[c.domain] = c.vals
-					merged = true
-					break
-				}
-				if !merged {
-					old := c.Metrics
-					old.Values = map[string][]blip.MetricValue{c.domain: c.vals}
-					metrics = append(metrics, &old)
-				}
-			}
-			// @todo if c.runtime > some config, drop and send event.DROP_METRICS_RUNTIME
+		case c = <-sweep: // this interval
+		case c = <-e.collectionChan: // past interval
 		case <-emrCtx.Done(): // engine runtime max
 			blip.Debug("EMR timeout receiving collections")
-			// @todo event so we can monitor is edge case
+			e.health.EMRTimeout(levelName)
 			break SWEEP
 		}
+		/*
+			DO NOT USE c.Values!
+			That's the embedded collection.(blip.Metrics).Values.
+			Use only c.vals.
+		*/
+		if e.loadShed != nil {
+			e.collectMux.Lock()
+			e.loadShed.record(c.domain, c.runtime)
+			if c.domain == "status.global" {
+				e.loadShed.observe(c.vals, c.Begin)
+			}
+			e.collectMux.Unlock()
+		}
+		e.health.Collect(c.Level, c.domain, c.runtime, c.err)
+		if c.Interval == interval { // this interval/collection
+			delete(running, c.domain)
+			if n := len(c.vals); n > 0 {
+				// Append because a long-running collector can flush more values
+				// for this interval while it's being collected
+				metrics[0].Values[c.domain] = append(metrics[0].Values[c.domain], c.vals...)
+				nValues += n
+			}
+			errs[c.domain] = c.err // save all, including nil
+		} else { // past interval/collection
+			// Merge with existing past interval metrics, else append new *blip.Metrics
+			merged := false
+			for _, m := range metrics {
+				if m.Interval != c.Interval {
+					continue
+				}
+				m.Values[c.domain] = c.vals
+				merged = true
+				break
+			}
+			if !merged {
+				old := c.Metrics
+				old.Values = map[string][]blip.MetricValue{c.domain: c.vals}
+				metrics = append(metrics, &old)
+			}
+		}
+		// @todo if c.runtime > some config, drop and send event.DROP_METRICS_RUNTIME
+	}
+
+	// Convert cumulative counters to deltas or rates, if any level converts.
+	// Do past intervals (from long-running collectors) first, in order, then
+	// this interval.
+	if e.countersOn {
+		uptime := mysqlUptime(emrCtx, e.db)
+		past := metrics[1:]
+		sort.Slice(past, func(i, j int) bool { return past[i].Interval < past[j].Interval })
+		e.collectMux.Lock()
+		e.counters.reset(uptime)
+		for _, m := range past {
+			e.counters.convert(m, e.plan.Levels[m.Level].Counters)
+		}
+		e.counters.convert(metrics[0], e.plan.Levels[levelName].Counters)
+		e.collectMux.Unlock()
+	}
+
+	// Derived metrics from values collected at this level (after converting
+	// counters, so derived metrics from counters use deltas or rates)
+	if dm := e.derivedAt[levelName]; len(dm) > 0 {
+		vals := make([]blip.MetricValue, 0, len(dm))
+		for i := range dm {
+			if v, ok := dm[i].Value(metrics[0].Values); ok {
+				vals = append(vals, v)
+			}
+		}
+		if len(vals) > 0 {
+			metrics[0].Values[derived.DOMAIN] = vals
+			nValues += len(vals)
+		}
 	}
 	metrics[0].End = time.Now()
 
@@ -411,6 +621,76 @@ SWEEP:
 	return metrics, fmt.Errorf("%s: failed: zero metrics collected, %d errors", coId, errCount)
 }
 
+// deliver sends a collection from a clutch to the Collect call for its interval,
+// or to collectionChan if that call has returned (long-running collector) so the
+// next Collect call receives it as a past interval. It doesn't block: it returns
+// false if the channel is full.
+func (e *Engine) deliver(c collection) bool {
+	e.sweepMux.Lock()
+	defer e.sweepMux.Unlock()
+	ch, ok := e.sweeps[c.Interval]
+	if !ok {
+		ch = e.collectionChan
+	}
+	select {
+	case ch <- c:
+		return true
+	default:
+		return false
+	}
+}
+
+// endSweep stops delivering collections for the interval to sweep, and moves
+// any it didn't receive (EMR timeout) to collectionChan for the next Collect call.
+func (e *Engine) endSweep(interval uint, sweep chan collection) {
+	e.sweepMux.Lock()
+	defer e.sweepMux.Unlock()
+	delete(e.sweeps, interval)
+	for {
+		select {
+		case c := <-sweep:
+			select {
+			case e.collectionChan <- c:
+			default:
+				e.event.Errorf(event.DROP_METRICS_FLUSH, "%s: dropping metrics interval %d because channel blocked", c.domain, c.Interval)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// shedLoad checks MySQL Threads_running and returns the domains to collect:
+// all domains if MySQL is not overloaded, else only domains that are not
+// expensive. It reports when shedding starts and stops (events), and which
+// domains it skips (status). The caller must lock collectMux.
+func (e *Engine) shedLoad(ctx context.Context, coId string, domains []*clutch, now time.Time) []*clutch {
+	ls := e.loadShed
+	if ls.update(ls.threadsRunning(ctx, e.db, now), now) {
+		if ls.shedding {
+			e.event.Errorf(event.ENGINE_LOAD_SHED, "Threads_running %d >= %d: skipping expensive domains", ls.last, ls.threshold)
+		} else {
+			e.event.Sendf(event.ENGINE_LOAD_SHED_END, "Threads_running %d < %d for %s: collecting all domains", ls.last, ls.threshold, ls.recover)
+			status.RemoveComponent(e.monitorId, status.ENGINE_LOAD_SHED)
+		}
+	}
+	if !ls.shedding {
+		return domains
+	}
+	collect := make([]*clutch, 0, len(domains))
+	skipped := []string{}
+	for _, cl := range domains {
+		if ls.expensive(cl.domain) {
+			skipped = append(skipped, cl.domain)
+			continue
+		}
+		collect = append(collect, cl)
+	}
+	status.Monitor(e.monitorId, status.ENGINE_LOAD_SHED, "since %s: Threads_running %d (threshold %d): %s: skipped domains: %s",
+		blip.FormatTime(ls.since), ls.last, ls.threshold, coId, strings.Join(skipped, ", "))
+	return collect
+}
+
 // Stop the engine and cleanup any metrics associated with it.
 // TODO: There is a possible race condition when this is called. Since
 // Engine.Collect is called as a go-routine, we could have an invocation
@@ -463,12 +743,13 @@ func (e *Engine) stopCollectors() {
 //
 // Follow the link in DESIGN.md to learn more about this component.
 type clutch struct {
-	c              blip.Collector
-	cleanup        func()            // from c.Prepare (optional)
-	domain         string            // c.Domain
-	cmr            time.Duration     // collector max runtime (CMR)
-	collectionChan chan<- collection // flush vals/err to
-	event          event.MonitorReceiver
+	c         blip.Collector
+	cleanup   func()                // from c.Prepare (optional)
+	domain    string                // c.Domain
+	cmr       time.Duration         // collector max runtime (CMR)
+	deliver   func(collection) bool // flush vals/err to (Engine.deliver)
+	event     event.MonitorReceiver
+	scheduler *Scheduler // release global budget after collect
 	*sync.Mutex
 
 	// When running:
@@ -535,6 +816,7 @@ func (cl *clutch) collect(m blip.Metrics, sem chan bool) {
 
 	cl.Unlock() // ___unlock___
 
+	released := false // global budget
 	defer func() {
 		if r := recover(); r != nil {
 			if !cl.bg { // foreground
@@ -543,6 +825,9 @@ func (cl *clutch) collect(m blip.Metrics, sem chan bool) {
 				default:
 				}
 			}
+			if !released {
+				cl.scheduler.release()
+			}
 			b := make([]byte, 4096)
 			n := runtime.Stack(b, false)
 			perr := fmt.Errorf("PANIC: monitor ID %s: %s: %v\n%s", cl.m.MonitorId, cl.domain, r, string(b[0:n]))
@@ -570,6 +855,8 @@ func (cl *clutch) collect(m blip.Metrics, sem chan bool) {
 	// flush metrics back to engine for reporting, the probably done
 	vals, err := cl.c.Collect(cl.ctx, cl.m.Level)
 	sem <- true
+	cl.scheduler.release()
+	released = true
 	cl.Lock()
 	if interval < cl.fence {
 		cl.Unlock()
@@ -623,9 +910,7 @@ func (cl *clutch) flush(done bool) {
 	}
 
 	// Flush metrics back to engine BEFORE resetting them below
-	select {
-	case cl.collectionChan <- c:
-	default:
+	if !cl.deliver(c) {
 		cl.event.Errorf(event.DROP_METRICS_FLUSH, "%s: dropping metrics interval %d because channel blocked", cl.domain, c.Interval)
 	}
 
@@ -633,3 +918,17 @@ func (cl *clutch) flush(done bool) {
 	cl.vals = []blip.MetricValue{}
 	cl.err = nil
 }
+
+// detectMySQL returns the MySQL flavor and version (see sqlutil.Flavor). If
+// detection fails, they are empty: unknown flavor and version are presumed
+// supported, and the collectors will fail if not. It's used by the engine and
+// the doctor so both see the same MySQL.
+func detectMySQL(ctx context.Context, db *sql.DB, monitorId string) (string, string) {
+	flavor, version, err := sqlutil.Flavor(ctx, db)
+	if err != nil {
+		blip.Debug("%s: cannot detect MySQL flavor: %s", monitorId, err)
+		return "", ""
+	}
+	blip.Debug("%s: MySQL flavor %s version %s", monitorId, flavor, version)
+	return flavor, version
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/test/mock"
+)
+
+func TestLastMetrics(t *testing.T) {
+	defer func(n int) { KeepLastMetrics = n }(KeepLastMetrics)
+	KeepLastMetrics = 3
+
+	c := NewLevelCollector(LevelCollectorArgs{
+		Config: blip.ConfigMonitor{MonitorId: "db1"},
+		DB:     mock.NewDB(),
+	})
+
+	// No metrics yet
+	if got := c.LastMetrics(""); len(got) != 0 {
+		t.Errorf("got %d metrics, expected 0", len(got))
+	}
+
+	m := func(level string, interval uint) *blip.Metrics {
+		return &blip.Metrics{
+			Level:    level,
+			Interval: interval,
+			Values: map[string][]blip.MetricValue{
+				"status.global": {{Name: "queries", Value: float64(interval), Group: map[string]string{"g": "1"}}},
+			},
+		}
+	}
+	c.keep(m("kpi", 1))
+	c.keep(m("kpi", 2))
+	c.keep(m("trx", 3))
+
+	// Ring wraps: interval 1 is dropped
+	sent := m("kpi", 4)
+	c.keep(sent)
+
+	intervals := func(metrics []*blip.Metrics) []uint {
+		got := []uint{}
+		for _, m := range metrics {
+			got = append(got, m.Interval)
+		}
+		return got
+	}
+	if diff := deep.Equal(intervals(c.LastMetrics("")), []uint{4, 3, 2}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(intervals(c.LastMetrics("kpi")), []uint{4, 2}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(intervals(c.LastMetrics("foo")), []uint{}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Metrics are copied, so a sink that modifies metrics doesn't change them
+	sent.Values["status.global"][0].Value = 100
+	sent.Values["status.global"][0].Group["g"] = "2"
+	got := c.LastMetrics("kpi")[0].Values["status.global"][0]
+	if got.Value != 4 || got.Group["g"] != "1" {
+		t.Errorf("last metrics changed by sink: %+v", got)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"hash/fnv"
 	"runtime"
 	"sync"
 	"time"
@@ -14,7 +15,9 @@ import (
 
 	"github.com/cashapp/blip"
 	"github.com/cashapp/blip/event"
+	"github.com/cashapp/blip/health"
 	"github.com/cashapp/blip/plan"
+	"github.com/cashapp/blip/sink"
 	"github.com/cashapp/blip/status"
 )
 
@@ -26,11 +29,13 @@ import (
 // looks roughly like: LCO -> Engine -> metric collectors -> MySQL.
 // In Run, the LCO checks every 1s for the highest level in the plan to collect.
 // For example, after 5s it'll collect levels with a frequency divisible by 5s.
+// Scheduled levels (schedule or window) that are due are collected in another
+// goroutine so they don't block the other levels.
 // See https://cashapp.github.io/blip/v1.0/intro/plans.
 //
 // Metrics from MySQL flow back to the LCO as blip.Metrics, which the LCO
 // passes to blip.Plugin.TransformMetrics if specified, then to all sinks
-// specified for the monitor.
+// specified for the monitor, filtered by each sink's route (see sink.Route).
 type LevelCollector interface {
 	// Run runs the collector to collect metrics; it's a blocking call.
 	Run(stopChan, doneChan chan struct{}) error
@@ -40,8 +45,22 @@ type LevelCollector interface {
 
 	// Pause pauses metrics collection until ChangePlan is called.
 	Pause()
+
+	// LastMetrics returns the last metrics sent to sinks, newest first, at the
+	// level or all levels if level is empty. It keeps the last KeepLastMetrics.
+	LastMetrics(level string) []*blip.Metrics
 }
 
+// ConditionsCheckFreq is how often the LCO checks if MySQL role or read_only
+// changed, which changes plan conditions (blip.Condition), when the plan changer
+// is not enabled. If changed, it prepares the plan again. With the plan changer,
+// conditions are evaluated on every state change.
+var ConditionsCheckFreq = 10 * time.Second
+
+// KeepLastMetrics is the number of metrics (collections) that each LCO keeps
+// in memory for LastMetrics (API GET /monitors/metrics). Zero disables.
+var KeepLastMetrics = 10
+
 var _ LevelCollector = &lco{}
 
 // lco is the implementation of LevelCollector.
@@ -49,19 +68,31 @@ type lco struct {
 	cfg              blip.ConfigMonitor
 	planLoader       *plan.Loader
 	sinks            []blip.Sink
+	sinkRoutes       []sink.Route // same order as sinks
 	transformMetrics func([]*blip.Metrics) error
+	scheduler        *Scheduler // nil = own ticker
 	// --
 	monitorId   string
 	engine      *Engine
-	emr         time.Duration        // engine max runtime = levels[0].Freq
+	emr         time.Duration        // engine max runtime = levels[0].Freq (scheduled levels: see collectScheduled)
 	metricsChan chan []*blip.Metrics // sorted ascending by Interval
 	event       event.MonitorReceiver
-
-	stateMux *sync.Mutex
-	state    string
-	plan     blip.Plan
-	levels   []plan.SortedLevel
-	paused   bool
+	health      *health.Monitor
+
+	stateMux    *sync.Mutex
+	state       string
+	plan        blip.Plan
+	levels      []plan.SortedLevel
+	paused      bool
+	next        map[string]time.Time     // next collect of scheduled levels, keyed on level
+	splay       map[string]time.Duration // splay of scheduled levels, keyed on level
+	checking    bool                     // checkConditions running
+	schedCancel context.CancelFunc       // cancels collectScheduled goroutine, nil if not running
+	schedDone   chan struct{}            // closed when collectScheduled goroutine returns
+
+	lastMux *sync.Mutex
+	last    []*blip.Metrics // ring of last KeepLastMetrics
+	lastN   int             // next index in last
 
 	changeMux            *sync.Mutex
 	changePlanCancelFunc context.CancelFunc
@@ -74,22 +105,34 @@ type LevelCollectorArgs struct {
 	DB               *sql.DB
 	PlanLoader       *plan.Loader
 	Sinks            []blip.Sink
+	SinkRoutes       []sink.Route // same order as Sinks (optional)
 	TransformMetrics func([]*blip.Metrics) error
+	Scheduler        *Scheduler // optional
 }
 
 func NewLevelCollector(args LevelCollectorArgs) *lco {
+	// Routes are optional; zero value Route matches all metrics
+	routes := make([]sink.Route, len(args.Sinks))
+	copy(routes, args.SinkRoutes)
+	engine := NewEngine(args.Config, args.DB)
+	engine.scheduler = args.Scheduler
 	return &lco{
 		cfg:              args.Config,
 		planLoader:       args.PlanLoader,
 		sinks:            args.Sinks,
+		sinkRoutes:       routes,
 		transformMetrics: args.TransformMetrics,
+		scheduler:        args.Scheduler,
 		// --
 		monitorId:   args.Config.MonitorId,
-		engine:      NewEngine(args.Config, args.DB),
+		engine:      engine,
 		stateMux:    &sync.Mutex{},
 		paused:      true,
 		changeMux:   &sync.Mutex{},
+		lastMux:     &sync.Mutex{},
+		last:        make([]*blip.Metrics, KeepLastMetrics),
 		event:       event.MonitorReceiver{MonitorId: args.Config.MonitorId},
+		health:      health.Get(args.Config.MonitorId),
 		metricsChan: make(chan []*blip.Metrics, 10),
 	}
 }
@@ -142,11 +185,20 @@ RECV:
 				}
 			}
 			for _, m := range metrics {
+				c.keep(m)
 				coId := fmt.Sprintf("%s/%s/%d", m.Plan, m.Level, m.Interval)
-				for _, sink := range c.sinks {
+				for i, sink := range c.sinks {
+					// Filter metrics for this sink (config.sinks.*.domains, etc.)
+					// before Send so filtered metrics aren't buffered by Retry
+					rm := c.sinkRoutes[i].Filter(m)
+					if rm == nil {
+						continue
+					}
 					sinkName := sink.Name()
 					status.Monitor(c.monitorId, status.LEVEL_SINKS, coId+": sending to "+sinkName)
-					err := sink.Send(context.Background(), m) // @todo ctx with timeout
+					sendStart := time.Now()
+					err := sink.Send(context.Background(), rm) // @todo ctx with timeout
+					c.health.SinkSend(sinkName, time.Since(sendStart), err)
 					if err != nil {
 						c.event.Errorf(event.SINK_SEND_ERROR, "%s :%s", sinkName, err) // log by default
 						status.Monitor(c.monitorId, "error:"+sinkName, err.Error())
@@ -159,6 +211,58 @@ RECV:
 	}
 }
 
+// keep keeps a copy of the metrics in the ring of last metrics. It's a copy
+// because sinks might modify the metrics, and the point of LastMetrics is to
+// see the metrics Blip collected before sinks.
+func (c *lco) keep(m *blip.Metrics) {
+	if len(c.last) == 0 {
+		return
+	}
+	cp := *m
+	cp.Values = make(map[string][]blip.MetricValue, len(m.Values))
+	for domain, values := range m.Values {
+		vals := make([]blip.MetricValue, len(values))
+		for i, v := range values {
+			vals[i] = v
+			vals[i].Group = copyMap(v.Group)
+			vals[i].Meta = copyMap(v.Meta)
+		}
+		cp.Values[domain] = vals
+	}
+	c.lastMux.Lock()
+	c.last[c.lastN] = &cp
+	c.lastN = (c.lastN + 1) % len(c.last)
+	c.lastMux.Unlock()
+}
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	cp := make(map[string]string, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
+
+func (c *lco) LastMetrics(level string) []*blip.Metrics {
+	c.lastMux.Lock()
+	defer c.lastMux.Unlock()
+	metrics := []*blip.Metrics{}
+	for i := 1; i <= len(c.last); i++ {
+		m := c.last[(c.lastN-i+len(c.last))%len(c.last)] // newest to oldest
+		if m == nil {
+			break // ring not full yet
+		}
+		if level != "" && m.Level != level {
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
 // keepRecvMetrics keeps a recvMetrics goroutine running. If a sink or the
 // transformMetrics plugin panic, it must be restarted to keep metrics flowing.
 func (c *lco) keepRecvMetrics(stopSinksChan chan struct{}) {
@@ -198,9 +302,19 @@ func (c *lco) Run(stopChan, doneChan chan struct{}) error {
 	tickerMux.Unlock()
 	s := -1 * te // -1 so first tick=0 and all levels collected
 	interval := uint(0)
-	ticker := time.NewTicker(td)
-	defer ticker.Stop()
-	for startTime := range ticker.C {
+
+	// Ticks from the shared Scheduler, if any, else our own ticker
+	var tickChan <-chan time.Time
+	if c.scheduler != nil {
+		var unsubscribe func()
+		tickChan, unsubscribe = c.scheduler.Subscribe(c.monitorId)
+		defer unsubscribe()
+	} else {
+		ticker := time.NewTicker(td)
+		defer ticker.Stop()
+		tickChan = ticker.C
+	}
+	for startTime := range tickChan {
 		s = s + te
 
 		// Was monitor stopped?
@@ -222,6 +336,7 @@ func (c *lco) Run(stopChan, doneChan chan struct{}) error {
 				<-c.changePlanDoneChan   // wait for changePlan goroutine
 			default:
 			}
+			c.stopScheduled()
 			c.engine.Stop() // stop all collectors and run their cleanup func
 			return nil
 		default: // no
@@ -239,33 +354,182 @@ func (c *lco) Run(stopChan, doneChan chan struct{}) error {
 		// Determine lowest level to collect
 		level := -1
 		for i := range c.levels {
+			if c.levels[i].Scheduled() {
+				break // scheduled levels are sorted last, checked below
+			}
 			if s%c.levels[i].Freq == 0 {
 				level = i
 			}
 		}
-		if level == -1 {
-			c.stateMux.Unlock() // -- Unlock
-			continue            // no metrics to collect at this frequency
-		}
 
 		// Collect metrics at this level
-		interval += 1
-		c.collect(interval, c.levels[level].Name, startTime)
+		if level > -1 {
+			interval += 1
+			c.collect(context.Background(), c.plan.Name, interval, c.levels[level].Name, startTime, startTime.Add(c.emr))
+		}
+
+		// Collect scheduled levels that are due in a goroutine because they can
+		// take much longer than the levels above, which must not wait for them.
+		// Intervals are unique, so they're set here, not in the goroutine.
+		if due := c.due(s, startTime); len(due) > 0 {
+			if c.schedCancel != nil {
+				c.event.Errorf(event.LCO_SCHEDULED_SKIPPED, "scheduled levels still running, skipping %s", levelNames(due))
+			} else {
+				intervals := make([]uint, len(due))
+				for i := range due {
+					interval += 1
+					intervals[i] = interval
+				}
+				ctx, cancel := context.WithCancel(context.Background())
+				c.schedCancel = cancel
+				c.schedDone = make(chan struct{})
+				go c.collectScheduled(ctx, c.schedDone, c.plan.Name, due, intervals)
+			}
+		}
+
+		// Without the plan changer, check if plan conditions changed
+		if s > 0 && s%ConditionsCheckFreq == 0 && !c.checking && !c.cfg.Plans.Change.Enabled() {
+			c.checking = true
+			go c.checkConditions()
+		}
 
 		c.stateMux.Unlock() // -- UNLOCK --
 	}
 	return nil
 }
 
-func (c *lco) collect(interval uint, levelName string, startTime time.Time) {
-	status.Monitor(c.monitorId, status.LEVEL_COLLECT, "%s/%s: collecting", c.plan.Name, levelName)
+// due returns the scheduled levels to collect at s (time elapsed) and now.
+// Levels with a schedule are due at their next scheduled time (plus splay).
+// Levels with only a window are due like other levels: when s is a multiple
+// of their freq. In both cases, if the level has a window, now must be in it.
+// The caller must hold stateMux.
+func (c *lco) due(s time.Duration, now time.Time) []plan.SortedLevel {
+	var levels []plan.SortedLevel
+	for _, l := range c.levels {
+		if !l.Scheduled() {
+			continue
+		}
+		if l.Schedule != nil {
+			next := c.next[l.Name]
+			if next.IsZero() || now.Before(next) {
+				continue
+			}
+			c.next[l.Name] = l.Schedule.Next(now.Add(-c.splay[l.Name])).Add(c.splay[l.Name])
+			blip.Debug("%s: level %s: next at %s", c.monitorId, l.Name, c.next[l.Name])
+		} else if s%l.Freq != 0 {
+			continue
+		}
+		if l.Window != nil && !l.Window.In(now) {
+			continue
+		}
+		levels = append(levels, l)
+	}
+	return levels
+}
+
+// collectScheduled collects the scheduled levels that are due, in order. It's
+// a goroutine run by Run (one at a time) so that scheduled levels don't block
+// other levels. Each level has its own engine max runtime (EMR): its freq (the
+// schedule period, else the level freq) minus 10% (max 1s), and no later than
+// the end of its window, if any. Pause and Run cancel ctx and wait for doneChan.
+func (c *lco) collectScheduled(ctx context.Context, doneChan chan struct{}, planName string, levels []plan.SortedLevel, intervals []uint) {
+	defer func() {
+		c.stateMux.Lock()
+		c.schedCancel()
+		c.schedCancel = nil
+		c.stateMux.Unlock()
+		close(doneChan)
+	}()
+	for i, l := range levels {
+		if ctx.Err() != nil {
+			return
+		}
+		startTime := time.Now()
+		c.collect(ctx, planName, intervals[i], l.Name, startTime, scheduledDeadline(l, startTime))
+	}
+}
+
+// scheduledDeadline returns the engine max runtime deadline for a scheduled
+// level that starts collecting at startTime: its freq minus 10% (max 1s), and
+// no later than the end of its window if startTime is in the window.
+func scheduledDeadline(l plan.SortedLevel, startTime time.Time) time.Time {
+	deadline := startTime.Add(blip.TimeLimit(0.1, l.Freq, time.Second))
+	if l.Window != nil && l.Window.In(startTime) {
+		if end := l.Window.End(startTime); end.Before(deadline) {
+			deadline = end
+		}
+	}
+	return deadline
+}
+
+// stopScheduled cancels and waits for the collectScheduled goroutine, if any.
+// The caller must not hold stateMux.
+func (c *lco) stopScheduled() {
+	c.stateMux.Lock()
+	cancel, doneChan := c.schedCancel, c.schedDone
+	c.stateMux.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-doneChan
+}
+
+func levelNames(levels []plan.SortedLevel) []string {
+	names := make([]string, len(levels))
+	for i := range levels {
+		names[i] = levels[i].Name
+	}
+	return names
+}
+
+// checkConditions prepares the current plan again if MySQL role or read_only
+// changed since the plan was prepared, so that plan conditions are evaluated
+// again. It's a goroutine run by Run (one at a time) so queries don't block Run.
+func (c *lco) checkConditions() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	changed, reason, err := c.engine.conditionsChanged(ctx)
+	cancel()
+
+	c.stateMux.Lock()
+	c.checking = false
+	state, planName := c.state, c.plan.Name
+	c.stateMux.Unlock()
+
+	if err != nil {
+		blip.Debug("%s: cannot check plan conditions: %s", c.monitorId, err)
+		return
+	}
+	if !changed {
+		return
+	}
+	c.event.Sendf(event.LCO_CONDITIONS_CHANGED, "%s: preparing plan %s again", reason, planName)
+	c.ChangePlan(state, planName)
+}
+
+// splay returns the splay for the monitor at the level: a constant duration
+// from 0 to max (whole seconds) that's different for each monitor and level.
+// It's a hash, not random, so it doesn't change when Blip restarts.
+func splay(monitorId, levelName string, max time.Duration) time.Duration {
+	if max < time.Second {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(monitorId + "/" + levelName))
+	return time.Duration(h.Sum32()%uint32(max/time.Second)) * time.Second
+}
+
+// collect collects metrics at the level and sends them to the sinks. The engine
+// max runtime (EMR) is the deadline, or when ctx is cancelled.
+func (c *lco) collect(ctx context.Context, planName string, interval uint, levelName string, startTime, deadline time.Time) {
+	status.Monitor(c.monitorId, status.LEVEL_COLLECT, "%s/%s: collecting", planName, levelName)
 	defer func() {
 		if err := recover(); err != nil { // catch panic in engine and TransformMetrics
 			b := make([]byte, 4096)
 			n := runtime.Stack(b, false)
 			c.event.Errorf(event.LCO_COLLECT_PANIC, "PANIC: %s: %s\n%s", c.monitorId, err, string(b[0:n]))
 		}
-		status.Monitor(c.monitorId, status.LEVEL_COLLECT, "%s/%s/%d: collected in %s", c.plan.Name, levelName, interval, time.Now().Sub(startTime))
+		status.Monitor(c.monitorId, status.LEVEL_COLLECT, "%s/%s/%d: collected in %s", planName, levelName, interval, time.Now().Sub(startTime))
 	}()
 
 	// **************************************************************
@@ -273,7 +537,7 @@ func (c *lco) collect(interval uint, levelName string, startTime time.Time) {
 	//
 	// Collect all metrics at this level. This is where metrics
 	// collection begins. Then Engine.Collect does the real work.
-	emrCtx, emrCancel := context.WithDeadline(context.Background(), startTime.Add(c.emr))
+	emrCtx, emrCancel := context.WithDeadline(ctx, deadline)
 	defer emrCancel()
 	metrics, err := c.engine.Collect(emrCtx, interval, levelName, startTime)
 	blip.Debug("%s: level %s: done in %s", c.monitorId, levelName, metrics[0].End.Sub(metrics[0].Begin))
@@ -283,9 +547,10 @@ func (c *lco) collect(interval uint, levelName string, startTime time.Time) {
 		c.event.Errorf(event.ENGINE_COLLECT_ERROR, err.Error())
 	} else {
 		status.RemoveComponent(c.monitorId, "error:collect")
+		c.health.Collected(levelName, time.Now())
 	}
 
-	status.Monitor(c.monitorId, status.LEVEL_COLLECT, "%s/%s: sending", c.plan.Name, levelName)
+	status.Monitor(c.monitorId, status.LEVEL_COLLECT, "%s/%s: sending", planName, levelName)
 	select {
 	case c.metricsChan <- metrics:
 	default:
@@ -424,6 +689,17 @@ func (c *lco) changePlan(ctx context.Context, doneChan chan struct{}, newState,
 		if len(levels) > 0 { // there can be 0 levels, e.g. plan/default.None
 			c.emr = blip.TimeLimit(0.1, levels[0].Freq, time.Second) // interval minus 10% (max 1s)
 		}
+		now := time.Now()
+		c.next = map[string]time.Time{}
+		c.splay = map[string]time.Duration{}
+		for _, l := range levels {
+			if l.Schedule == nil {
+				continue
+			}
+			c.splay[l.Name] = splay(c.monitorId, l.Name, l.Splay)
+			c.next[l.Name] = l.Schedule.Next(now.Add(-c.splay[l.Name])).Add(c.splay[l.Name])
+			blip.Debug("%s: level %s: next at %s (splay %s)", c.monitorId, l.Name, c.next[l.Name], c.splay[l.Name])
+		}
 
 		// Changing state/plan always resumes (if paused); in fact, it's the
 		// only way to resume after Pause is called
@@ -431,6 +707,7 @@ func (c *lco) changePlan(ctx context.Context, doneChan chan struct{}, newState,
 		status.Monitor(c.monitorId, status.LEVEL_STATE, newState)
 		status.Monitor(c.monitorId, status.LEVEL_PLAN, newPlan.Name)
 		status.Monitor(c.monitorId, status.LEVEL_COLLECTOR, "running since %s", blip.FormatTime(time.Now()))
+		c.health.PlanChanged(newState, newPlan.Name)
 		blip.Debug("%s: resume", c.monitorId)
 
 		c.stateMux.Unlock() // -- X unlock --
@@ -444,6 +721,13 @@ func (c *lco) changePlan(ctx context.Context, doneChan chan struct{}, newState,
 	// all other code relies on to try "forever" because a plan must be prepared
 	// before anything can be collected.
 	status.Monitor(c.monitorId, status.LEVEL_CHANGE_PLAN, "preparing new plan %s (state %s)", newPlan.Name, newState)
+	// Monitor state for plan conditions. Without the plan changer, the state is
+	// always active (nominal), so it's unknown and conditions query MySQL.
+	if c.cfg.Plans.Change.Enabled() {
+		c.engine.setState(newState)
+	} else {
+		c.engine.setState(blip.STATE_NONE)
+	}
 	retry := backoff.NewExponentialBackOff()
 	retry.MaxElapsedTime = 0
 	for {
@@ -471,11 +755,12 @@ func (c *lco) changePlan(ctx context.Context, doneChan chan struct{}, newState,
 
 // Pause pauses metrics collection until ChangePlan is called. Run still runs,
 // but it doesn't collect when paused. The only way to resume after pausing is
-// to call ChangePlan again.
+// to call ChangePlan again. Scheduled levels being collected are cancelled.
 func (c *lco) Pause() {
 	c.stateMux.Lock()
 	c.paused = true
 	status.Monitor(c.monitorId, status.LEVEL_COLLECTOR, "paused at %s", blip.FormatTime(time.Now()))
 	c.event.Send(event.LCO_PAUSED)
 	c.stateMux.Unlock()
+	c.stopScheduled()
 }
@@ -0,0 +1,156 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/cashapp/blip"
+)
+
+// loadShed tracks MySQL health and domain cost for adaptive load shedding
+// (config.load-shed). It's used only by the Engine, which serializes calls.
+//
+// MySQL is overloaded when Threads_running >= threshold. Threads_running is
+// read from status.global metrics if the plan collects it (see observe), else
+// it's queried. Shedding starts the
+// first time MySQL is overloaded, and it stops when MySQL has not been
+// overloaded for the recover duration. This hysteresis prevents flapping
+// when Threads_running hovers around the threshold. While shedding, expensive
+// domains are skipped: configured domains and, if cost is set, domains that
+// take at least that long to collect on average.
+type loadShed struct {
+	threshold int64
+	cost      time.Duration
+	recover   time.Duration
+	domains   map[string]bool
+
+	costs        map[string]time.Duration // average collect runtime, keyed on domain
+	shedding     bool
+	since        time.Time // when shedding started
+	healthySince time.Time // when MySQL was last not overloaded while shedding, or zero
+	last         int64     // last Threads_running
+	observed     int64     // Threads_running collected by status.global
+	observedAt   time.Time // when observed was collected, or zero
+	checked      time.Time // last call to threadsRunning
+}
+
+// newLoadShed returns a new loadShed for the config, or nil if load shedding is
+// not enabled. The config must be valid and have defaults applied.
+func newLoadShed(cfg blip.ConfigLoadShed) *loadShed {
+	if !cfg.Enabled() {
+		return nil
+	}
+	ls := &loadShed{
+		domains: map[string]bool{},
+		costs:   map[string]time.Duration{},
+	}
+	ls.threshold, _ = strconv.ParseInt(cfg.ThreadsRunning, 10, 64) // already validated
+	if cfg.Cost != "" {
+		ls.cost, _ = time.ParseDuration(cfg.Cost)
+	}
+	ls.recover, _ = time.ParseDuration(cfg.Recover)
+	for _, domain := range cfg.Domains {
+		ls.domains[domain] = true
+	}
+	return ls
+}
+
+// update updates the state given Threads_running at time now. It returns true if
+// shedding started or stopped. A negative value (unknown) doesn't change the state.
+func (ls *loadShed) update(threadsRunning int64, now time.Time) bool {
+	if threadsRunning < 0 {
+		return false
+	}
+	ls.last = threadsRunning
+	overloaded := threadsRunning >= ls.threshold
+	if !ls.shedding {
+		if overloaded {
+			ls.shedding = true
+			ls.since = now
+			ls.healthySince = time.Time{}
+			return true
+		}
+		return false
+	}
+	if overloaded {
+		ls.healthySince = time.Time{} // still overloaded, reset recovery
+		return false
+	}
+	if ls.healthySince.IsZero() {
+		ls.healthySince = now
+	}
+	if now.Sub(ls.healthySince) < ls.recover {
+		return false // recovering
+	}
+	ls.shedding = false
+	return true
+}
+
+// expensive returns true if the domain is skipped while shedding.
+func (ls *loadShed) expensive(domain string) bool {
+	if ls.domains[domain] {
+		return true
+	}
+	return ls.cost > 0 && ls.costs[domain] >= ls.cost
+}
+
+// record records the runtime of one domain collection. The cost of a domain is
+// an exponentially weighted moving average so one slow collection doesn't make
+// the domain expensive.
+func (ls *loadShed) record(domain string, runtime time.Duration) {
+	if runtime <= 0 {
+		return
+	}
+	last, ok := ls.costs[domain]
+	if !ok {
+		ls.costs[domain] = runtime
+		return
+	}
+	ls.costs[domain] = time.Duration(0.7*float64(last) + 0.3*float64(runtime))
+}
+
+// observe saves Threads_running from status.global metrics collected at ts, if
+// the metrics include it.
+func (ls *loadShed) observe(values []blip.MetricValue, ts time.Time) {
+	for _, v := range values {
+		if v.Name == "threads_running" {
+			ls.observed = int64(v.Value)
+			ls.observedAt = ts
+			return
+		}
+	}
+}
+
+// threadsRunning returns Threads_running collected by status.global since the
+// last call, which avoids an extra query, else it queries MySQL.
+func (ls *loadShed) threadsRunning(ctx context.Context, db *sql.DB, now time.Time) int64 {
+	last := ls.checked
+	ls.checked = now
+	if !ls.observedAt.IsZero() && !ls.observedAt.Before(last) {
+		return ls.observed
+	}
+	return mysqlThreadsRunning(ctx, db)
+}
+
+// mysqlThreadsRunning returns MySQL Threads_running, or -1 on error.
+func mysqlThreadsRunning(ctx context.Context, db *sql.DB) int64 {
+	n, err := globalStatus(ctx, db, "Threads_running")
+	if err != nil {
+		blip.Debug("cannot get Threads_running: %s", err)
+		return -1
+	}
+	return n
+}
+
+// globalStatus returns the value of one integer global status variable.
+func globalStatus(ctx context.Context, db *sql.DB, name string) (int64, error) {
+	var varName, val string
+	if err := db.QueryRowContext(ctx, "SHOW GLOBAL STATUS LIKE ?", name).Scan(&varName, &val); err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(val, 10, 64)
+}
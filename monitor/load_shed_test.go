@@ -0,0 +1,123 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cashapp/blip"
+)
+
+func TestLoadShedDisabled(t *testing.T) {
+	if ls := newLoadShed(blip.ConfigLoadShed{}); ls != nil {
+		t.Errorf("got loadShed, expected nil when threads-running not set")
+	}
+}
+
+func TestLoadShedUpdate(t *testing.T) {
+	cfg := blip.ConfigLoadShed{ThreadsRunning: "50"}
+	cfg.ApplyDefaults(blip.Config{})
+	ls := newLoadShed(cfg)
+	if ls == nil {
+		t.Fatal("got nil loadShed")
+	}
+	if ls.recover != time.Minute {
+		t.Errorf("recover = %s, expected default 1m", ls.recover)
+	}
+
+	t0 := time.Now()
+
+	// Not overloaded
+	if ls.update(10, t0) || ls.shedding {
+		t.Errorf("shedding when not overloaded")
+	}
+
+	// Unknown value doesn't change state
+	if ls.update(-1, t0) || ls.shedding {
+		t.Errorf("shedding on unknown value")
+	}
+
+	// Overloaded: start shedding
+	if !ls.update(50, t0) || !ls.shedding {
+		t.Errorf("not shedding when overloaded")
+	}
+
+	// Recovering, but overloaded again resets recovery
+	if ls.update(10, t0.Add(10*time.Second)) || !ls.shedding {
+		t.Errorf("stopped shedding before recover duration")
+	}
+	if ls.update(60, t0.Add(20*time.Second)) || !ls.shedding {
+		t.Errorf("stopped shedding while overloaded")
+	}
+	if ls.update(10, t0.Add(30*time.Second)) || !ls.shedding {
+		t.Errorf("stopped shedding before recover duration")
+	}
+	if ls.update(10, t0.Add(80*time.Second)) || !ls.shedding {
+		t.Errorf("stopped shedding before recover duration (reset at 30s)")
+	}
+
+	// Not overloaded for recover duration: stop shedding
+	if !ls.update(10, t0.Add(90*time.Second)) || ls.shedding {
+		t.Errorf("still shedding after recover duration")
+	}
+}
+
+func TestLoadShedExpensive(t *testing.T) {
+	cfg := blip.ConfigLoadShed{ThreadsRunning: "50", Cost: "1s"}
+	cfg.ApplyDefaults(blip.Config{})
+	ls := newLoadShed(cfg)
+
+	// Default domains are expensive
+	if !ls.expensive("size.table") {
+		t.Errorf("size.table not expensive, expected it to be by default")
+	}
+	if ls.expensive("status.global") {
+		t.Errorf("status.global expensive before any cost recorded")
+	}
+
+	// One slow collection doesn't make it expensive (moving average)
+	ls.record("status.global", 100*time.Millisecond)
+	ls.record("status.global", 2*time.Second)
+	if ls.expensive("status.global") {
+		t.Errorf("status.global expensive after one slow collection: cost %s", ls.costs["status.global"])
+	}
+
+	// Consistently slow collections do
+	for i := 0; i < 5; i++ {
+		ls.record("status.global", 2*time.Second)
+	}
+	if !ls.expensive("status.global") {
+		t.Errorf("status.global not expensive: cost %s", ls.costs["status.global"])
+	}
+}
+
+func TestLoadShedThreadsRunning(t *testing.T) {
+	cfg := blip.ConfigLoadShed{ThreadsRunning: "50"}
+	cfg.ApplyDefaults(blip.Config{})
+	ls := newLoadShed(cfg)
+
+	// Threads_running collected by status.global since the last check is used
+	// instead of querying MySQL (nil db would panic)
+	t0 := time.Now()
+	ls.observe([]blip.MetricValue{
+		{Name: "queries", Value: 100, Type: blip.CUMULATIVE_COUNTER},
+		{Name: "threads_running", Value: 60, Type: blip.GAUGE},
+	}, t0)
+	if n := ls.threadsRunning(context.Background(), nil, t0.Add(time.Second)); n != 60 {
+		t.Errorf("threadsRunning = %d, expected 60 from status.global", n)
+	}
+
+	// Metrics without threads_running don't change the observed value
+	ls.observe([]blip.MetricValue{{Name: "queries", Value: 200}}, t0.Add(2*time.Second))
+	if ls.observed != 60 || !ls.observedAt.Equal(t0) {
+		t.Errorf("observed = %d at %s, expected 60 at %s", ls.observed, ls.observedAt, t0)
+	}
+
+	// Default domains are copied, not shared
+	cfg.Domains[0] = "changed"
+	if blip.DefaultLoadShedDomains[0] == "changed" {
+		t.Errorf("config.load-shed.domains shares blip.DefaultLoadShedDomains")
+	}
+}
@@ -8,17 +8,21 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
 	"gopkg.in/yaml.v2"
 
 	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/aggregate"
 	"github.com/cashapp/blip/aws"
 	"github.com/cashapp/blip/dbconn"
 	"github.com/cashapp/blip/event"
 	"github.com/cashapp/blip/ha"
+	"github.com/cashapp/blip/health"
 	"github.com/cashapp/blip/plan"
+	"github.com/cashapp/blip/relabel"
 	"github.com/cashapp/blip/sink"
 	"github.com/cashapp/blip/status"
 )
@@ -32,7 +36,10 @@ type StartMonitorFunc func(blip.ConfigMonitor) bool
 
 var (
 	ErrMonitorNotLoaded = errors.New("monitor not loaded")
+	ErrMonitorExists    = errors.New("monitor already loaded")
 	ErrStopLoss         = errors.New("stop-loss prevents reloading")
+	ErrAPIFile          = errors.New("config.monitor-loader.api-file")
+	ErrMonitorStart     = errors.New("monitor added but not started")
 )
 
 // loadedMonitor represents one validated and loaded Monitor created by
@@ -69,6 +76,9 @@ type Loader struct {
 	doneChan     chan struct{}
 	rdsLoader    aws.RDSLoader
 	startMonitor func(blip.ConfigMonitor) bool
+	aggregator   *aggregate.Aggregator
+	scheduler    *Scheduler
+	apiMonitors  map[string]blip.ConfigMonitor // added by API; nil until loaded
 }
 
 type LoaderArgs struct {
@@ -77,6 +87,8 @@ type LoaderArgs struct {
 	Plugins    blip.Plugins
 	PlanLoader *plan.Loader
 	RDSLoader  aws.RDSLoader
+	Aggregator *aggregate.Aggregator // optional
+	Scheduler  *Scheduler            // optional
 }
 
 // NewLoader creates a new Loader singleton. It's called in Server.Boot and Server.Run.
@@ -92,6 +104,8 @@ func NewLoader(args LoaderArgs) *Loader {
 		plugin:     args.Plugins,
 		planLoader: args.PlanLoader,
 		rdsLoader:  args.RDSLoader,
+		aggregator: args.Aggregator,
+		scheduler:  args.Scheduler,
 		// --
 		stopLossPercent: stopLossPercent,
 		stopLossNumber:  stopLossNumber,
@@ -210,6 +224,12 @@ func (ml *Loader) Load(ctx context.Context) error {
 		status.Blip("monitors", "%d", len(ml.repo))
 	}()
 
+	// Monitors added by the API and saved in config.monitor-loader.api-file.
+	// They're read once (on first Load) because the API is the only writer.
+	if err := ml.loadAPIMonitors(); err != nil {
+		return err
+	}
+
 	// ----------------------------------------------------------------------
 	// Load
 
@@ -359,7 +379,7 @@ func (ml *Loader) load(ctx context.Context) (diff, error) {
 	}
 
 	// Last, local monitors auto-detected
-	if len(validConfigs) == 0 && !ml.cfg.MonitorLoader.Local.DisableAuto {
+	if len(validConfigs) == 0 && len(ml.apiMonitors) == 0 && !ml.cfg.MonitorLoader.Local.DisableAuto {
 		newConfigs, err = ml.loadLocal(ctx)
 		if err != nil {
 			return diff, err
@@ -373,6 +393,16 @@ func (ml *Loader) load(ctx context.Context) (diff, error) {
 	// Make monitors from valid configs
 
 MAKE_MONITORS:
+	// Monitors added by the API, which replace monitors with the same ID
+	// from other sources
+	apiConfigs := make([]blip.ConfigMonitor, 0, len(ml.apiMonitors))
+	for _, cfg := range ml.apiMonitors {
+		apiConfigs = append(apiConfigs, cfg)
+	}
+	if err := ml.save(apiConfigs, validConfigs); err != nil {
+		return diff, err
+	}
+
 	// Monitors that have been removed
 	for monitorId, loaded := range ml.repo {
 		if _, ok := validConfigs[monitorId]; !ok {
@@ -420,14 +450,8 @@ MAKE_MONITORS:
 // table, AWS, and locally auto-detectedd (or however config.monitor-loader is set).
 func (ml *Loader) save(newConfigs []blip.ConfigMonitor, validConfigs map[string]blip.ConfigMonitor) error {
 	for _, newcfg := range newConfigs {
-		// Initialize new configure in this order:
-		newcfg.ApplyDefaults(ml.cfg)              // 1. apply defaults to monitor values
-		newcfg.InterpolateEnvVars()               // 2. replace ${ENV_VAR} in monitor values
-		newcfg.InterpolateMonitor()               // 3. replace %{monitor.X} in monitor values
-		newcfg.MonitorId = blip.MonitorId(newcfg) // 4. set monitor ID if not explicitly set
-
-		// Validate the monitor config after it has been fully initialized
-		if err := newcfg.Validate(); err != nil {
+		newcfg, err := ml.initConfig(newcfg)
+		if err != nil {
 			return err
 		}
 
@@ -440,13 +464,36 @@ func (ml *Loader) save(newConfigs []blip.ConfigMonitor, validConfigs map[string]
 	return nil
 }
 
+// initConfig initializes and validates a new monitor config. It's called by
+// save and Add.
+func (ml *Loader) initConfig(newcfg blip.ConfigMonitor) (blip.ConfigMonitor, error) {
+	// Initialize new configure in this order:
+	newcfg.ApplyDefaults(ml.cfg)              // 1. apply defaults to monitor values
+	newcfg.InterpolateEnvVars()               // 2. replace ${ENV_VAR} in monitor values
+	newcfg.InterpolateMonitor()               // 3. replace %{monitor.X} in monitor values
+	newcfg.MonitorId = blip.MonitorId(newcfg) // 4. set monitor ID if not explicitly set
+
+	// Validate the monitor config after it has been fully initialized
+	if err := newcfg.Validate(); err != nil {
+		return newcfg, err
+	}
+	return newcfg, nil
+}
+
 // makeMonitor makes a new Monitor. Normally, there'd be a factory for this,
 // but Monitor are concrete, not abstract, so there's only one way to make them.
 // Testing mocks the abstract parts of a Monitor, like LevelCollector and PlanChanger.
 func (ml *Loader) makeMonitor(cfg blip.ConfigMonitor) (*Monitor, error) {
 	// Make sinks for this monitor. Each monitor has its own sinks.
 	sinks := []blip.Sink{}
+	routes := []sink.Route{}
 	for sinkName, opts := range cfg.Sinks {
+		// Route options (domains, levels, metrics) are common to all sinks,
+		// so remove them before passing the sink-specific options
+		route, opts, err := sink.ParseRoute(opts)
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: %s", sinkName, err)
+		}
 		sink, err := sink.Make(blip.SinkFactoryArgs{
 			SinkName:  sinkName,
 			MonitorId: cfg.MonitorId,
@@ -456,17 +503,38 @@ func (ml *Loader) makeMonitor(cfg blip.ConfigMonitor) (*Monitor, error) {
 		if err != nil {
 			return nil, err
 		}
+		sink, err = relabelSink(ml.cfg, cfg, sinkName, sink)
+		if err != nil {
+			return nil, err
+		}
 		sinks = append(sinks, sink)
+		routes = append(routes, route)
 		blip.Debug("%s sends to %s", cfg.MonitorId, sinkName)
 	}
 
 	// If no sinks, default to printing metrics to stdout
 	if len(sinks) == 0 {
 		blip.Debug("using log sink")
+		routes = append(routes, sink.Route{}) // all metrics
 		sink, _ := sink.Make(blip.SinkFactoryArgs{SinkName: sink.Default, MonitorId: cfg.MonitorId})
+		sink, err := relabelSink(ml.cfg, cfg, sink.Name(), sink)
+		if err != nil {
+			return nil, err
+		}
 		sinks = append(sinks, sink)
 	}
 
+	// If the monitor is a member of a rollup (config.aggregate), send its metrics
+	// to the aggregator, too. This is after the default sink because the
+	// aggregator doesn't report the monitor's metrics.
+	if ml.aggregator != nil {
+		if s := ml.aggregator.Sink(cfg); s != nil {
+			blip.Debug("%s sends to aggregator", cfg.MonitorId)
+			sinks = append(sinks, s)
+			routes = append(routes, sink.Route{}) // all metrics
+		}
+	}
+
 	// Configure the HA Manager for the monitor
 	var ham ha.Manager
 	ham, err := ha.Make(cfg)
@@ -479,8 +547,10 @@ func (ml *Loader) makeMonitor(cfg blip.ConfigMonitor) (*Monitor, error) {
 		DbMaker:         ml.factory.DbConn,
 		PlanLoader:      ml.planLoader,
 		Sinks:           sinks,
+		SinkRoutes:      routes,
 		HA:              ham,
 		TransformMetric: ml.plugin.TransformMetrics,
+		Scheduler:       ml.scheduler,
 	})
 	return mon, nil
 }
@@ -567,13 +637,19 @@ USERS:
 	return nil, nil
 }
 
-func (ml *Loader) testLocal(bg context.Context, moncfg blip.ConfigMonitor) error {
+func (ml *Loader) testLocal(ctx context.Context, moncfg blip.ConfigMonitor) error {
+	return ml.testConn(ctx, moncfg, 200*time.Millisecond)
+}
+
+// testConn connects to MySQL for the monitor, or returns an error if it cannot
+// connect within the timeout.
+func (ml *Loader) testConn(bg context.Context, moncfg blip.ConfigMonitor, timeout time.Duration) error {
 	db, _, err := ml.factory.DbConn.Make(moncfg)
 	if err != nil {
 		return err
 	}
 	defer db.Close()
-	ctx, cancel := context.WithTimeout(bg, 200*time.Millisecond)
+	ctx, cancel := context.WithTimeout(bg, timeout)
 	defer cancel()
 	return db.PingContext(ctx)
 }
@@ -583,7 +659,11 @@ func (ml *Loader) testLocal(bg context.Context, moncfg blip.ConfigMonitor) error
 func (ml *Loader) Monitor(monitorId string) *Monitor {
 	ml.Lock()
 	defer ml.Unlock()
-	return ml.repo[monitorId].monitor
+	m, ok := ml.repo[monitorId]
+	if !ok {
+		return nil
+	}
+	return m.monitor
 }
 
 // Monitors returns a list of all currently loaded monitors.
@@ -643,9 +723,195 @@ func (ml *Loader) Unload(monitorId string, lock bool) error {
 	}
 	delete(ml.repo, monitorId)
 	status.RemoveMonitor(monitorId)
+	health.Remove(monitorId)
+	return nil
+}
+
+// AddConnectTimeout is how long Add waits to connect to MySQL for a new monitor.
+var AddConnectTimeout = 2 * time.Second
+
+// Add loads and starts a new monitor. It's used by the API to add monitors while
+// Blip is running. The monitor config is initialized and validated like monitors
+// from other sources, and Add returns an error if it cannot connect to MySQL. If
+// replace is false, the monitor must not be loaded (else ErrMonitorExists); if
+// true, the monitor must be loaded (else ErrMonitorNotLoaded) and the new monitor
+// replaces it.
+//
+// Monitors added by the API are kept on Load (reload) and saved to
+// config.monitor-loader.api-file, if set, so they're loaded again on restart.
+// The new monitor config is saved as given (before defaults and interpolation).
+// If the file cannot be read or written, the error wraps ErrAPIFile and the
+// monitor is not added.
+//
+// On success, it returns the monitor ID. If the monitor is added but fails to
+// start, it returns the monitor ID and an error that wraps ErrMonitorStart.
+// The monitor stays loaded, like monitors from other sources that fail to start.
+//
+// Stop-loss does not apply to Add.
+func (ml *Loader) Add(ctx context.Context, newcfg blip.ConfigMonitor, replace bool) (string, error) {
+	cfg, err := ml.initConfig(newcfg)
+	if err != nil {
+		return "", err
+	}
+	monitorId := cfg.MonitorId
+	if monitorId == "" {
+		return "", fmt.Errorf("monitor id, hostname, or socket is required")
+	}
+
+	// Check before connecting to MySQL to fail fast, and again after because
+	// the loader is not locked while connecting, which can take a while
+	ml.Lock()
+	err = ml.canAdd(monitorId, replace)
+	ml.Unlock()
+	if err != nil {
+		return "", err
+	}
+	if err := ml.testConn(ctx, cfg, AddConnectTimeout); err != nil {
+		return "", fmt.Errorf("cannot connect to MySQL: %s", err)
+	}
+
+	ml.Lock()
+	defer ml.Unlock()
+	if err := ml.canAdd(monitorId, replace); err != nil {
+		return "", err
+	}
+	mon, err := ml.makeMonitor(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	// Save API monitors before changing the repo so the monitor is not
+	// added if the file cannot be written
+	newcfg.MonitorId = monitorId // same ID on reload even if hostname changes
+	apiMonitors := ml.copyAPIMonitors()
+	apiMonitors[monitorId] = newcfg
+	if err := ml.writeAPIFile(apiMonitors); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrAPIFile, err)
+	}
+	ml.apiMonitors = apiMonitors
+
+	if replace {
+		ml.Unload(monitorId, false)
+	}
+	m := &loadedMonitor{monitor: mon}
+	ml.repo[monitorId] = m
+	status.Blip("monitors", "%d", len(ml.repo))
+	if replace {
+		event.Sendf(event.MONITOR_REPLACED, "%s", monitorId)
+	} else {
+		event.Sendf(event.MONITOR_ADDED, "%s", monitorId)
+	}
+	if err := ml.start(m); err != nil {
+		return monitorId, fmt.Errorf("%w: %s", ErrMonitorStart, err)
+	}
+	return monitorId, nil
+}
+
+// canAdd returns nil if Add can add (or replace) the monitor.
+func (ml *Loader) canAdd(monitorId string, replace bool) error {
+	/* -- CALLER MUST LOCK -- */
+	if err := ml.loadAPIMonitors(); err != nil {
+		return fmt.Errorf("%w: %s", ErrAPIFile, err)
+	}
+	_, loaded := ml.repo[monitorId]
+	if loaded && !replace {
+		return ErrMonitorExists
+	}
+	if !loaded && replace {
+		return ErrMonitorNotLoaded
+	}
+	return nil
+}
+
+// Remove stops and unloads a monitor, and removes it from the monitors added
+// by the API (see Add), if it was added by the API. A monitor from another
+// source (like the config file) is loaded again on the next Load (reload).
+func (ml *Loader) Remove(monitorId string) error {
+	ml.Lock()
+	defer ml.Unlock()
+
+	if _, ok := ml.repo[monitorId]; !ok {
+		return ErrMonitorNotLoaded
+	}
+	if _, ok := ml.apiMonitors[monitorId]; ok {
+		apiMonitors := ml.copyAPIMonitors()
+		delete(apiMonitors, monitorId)
+		if err := ml.writeAPIFile(apiMonitors); err != nil {
+			return fmt.Errorf("%w: %s", ErrAPIFile, err)
+		}
+		ml.apiMonitors = apiMonitors
+	}
+	ml.Unload(monitorId, false)
+	status.Blip("monitors", "%d", len(ml.repo))
+	event.Sendf(event.MONITOR_REMOVED, "%s", monitorId)
+	return nil
+}
+
+// loadAPIMonitors reads config.monitor-loader.api-file, if set and not already
+// read. The file does not exist until the first monitor is added by the API.
+func (ml *Loader) loadAPIMonitors() error {
+	/* -- CALLER MUST LOCK -- */
+	if ml.apiMonitors != nil {
+		return nil // already loaded
+	}
+	apiMonitors := map[string]blip.ConfigMonitor{}
+	file := ml.cfg.MonitorLoader.APIFile
+	if file != "" {
+		bytes, err := os.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		var p printMonitors
+		if err := yaml.Unmarshal(bytes, &p); err != nil {
+			return fmt.Errorf("%s: invalid YAML: %s", file, err)
+		}
+		for _, cfg := range p.Monitors {
+			apiMonitors[blip.MonitorId(cfg)] = cfg
+		}
+		blip.Debug("loaded %d monitors from %s", len(apiMonitors), file)
+	}
+	ml.apiMonitors = apiMonitors
 	return nil
 }
 
+// writeAPIFile writes the monitors added by the API to config.monitor-loader.api-file,
+// if set. The file is written atomically (temp file then rename) and only readable
+// by the owner because monitor configs can have passwords.
+func (ml *Loader) writeAPIFile(apiMonitors map[string]blip.ConfigMonitor) error {
+	/* -- CALLER MUST LOCK -- */
+	file := ml.cfg.MonitorLoader.APIFile
+	if file == "" {
+		return nil // not saved
+	}
+	monitorIds := make([]string, 0, len(apiMonitors))
+	for monitorId := range apiMonitors {
+		monitorIds = append(monitorIds, monitorId)
+	}
+	sort.Strings(monitorIds)
+	p := printMonitors{Monitors: make([]blip.ConfigMonitor, len(monitorIds))}
+	for i, monitorId := range monitorIds {
+		p.Monitors[i] = apiMonitors[monitorId]
+	}
+	bytes, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, bytes, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func (ml *Loader) copyAPIMonitors() map[string]blip.ConfigMonitor {
+	/* -- CALLER MUST LOCK -- */
+	c := make(map[string]blip.ConfigMonitor, len(ml.apiMonitors)+1)
+	for k, v := range ml.apiMonitors {
+		c[k] = v
+	}
+	return c
+}
+
 // Print prints all loaded monitors in blip.ConfigMonitor YAML format.
 // It's used for --print-monitors.
 func (ml *Loader) Print() string {
@@ -665,7 +931,40 @@ func (ml *Loader) Print() string {
 	return string(bytes)
 }
 
+// Doctor runs Doctor for all loaded monitors, sorted by monitor ID.
+// It's used for --doctor.
+func (ml *Loader) Doctor(ctx context.Context) []Diagnosis {
+	ml.Lock()
+	defer ml.Unlock()
+	monitorIds := make([]string, 0, len(ml.repo))
+	for monitorId := range ml.repo {
+		monitorIds = append(monitorIds, monitorId)
+	}
+	sort.Strings(monitorIds)
+	diags := make([]Diagnosis, len(monitorIds))
+	for i, monitorId := range monitorIds {
+		diags[i] = Doctor(ctx, ml.repo[monitorId].monitor.Config(), ml.factory.DbConn, ml.planLoader)
+	}
+	return diags
+}
+
 // printMonitors is used by Print to output monitors in the correct YAML format.
 type printMonitors struct {
 	Monitors []blip.ConfigMonitor `yaml:"monitors"`
 }
+
+// relabelSink wraps the sink in a sink.Relabel if there are relabel rules for it:
+// rules for all sinks, then rules for the specific sink, global rules first (see
+// blip.ConfigMonitor.RelabelRules). Else, it returns the sink as-is.
+func relabelSink(b blip.Config, cfg blip.ConfigMonitor, sinkName string, s blip.Sink) (blip.Sink, error) {
+	rules := cfg.RelabelRules(b.Relabel, sinkName)
+	if len(rules) == 0 {
+		return s, nil
+	}
+	p, err := relabel.New(rules)
+	if err != nil {
+		return nil, fmt.Errorf("sink %s: %s", sinkName, err)
+	}
+	blip.Debug("%s relabels %s metrics: %d rules", cfg.MonitorId, sinkName, len(rules))
+	return sink.NewRelabel(s, p), nil
+}
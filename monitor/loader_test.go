@@ -4,6 +4,7 @@ package monitor_test
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -65,3 +66,89 @@ func TestLoaderLoadOne(t *testing.T) {
 	expectIds := []string{moncfg.MonitorId}
 	assert.ElementsMatch(t, gotIds, expectIds)
 }
+
+func TestLoaderAdd(t *testing.T) {
+	apiFile := filepath.Join(t.TempDir(), "api-monitors.yaml")
+	cfg := blip.DefaultConfig()
+	cfg.MonitorLoader.APIFile = apiFile
+	cfg.MonitorLoader.Local.DisableAuto = true
+
+	started := []string{}
+	newLoader := func() *monitor.Loader {
+		return monitor.NewLoader(monitor.LoaderArgs{
+			Config:    cfg,
+			Factories: blip.Factories{DbConn: mock.DbFactory{}},
+			Plugins: blip.Plugins{
+				StartMonitor: func(moncfg blip.ConfigMonitor) bool {
+					started = append(started, moncfg.MonitorId)
+					return false // don't run the monitor
+				},
+			},
+			PlanLoader: plan.NewLoader(nil),
+		})
+	}
+	loader := newLoader()
+	if err := loader.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a new monitor: it's loaded and started
+	moncfg := blip.ConfigMonitor{MonitorId: "db1", Hostname: "db1.local"}
+	monitorId, err := loader.Add(context.Background(), moncfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "db1", monitorId)
+	assert.ElementsMatch(t, []string{"db1"}, monitorIds(loader.Monitors()))
+	assert.Equal(t, []string{"db1"}, started)
+
+	// Add again is an error, but replace is ok
+	_, err = loader.Add(context.Background(), moncfg, false)
+	assert.Equal(t, monitor.ErrMonitorExists, err)
+	moncfg.Hostname = "db1-new.local"
+	if _, err := loader.Add(context.Background(), moncfg, true); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "db1-new.local", loader.Monitor("db1").Config().Hostname)
+
+	// Replace a monitor that's not loaded is an error
+	_, err = loader.Add(context.Background(), blip.ConfigMonitor{MonitorId: "db2", Hostname: "db2.local"}, true)
+	assert.Equal(t, monitor.ErrMonitorNotLoaded, err)
+
+	// Invalid config is an error
+	_, err = loader.Add(context.Background(), blip.ConfigMonitor{Hostname: "db3.local", LoadShed: blip.ConfigLoadShed{ThreadsRunning: "foo"}}, false)
+	assert.Error(t, err)
+
+	// API monitors are kept on reload, and saved to the API file so they're
+	// loaded on restart
+	if err := loader.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, []string{"db1"}, monitorIds(loader.Monitors()))
+	loader2 := newLoader()
+	if err := loader2.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, []string{"db1"}, monitorIds(loader2.Monitors()))
+	assert.Equal(t, "db1-new.local", loader2.Monitor("db1").Config().Hostname)
+
+	// Remove unloads the monitor and removes it from the API file
+	if err := loader.Remove("db1"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, loader.Monitors())
+	assert.Nil(t, loader.Monitor("db1"))
+	assert.Equal(t, monitor.ErrMonitorNotLoaded, loader.Remove("db1"))
+	loader2 = newLoader()
+	if err := loader2.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, loader2.Monitors())
+
+	// If the API file can't be written, the monitor is not added
+	cfg.MonitorLoader.APIFile = filepath.Join(t.TempDir(), "no-such-dir", "api-monitors.yaml")
+	loader3 := newLoader()
+	_, err = loader3.Add(context.Background(), moncfg, false)
+	assert.ErrorIs(t, err, monitor.ErrAPIFile)
+	assert.Empty(t, loader3.Monitors())
+}
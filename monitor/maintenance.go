@@ -0,0 +1,104 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"time"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/event"
+	"github.com/cashapp/blip/maintenance"
+	"github.com/cashapp/blip/status"
+)
+
+// MaintenanceCheckInterval is how often Loader.RunMaintenance checks started
+// monitors for an active maintenance window.
+var MaintenanceCheckInterval = 1 * time.Second
+
+// RunMaintenance checks all started monitors for an active maintenance window
+// every MaintenanceCheckInterval until stopChan is closed. It's run as one
+// goroutine by the server, not one per monitor. Maintenance is separate from
+// the monitor subsystems so it's not interrupted if they restart, and so a
+// monitor that cannot connect to MySQL (the usual case during maintenance) is
+// muted.
+func (ml *Loader) RunMaintenance(stopChan, doneChan chan struct{}) {
+	defer close(doneChan)
+	ticker := time.NewTicker(MaintenanceCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		for _, m := range ml.Monitors() {
+			m.checkMaintenance(now)
+		}
+	}
+}
+
+// checkMaintenance starts, changes, or ends maintenance for the monitor if a
+// window is active at now. It's a noop if the monitor is not started. It's
+// called by Start (to mute a monitor immediately) and RunMaintenance.
+func (m *Monitor) checkMaintenance(now time.Time) {
+	m.maintMux.Lock()
+	defer m.maintMux.Unlock()
+	if !m.maintOn {
+		return // monitor not started
+	}
+	w, active := maintenance.Active(m.monitorId, m.cfg.Tags, now)
+	switch {
+	case active && (w.Id != m.maint.Id || !w.End.Equal(m.maint.End) || w.Plan != m.maint.Plan):
+		m.startMaintenance(w) // new or changed window
+		m.maint = w
+	case !active && m.maint.Id != "":
+		m.endMaintenance(m.maint)
+		m.maint = maintenance.Window{}
+	}
+}
+
+// setMaintenance enables (on=true) or disables checkMaintenance. Start enables
+// it and checks immediately. Stop disables it and ends the current window, if any.
+func (m *Monitor) setMaintenance(on bool) {
+	m.maintMux.Lock()
+	m.maintOn = on
+	if !on && m.maint.Id != "" {
+		m.endMaintenance(m.maint)
+		m.maint = maintenance.Window{}
+	}
+	m.maintMux.Unlock()
+	if on {
+		m.checkMaintenance(time.Now())
+	}
+}
+
+// startMaintenance mutes error events and pins the window plan (or pause) until
+// the window ends.
+func (m *Monitor) startMaintenance(w maintenance.Window) {
+	event.Mute(m.monitorId, true)
+	m.health.Maintenance(true)
+	status.Monitor(m.monitorId, status.MAINTENANCE, "window %s until %s", w.Id, blip.FormatTime(w.End))
+	m.event.Sendf(event.MAINTENANCE_START, "window %s until %s: %s", w.Id, blip.FormatTime(w.End), w.Reason)
+
+	// Pause if the window plan cannot be loaded because the plan changer
+	// might flap states during maintenance
+	planName := w.Plan
+	if planName != "" {
+		if _, err := m.planLoader.Plan(m.monitorId, planName, nil); err != nil {
+			m.event.Sendf(event.MAINTENANCE_ERROR, "window %s: %s; pausing instead", w.Id, err)
+			planName = ""
+		}
+	}
+	m.pin.pinMaintenance(planName, time.Until(w.End))
+}
+
+// endMaintenance unmutes error events and unpins the window plan, which reverts
+// to the plan pinned by the API, if any, else the plan that the plan changer wants.
+func (m *Monitor) endMaintenance(w maintenance.Window) {
+	m.pin.unpinMaintenance()
+	event.Mute(m.monitorId, false)
+	m.health.Maintenance(false)
+	status.RemoveComponent(m.monitorId, status.MAINTENANCE)
+	m.event.Sendf(event.MAINTENANCE_END, "window %s", w.Id)
+}
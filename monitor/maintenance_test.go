@@ -0,0 +1,142 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/event"
+	"github.com/cashapp/blip/health"
+	"github.com/cashapp/blip/maintenance"
+	"github.com/cashapp/blip/plan"
+	"github.com/cashapp/blip/status"
+	"github.com/cashapp/blip/test/mock"
+)
+
+func TestMaintenance(t *testing.T) {
+	monitorId := "TestMaintenance"
+	defer status.RemoveMonitor(monitorId)
+	defer health.Remove(monitorId)
+	defer maintenance.RemoveAll()
+	defer event.RemoveSubscribers()
+
+	var mux sync.Mutex
+	errors := []bool{}
+	event.Subscribe(mock.EventReceiver{RecvFunc: func(e event.Event) {
+		if e.MonitorId == monitorId && e.Event == event.ENGINE_COLLECT_ERROR {
+			mux.Lock()
+			errors = append(errors, e.Error)
+			mux.Unlock()
+		}
+	}})
+
+	m := NewMonitor(MonitorArgs{
+		Config:     blip.ConfigMonitor{MonitorId: monitorId, Tags: map[string]string{"env": "staging"}},
+		PlanLoader: plan.NewLoader(nil),
+	})
+	lco := &fakeLCO{Mutex: &sync.Mutex{}}
+	m.pin.setLCO(lco)
+	m.pin.ChangePlan(blip.STATE_ACTIVE, "normal")
+	lco.Calls()
+
+	// Start enables maintenance checks
+	m.setMaintenance(true)
+	defer m.setMaintenance(false)
+
+	// Window by tag: monitor pauses (no plan), errors are muted, and
+	// maintenance is reported
+	w, _ := maintenance.Add(maintenance.Window{
+		Tags:  map[string]string{"env": "staging"},
+		Start: time.Now(),
+		End:   time.Now().Add(time.Hour),
+	})
+	m.checkMaintenance(time.Now())
+	m.event.Errorf(event.ENGINE_COLLECT_ERROR, "muted")
+	if diff := deep.Equal(lco.Calls(), []string{"pause"}); diff != nil {
+		t.Error(diff)
+	}
+	if !health.Get(monitorId).Snapshot().Maintenance {
+		t.Error("health not in maintenance")
+	}
+	if got := status.ReportMonitors(monitorId)[monitorId][status.MAINTENANCE]; got == "" {
+		t.Error("maintenance not reported in status")
+	}
+
+	// Remove window: monitor reverts to plan, errors are not muted
+	maintenance.Remove(w.Id)
+	m.checkMaintenance(time.Now())
+	m.event.Errorf(event.ENGINE_COLLECT_ERROR, "not muted")
+	if diff := deep.Equal(lco.Calls(), []string{"active normal"}); diff != nil {
+		t.Error(diff)
+	}
+	if health.Get(monitorId).Snapshot().Maintenance {
+		t.Error("health in maintenance after window removed")
+	}
+
+	mux.Lock()
+	if diff := deep.Equal(errors, []bool{false, true}); diff != nil {
+		t.Error(diff)
+	}
+	mux.Unlock()
+
+	// Stopping the monitor (setMaintenance(false)) ends maintenance, and
+	// windows are not checked until it's started again
+	maintenance.Add(maintenance.Window{
+		Monitors: []string{monitorId},
+		Start:    time.Now(),
+		End:      time.Now().Add(time.Hour),
+		Plan:     "does-not-exist",
+	})
+	m.checkMaintenance(time.Now())
+	m.setMaintenance(false)
+	m.checkMaintenance(time.Now())
+	if diff := deep.Equal(lco.Calls(), []string{"pause", "active normal"}); diff != nil {
+		t.Error(diff)
+	}
+	if health.Get(monitorId).Snapshot().Maintenance {
+		t.Error("health in maintenance after monitor stopped")
+	}
+}
+
+func TestRunMaintenance(t *testing.T) {
+	monitorId := "TestRunMaintenance"
+	defer status.RemoveMonitor(monitorId)
+	defer health.Remove(monitorId)
+	defer maintenance.RemoveAll()
+	defer func(d time.Duration) { MaintenanceCheckInterval = d }(MaintenanceCheckInterval)
+	MaintenanceCheckInterval = 10 * time.Millisecond
+
+	// One loop checks all monitors in the loader
+	m := NewMonitor(MonitorArgs{
+		Config:     blip.ConfigMonitor{MonitorId: monitorId},
+		PlanLoader: plan.NewLoader(nil),
+	})
+	m.pin.setLCO(&fakeLCO{Mutex: &sync.Mutex{}})
+	m.setMaintenance(true)
+	defer m.setMaintenance(false)
+	ml := NewLoader(LoaderArgs{Config: blip.DefaultConfig()})
+	ml.repo[monitorId] = &loadedMonitor{monitor: m, started: true}
+
+	stopChan := make(chan struct{})
+	doneChan := make(chan struct{})
+	go ml.RunMaintenance(stopChan, doneChan)
+	defer func() {
+		close(stopChan)
+		<-doneChan
+	}()
+
+	maintenance.Add(maintenance.Window{
+		Monitors: []string{monitorId},
+		Start:    time.Now(),
+		End:      time.Now().Add(time.Hour),
+	})
+	time.Sleep(50 * time.Millisecond)
+	if !health.Get(monitorId).Snapshot().Maintenance {
+		t.Error("health not in maintenance")
+	}
+}
@@ -19,9 +19,12 @@ import (
 	"github.com/cashapp/blip"
 	"github.com/cashapp/blip/event"
 	"github.com/cashapp/blip/ha"
+	"github.com/cashapp/blip/health"
 	"github.com/cashapp/blip/heartbeat"
+	"github.com/cashapp/blip/maintenance"
 	"github.com/cashapp/blip/plan"
 	"github.com/cashapp/blip/prom"
+	"github.com/cashapp/blip/sink"
 	"github.com/cashapp/blip/status"
 )
 
@@ -55,7 +58,9 @@ type Monitor struct {
 	dbMaker         blip.DbFactory
 	planLoader      *plan.Loader
 	sinks           []blip.Sink
+	sinkRoutes      []sink.Route
 	transformMetric func([]*blip.Metrics) error
+	scheduler       *Scheduler
 
 	// Core components
 	runMux  *sync.RWMutex
@@ -64,16 +69,23 @@ type Monitor struct {
 	promAPI *prom.API
 	lco     LevelCollector
 	pch     PlanChanger
+	pin     *planPin // between PCH and LCO
 	hbw     *heartbeat.Writer
 
+	// Maintenance (see maintenance.go)
+	maintMux *sync.Mutex
+	maint    maintenance.Window // current window; Id is empty if none
+	maintOn  bool               // monitor started: check for windows
+
 	// Control chans and sync
 	runLoopChan chan struct{} // Stop(): stop the monitor
 	runChan     chan struct{} // stop goroutines run by monitor
 	wg          sync.WaitGroup
 
-	event event.MonitorReceiver
-	retry *backoff.ExponentialBackOff
-	ha    ha.Manager
+	event  event.MonitorReceiver
+	health *health.Monitor
+	retry  *backoff.ExponentialBackOff
+	ha     ha.Manager
 }
 
 // MonitorArgs are required arguments to NewMonitor.
@@ -82,8 +94,10 @@ type MonitorArgs struct {
 	DbMaker         blip.DbFactory
 	PlanLoader      *plan.Loader
 	Sinks           []blip.Sink
+	SinkRoutes      []sink.Route // same order as Sinks (optional)
 	TransformMetric func([]*blip.Metrics) error
 	HA              ha.Manager
+	Scheduler       *Scheduler // optional
 }
 
 // NewMonitor creates a new Monitor with the given arguments. The caller must
@@ -99,13 +113,18 @@ func NewMonitor(args MonitorArgs) *Monitor {
 		dbMaker:         args.DbMaker,
 		planLoader:      args.PlanLoader,
 		sinks:           args.Sinks,
+		sinkRoutes:      args.SinkRoutes,
 		transformMetric: args.TransformMetric,
 		ha:              args.HA,
+		scheduler:       args.Scheduler,
 		// --
-		runMux: &sync.RWMutex{},
-		wg:     sync.WaitGroup{},
-		event:  event.MonitorReceiver{MonitorId: args.Config.MonitorId},
-		retry:  retry,
+		runMux:   &sync.RWMutex{},
+		pin:      newPlanPin(args.Config.MonitorId),
+		maintMux: &sync.Mutex{},
+		wg:       sync.WaitGroup{},
+		event:    event.MonitorReceiver{MonitorId: args.Config.MonitorId},
+		health:   health.Get(args.Config.MonitorId),
+		retry:    retry,
 	}
 }
 
@@ -124,6 +143,51 @@ func (m *Monitor) DSN() string {
 	return m.dsn
 }
 
+// LastMetrics returns the last metrics sent to sinks, newest first, at the
+// level or all levels if level is empty. It returns nil if the monitor has not
+// started. See LevelCollector.LastMetrics.
+func (m *Monitor) LastMetrics(level string) []*blip.Metrics {
+	m.runMux.RLock()
+	defer m.runMux.RUnlock()
+	if m.lco == nil {
+		return nil
+	}
+	return m.lco.LastMetrics(level)
+}
+
+// PinPlan changes to the plan and pins it until the TTL expires: the plan
+// changer (if enabled) cannot change the plan while it's pinned. When the pin
+// expires, the monitor reverts to the plan that the plan changer wants. It
+// returns an error if the monitor is not running or the plan is not loaded.
+func (m *Monitor) PinPlan(planName string, ttl time.Duration) error {
+	m.runMux.RLock()
+	defer m.runMux.RUnlock()
+	if m.lco == nil {
+		return fmt.Errorf("monitor not running")
+	}
+	if _, err := m.planLoader.Plan(m.monitorId, planName, m.db); err != nil {
+		return err
+	}
+	return m.pin.Pin(planName, ttl)
+}
+
+// UnpinPlan removes the pinned plan, if any, and reverts to the plan that the
+// plan changer wants.
+func (m *Monitor) UnpinPlan() error {
+	return m.pin.Unpin()
+}
+
+// PinnedPlan returns the pinned plan and when the pin expires, or an empty
+// string if no plan is pinned. During a maintenance window that pauses the
+// monitor, the pinned plan is "(pause)".
+func (m *Monitor) PinnedPlan() (string, time.Time) {
+	plan, until, pinned := m.pin.Pinned()
+	if pinned && plan == "" {
+		plan = "(pause)"
+	}
+	return plan, until
+}
+
 // Stop stops the monitor. It is idempotent and thread-safe.
 //
 // Start/stop monitors only through the Loader. DO NOT call Start or
@@ -136,6 +200,11 @@ func (m *Monitor) Stop() error {
 	blip.Debug("%s: Stop call", m.monitorId)
 	defer blip.Debug("%s: Stop return", m.monitorId)
 
+	if m.runLoopChan == nil { // never started
+		blip.Debug("%s: not started", m.monitorId)
+		return nil
+	}
+
 	// Stop runLoop() _first_, else it will restart run()
 	select {
 	case <-m.runLoopChan: // not running
@@ -149,6 +218,7 @@ func (m *Monitor) Stop() error {
 
 	// Stop and wait for monitor subsystems
 	m.stop(false, "Stop")
+	m.setMaintenance(false)
 
 	// Everything should be stopped now, so close db connection
 	if m.db != nil {
@@ -156,7 +226,8 @@ func (m *Monitor) Stop() error {
 	}
 
 	event.Sendf(event.MONITOR_STOPPED, m.monitorId)
-	status.Monitor(m.monitorId, status.MONITOR, "stopped at %s", blip.FormatTime(time.Now()))
+	status.MonitorState(m.monitorId, status.MONITOR, status.STATE_STOPPED, "stopped at %s", blip.FormatTime(time.Now()))
+	m.health.MonitorRunning(false)
 	return nil
 }
 
@@ -182,6 +253,7 @@ func (m *Monitor) Start() error {
 	}
 	m.runLoopChan = make(chan struct{})
 	go m.runLoop()
+	m.setMaintenance(true)
 	return nil
 }
 
@@ -215,11 +287,13 @@ func (m *Monitor) runLoop() {
 		// Blip never stops trying to send metrics.
 		m.retry.Reset()
 		status.Monitor(m.monitorId, status.MONITOR, "running since %s", blip.FormatTime(time.Now()))
+		m.health.MonitorRunning(true)
 		select {
 		case <-m.runLoopChan: // Stop called
 			return
 		case <-m.runChan: // internal failure
 			blip.Debug("%s: runChan closed; restarting", m.monitorId)
+			m.health.MonitorRunning(false)
 			time.Sleep(1 * time.Second) // between monitor restarts
 		}
 	}
@@ -268,7 +342,7 @@ func (m *Monitor) startup() error {
 			return nil // runLoop stopped (Stop called)
 		default:
 		}
-		status.Monitor(m.monitorId, status.MONITOR, "error making DB/DSN, sleep and retry: %s", err)
+		status.MonitorState(m.monitorId, status.MONITOR, status.STATE_ERROR, "error making DB/DSN, sleep and retry: %s", err)
 		time.Sleep(m.retry.NextBackOff())
 	}
 
@@ -287,7 +361,7 @@ func (m *Monitor) startup() error {
 		default:
 			return nil // // runLoop stopped (Stop called)
 		}
-		status.Monitor(m.monitorId, status.MONITOR, "error loading plans, sleep and retry: %s", err)
+		status.MonitorState(m.monitorId, status.MONITOR, status.STATE_ERROR, "error loading plans, sleep and retry: %s", err)
 		time.Sleep(m.retry.NextBackOff())
 	}
 
@@ -334,7 +408,7 @@ func (m *Monitor) startup() error {
 		promPlan, err := m.planLoader.Plan(m.monitorId, m.cfg.Exporter.Plan, nil)
 		if err != nil {
 			blip.Debug("%s: %s", m.monitorId, err.Error())
-			status.Monitor(m.monitorId, "exporter", "not running: error loading plans: %s", err)
+			status.MonitorState(m.monitorId, "exporter", status.STATE_ERROR, "not running: error loading plans: %s", err)
 			return err
 		}
 
@@ -344,7 +418,7 @@ func (m *Monitor) startup() error {
 		if len(promPlan.Levels) != 1 {
 			err := fmt.Errorf("exporter plan has %d levels, expected 1", len(promPlan.Levels))
 			blip.Debug("%s: %s", m.monitorId, err.Error())
-			status.Monitor(m.monitorId, "exporter", "not running: invalid plan: %s", err)
+			status.MonitorState(m.monitorId, "exporter", status.STATE_ERROR, "not running: invalid plan: %s", err)
 			return err
 		}
 
@@ -371,7 +445,7 @@ func (m *Monitor) startup() error {
 				return
 			}
 			blip.Debug("%s: prom api error: %s", m.monitorId, err.Error())
-			status.Monitor(m.monitorId, "exporter", "API error (restart in 1s): %s", err)
+			status.MonitorState(m.monitorId, "exporter", status.STATE_ERROR, "API error (restart in 1s): %s", err)
 		}()
 
 		if m.cfg.Exporter.Mode == blip.EXPORTER_MODE_LEGACY {
@@ -396,8 +470,11 @@ func (m *Monitor) startup() error {
 		DB:               m.db,
 		PlanLoader:       m.planLoader,
 		Sinks:            m.sinks,
+		SinkRoutes:       m.sinkRoutes,
 		TransformMetrics: m.transformMetric,
+		Scheduler:        m.scheduler,
 	})
+	m.pin.setLCO(m.lco) // PCH and monitor change plans through pin
 
 	m.wg.Add(1)
 	go func() {
@@ -424,7 +501,7 @@ func (m *Monitor) startup() error {
 			MonitorId: m.monitorId,
 			Config:    m.cfg.Plans.Change,
 			DB:        m.db,
-			LCO:       m.lco,
+			LCO:       m.pin,
 			HA:        m.ha,
 		})
 
@@ -449,7 +526,7 @@ func (m *Monitor) startup() error {
 		// Do need retry or error handling because ChangePlan tries forever,
 		// or until called again.
 		status.Monitor(m.monitorId, status.MONITOR, "starting plan %s", m.cfg.Plan)
-		m.lco.ChangePlan(blip.STATE_ACTIVE, m.cfg.Plan) // start LCO directly
+		m.pin.ChangePlan(blip.STATE_ACTIVE, m.cfg.Plan) // start LCO directly
 	}
 
 	m.event.Sendf(event.MONITOR_STARTED, m.dsn)
@@ -496,6 +573,7 @@ func (m *Monitor) setErr(err error, isPanic bool) {
 	} else {
 		status.RemoveComponent(m.monitorId, "error:"+status.MONITOR)
 	}
+	m.health.MonitorError(err)
 }
 
 func (m *Monitor) panic(r interface{}) {
@@ -128,7 +128,7 @@ func (pch *planChanger) setErr(err error) {
 // is enabled (blip.ConfigPlanChange.Enabled returns true).
 func (pch *planChanger) Run(stopChan, doneChan chan struct{}) error {
 	defer close(doneChan)
-	defer status.Monitor(pch.monitorId, status.PLAN_CHANGER, "not running")
+	defer status.MonitorState(pch.monitorId, status.PLAN_CHANGER, status.STATE_STOPPED, "not running")
 
 	status.Monitor(pch.monitorId, status.PLAN_CHANGER, "running")
 
@@ -0,0 +1,271 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/event"
+	"github.com/cashapp/blip/status"
+)
+
+// planPin pins (forces) a plan until a TTL expires. It's used by the API to
+// force a monitor onto a specific plan, like a high-frequency debug plan during
+// an incident: POST /monitors/plan. Maintenance windows also use it to change
+// the plan or pause during the window.
+//
+// planPin is a LevelCollector between the PCH (or Monitor if the PCH is not
+// enabled) and the real LCO. While a plan is pinned, calls to ChangePlan and
+// Pause are saved but not applied, so the PCH cannot change the plan. When the
+// pin expires or is removed, the last saved call is applied, which reverts to
+// the plan that the PCH wants.
+//
+// API and maintenance pins are separate layers, so a maintenance window doesn't
+// replace or remove an API pin, and vice versa. An API pin has precedence: it's
+// applied while set, then the maintenance pin (if still set) is applied again.
+//
+// The Monitor creates one planPin, so a pin is kept if monitor subsystems
+// restart. Monitor.startup calls setLCO with the new LCO on every restart.
+type planPin struct {
+	monitorId string
+	event     event.MonitorReceiver
+	// --
+	*sync.Mutex
+	lco     LevelCollector
+	pins    [nPinLayers]*pin // by precedence; nil if not pinned at layer
+	applied bool             // top pin applied to lco
+	state   string           // last state from ChangePlan
+	want    string           // last plan from ChangePlan
+	paused  bool             // last call was Pause
+}
+
+// Pin layers in order of precedence (see planPin)
+const (
+	pinAPI = iota
+	pinMaintenance
+	nPinLayers
+)
+
+// pin is one pinned plan (or pause).
+type pin struct {
+	plan  string      // pinned plan; empty = pause
+	until time.Time   // when pin expires
+	timer *time.Timer // calls expire at until
+}
+
+func (p pin) String() string {
+	if p.plan == "" {
+		return "(pause)"
+	}
+	return p.plan
+}
+
+var _ LevelCollector = &planPin{}
+
+func newPlanPin(monitorId string) *planPin {
+	return &planPin{
+		monitorId: monitorId,
+		event:     event.MonitorReceiver{MonitorId: monitorId},
+		Mutex:     &sync.Mutex{},
+	}
+}
+
+// setLCO sets the real LCO. It's called by Monitor.startup on every restart of
+// the monitor subsystems. If a plan is pinned, it's applied on the next call to
+// ChangePlan, which the PCH or Monitor does on startup.
+func (p *planPin) setLCO(lco LevelCollector) {
+	p.Lock()
+	p.lco = lco
+	p.applied = false
+	p.Unlock()
+}
+
+func (p *planPin) Run(stopChan, doneChan chan struct{}) error {
+	p.Lock()
+	lco := p.lco
+	p.Unlock()
+	return lco.Run(stopChan, doneChan)
+}
+
+func (p *planPin) ChangePlan(newState, newPlanName string) error {
+	p.Lock()
+	defer p.Unlock()
+	p.state = newState
+	p.want = newPlanName
+	p.paused = false
+	top := p.top()
+	if top == nil {
+		return p.lco.ChangePlan(newState, newPlanName)
+	}
+	blip.Debug("%s: plan %s pinned, ignoring plan change: state %s plan %s", p.monitorId, top, newState, newPlanName)
+	return p.apply()
+}
+
+func (p *planPin) Pause() {
+	p.Lock()
+	defer p.Unlock()
+	p.paused = true
+	top := p.top()
+	if top == nil {
+		p.lco.Pause()
+		return
+	}
+	blip.Debug("%s: plan %s pinned, ignoring pause", p.monitorId, top)
+	p.apply()
+}
+
+// top returns the pin with the highest precedence, or nil if not pinned.
+func (p *planPin) top() *pin {
+	/* -- CALLER MUST LOCK -- */
+	for _, pin := range p.pins {
+		if pin != nil {
+			return pin
+		}
+	}
+	return nil
+}
+
+// apply applies the top pinned plan to the LCO if not already applied.
+func (p *planPin) apply() error {
+	/* -- CALLER MUST LOCK -- */
+	top := p.top()
+	if p.applied || p.lco == nil || top == nil {
+		return nil
+	}
+	p.applied = true
+	if top.plan == "" {
+		p.lco.Pause()
+		return nil
+	}
+	state := p.state
+	if state == "" {
+		state = blip.STATE_ACTIVE
+	}
+	return p.lco.ChangePlan(state, top.plan)
+}
+
+func (p *planPin) LastMetrics(level string) []*blip.Metrics {
+	p.Lock()
+	lco := p.lco
+	p.Unlock()
+	if lco == nil {
+		return nil
+	}
+	return lco.LastMetrics(level)
+}
+
+// Pin changes to the plan and pins it until the TTL expires. If the plan is
+// empty, it pauses collection. If a plan is already pinned, the new plan and
+// TTL replace it. If the LCO is not set (monitor not running), the plan is
+// applied when it's set. The caller must validate the plan name.
+func (p *planPin) Pin(planName string, ttl time.Duration) error {
+	p.Lock()
+	defer p.Unlock()
+	return p.pin(pinAPI, planName, ttl)
+}
+
+// Unpin removes the pinned plan, if any, and reverts to the maintenance pin,
+// if any, else the last plan set by ChangePlan (or pauses if Pause was last
+// called).
+func (p *planPin) Unpin() error {
+	p.Lock()
+	defer p.Unlock()
+	return p.unpin(pinAPI, "removed")
+}
+
+// pinMaintenance is Pin for a maintenance window. An API pin has precedence.
+func (p *planPin) pinMaintenance(planName string, ttl time.Duration) error {
+	p.Lock()
+	defer p.Unlock()
+	return p.pin(pinMaintenance, planName, ttl)
+}
+
+// unpinMaintenance is Unpin for a maintenance window. It doesn't remove an API pin.
+func (p *planPin) unpinMaintenance() error {
+	p.Lock()
+	defer p.Unlock()
+	return p.unpin(pinMaintenance, "ended")
+}
+
+// Pinned returns the pinned plan with the highest precedence (empty = pause),
+// when the pin expires, and true if a plan is pinned.
+func (p *planPin) Pinned() (string, time.Time, bool) {
+	p.Lock()
+	defer p.Unlock()
+	top := p.top()
+	if top == nil {
+		return "", time.Time{}, false
+	}
+	return top.plan, top.until, true
+}
+
+func (p *planPin) pin(layer int, planName string, ttl time.Duration) error {
+	/* -- CALLER MUST LOCK -- */
+	if old := p.pins[layer]; old != nil {
+		old.timer.Stop()
+	}
+	until := time.Now().Add(ttl)
+	newPin := &pin{plan: planName, until: until}
+	newPin.timer = time.AfterFunc(ttl, func() { p.expire(layer, until) })
+	p.pins[layer] = newPin
+
+	if p.top() != newPin {
+		blip.Debug("%s: plan %s pinned until %s, but plan %s has precedence", p.monitorId, newPin, blip.FormatTime(until), p.top())
+		return nil
+	}
+	p.applied = false
+	status.Monitor(p.monitorId, status.PLAN_PIN, "%s until %s", newPin, blip.FormatTime(until))
+	p.event.Sendf(event.CHANGE_PLAN, "pin plan %s until %s", newPin, blip.FormatTime(until))
+	return p.apply()
+}
+
+// expire is called by the timer when the pin expires. It's a noop if the pin
+// was removed or replaced (different until) before the timer fired.
+func (p *planPin) expire(layer int, until time.Time) {
+	p.Lock()
+	defer p.Unlock()
+	if p.pins[layer] == nil || !p.pins[layer].until.Equal(until) {
+		return
+	}
+	p.unpin(layer, "expired")
+}
+
+func (p *planPin) unpin(layer int, why string) error {
+	/* -- CALLER MUST LOCK -- */
+	old := p.pins[layer]
+	if old == nil {
+		return nil // not pinned
+	}
+	wasTop := p.top() == old
+	old.timer.Stop()
+	p.pins[layer] = nil
+	if !wasTop {
+		return nil // pin with higher precedence still applied
+	}
+	p.applied = false
+
+	// Revert to the pin with lower precedence, if any
+	if top := p.top(); top != nil {
+		status.Monitor(p.monitorId, status.PLAN_PIN, "%s until %s", top, blip.FormatTime(top.until))
+		p.event.Sendf(event.CHANGE_PLAN, "pin plan %s %s, reverting to pin plan %s until %s", old, why, top, blip.FormatTime(top.until))
+		return p.apply()
+	}
+
+	status.RemoveComponent(p.monitorId, status.PLAN_PIN)
+	if p.lco == nil {
+		return nil // monitor not running
+	}
+	if p.paused {
+		p.event.Sendf(event.CHANGE_PLAN, "pin plan %s %s, reverting to paused", old, why)
+		p.lco.Pause()
+		return nil
+	}
+	state := p.state
+	if state == "" {
+		state = blip.STATE_ACTIVE
+	}
+	p.event.Sendf(event.CHANGE_PLAN, "pin plan %s %s, reverting to state %s plan %s", old, why, state, p.want)
+	return p.lco.ChangePlan(state, p.want)
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/status"
+)
+
+// fakeLCO records calls to ChangePlan and Pause.
+type fakeLCO struct {
+	*sync.Mutex
+	calls []string
+}
+
+func (c *fakeLCO) Run(stopChan, doneChan chan struct{}) error { return nil }
+func (c *fakeLCO) LastMetrics(string) []*blip.Metrics         { return nil }
+
+func (c *fakeLCO) ChangePlan(newState, newPlanName string) error {
+	c.Lock()
+	c.calls = append(c.calls, newState+" "+newPlanName)
+	c.Unlock()
+	return nil
+}
+
+func (c *fakeLCO) Pause() {
+	c.Lock()
+	c.calls = append(c.calls, "pause")
+	c.Unlock()
+}
+
+func (c *fakeLCO) Calls() []string {
+	c.Lock()
+	defer c.Unlock()
+	calls := c.calls
+	c.calls = nil
+	return calls
+}
+
+func TestPlanPin(t *testing.T) {
+	monitorId := "TestPlanPin"
+	defer status.RemoveMonitor(monitorId)
+
+	lco := &fakeLCO{Mutex: &sync.Mutex{}}
+	p := newPlanPin(monitorId)
+	p.setLCO(lco)
+
+	// Not pinned: plan changes pass through
+	p.ChangePlan(blip.STATE_ACTIVE, "normal")
+	if diff := deep.Equal(lco.Calls(), []string{"active normal"}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Pinned: plan changes are saved but not applied
+	if err := p.Pin("debug", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	p.ChangePlan(blip.STATE_READ_ONLY, "ro")
+	if diff := deep.Equal(lco.Calls(), []string{"active debug"}); diff != nil {
+		t.Error(diff)
+	}
+	plan, until, _ := p.Pinned()
+	if plan != "debug" || until.IsZero() {
+		t.Errorf("Pinned() = %s, %s; expected debug and expire time", plan, until)
+	}
+	if got := status.ReportMonitors(monitorId)[monitorId][status.PLAN_PIN]; got == "" {
+		t.Error("pin not reported in status")
+	}
+
+	// New LCO (monitor restart): pinned plan applied on first ChangePlan
+	p.setLCO(lco)
+	p.ChangePlan(blip.STATE_READ_ONLY, "ro")
+	p.ChangePlan(blip.STATE_READ_ONLY, "ro")
+	if diff := deep.Equal(lco.Calls(), []string{"read-only debug"}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Unpin reverts to the last plan change
+	p.Unpin()
+	if diff := deep.Equal(lco.Calls(), []string{"read-only ro"}); diff != nil {
+		t.Error(diff)
+	}
+	if plan, _, pinned := p.Pinned(); pinned {
+		t.Errorf("plan %s pinned after Unpin", plan)
+	}
+	if got := status.ReportMonitors(monitorId)[monitorId][status.PLAN_PIN]; got != "" {
+		t.Errorf("pin reported in status after Unpin: %s", got)
+	}
+
+	// Pin expires (TTL) and reverts to pause, which was saved while pinned
+	p.Pin("debug", 50*time.Millisecond)
+	p.Pause()
+	time.Sleep(200 * time.Millisecond)
+	if diff := deep.Equal(lco.Calls(), []string{"read-only debug", "pause"}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Pin pause, and pin before LCO set is applied on first ChangePlan
+	p = newPlanPin(monitorId)
+	p.Pin("", time.Minute)
+	p.setLCO(lco)
+	p.ChangePlan(blip.STATE_ACTIVE, "normal")
+	p.Unpin()
+	if diff := deep.Equal(lco.Calls(), []string{"pause", "active normal"}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Maintenance and API pins are separate layers: API pin has precedence,
+	// and ending maintenance doesn't remove the API pin
+	p = newPlanPin(monitorId)
+	p.setLCO(lco)
+	p.ChangePlan(blip.STATE_ACTIVE, "normal")
+	p.pinMaintenance("", time.Minute)
+	p.Pin("debug", time.Minute)
+	p.unpinMaintenance()
+	if plan, _, _ := p.Pinned(); plan != "debug" {
+		t.Errorf("Pinned() = %s, expected debug after maintenance ended", plan)
+	}
+	p.pinMaintenance("", time.Minute)
+	p.Unpin()
+	if _, _, pinned := p.Pinned(); !pinned {
+		t.Error("maintenance pin removed by Unpin")
+	}
+	p.unpinMaintenance()
+	if diff := deep.Equal(lco.Calls(), []string{"active normal", "pause", "active debug", "pause", "active normal"}); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/metrics"
+	"github.com/cashapp/blip/plan"
+	"github.com/cashapp/blip/test/mock"
+)
+
+func TestSplay(t *testing.T) {
+	// Splay is constant for a monitor and level, and less than max
+	s1 := splay("db1", "size", 5*time.Minute)
+	if s1 != splay("db1", "size", 5*time.Minute) {
+		t.Errorf("splay not constant")
+	}
+	if s1 < 0 || s1 >= 5*time.Minute {
+		t.Errorf("splay %s out of range [0, 5m)", s1)
+	}
+	if s1%time.Second != 0 {
+		t.Errorf("splay %s not whole seconds", s1)
+	}
+	if splay("db1", "size", 0) != 0 {
+		t.Errorf("non-zero splay when max is zero")
+	}
+
+	// Different monitors are spread out
+	seen := map[time.Duration]bool{}
+	for _, monitorId := range []string{"db1", "db2", "db3", "db4", "db5"} {
+		seen[splay(monitorId, "size", time.Hour)] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("all monitors have the same splay")
+	}
+}
+
+func TestScheduledDeadline(t *testing.T) {
+	// EMR from the level freq, not the fastest level: 1h - 1s max buffer
+	start := time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)
+	l := plan.SortedLevel{Name: "size", Freq: time.Hour}
+	if got, expect := scheduledDeadline(l, start), start.Add(time.Hour-time.Second); !got.Equal(expect) {
+		t.Errorf("deadline %s, expected %s", got, expect)
+	}
+
+	// No later than the end of the window if in the window
+	w, err := blip.ParseWindow("00:00-01:30 UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Window = w
+	if got, expect := scheduledDeadline(l, start), start.Add(30*time.Minute); !got.Equal(expect) {
+		t.Errorf("deadline %s, expected %s (window end)", got, expect)
+	}
+
+	// Outside the window (like blip --collect-once): only the level freq
+	start = time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	if got, expect := scheduledDeadline(l, start), start.Add(time.Hour-time.Second); !got.Equal(expect) {
+		t.Errorf("deadline %s, expected %s", got, expect)
+	}
+}
+
+func TestLevelCollectorDue(t *testing.T) {
+	sched, _ := blip.ParseSchedule("5 * * * *")
+	window, _ := blip.ParseWindow("02:00-04:00")
+	c := &lco{
+		monitorId: "db1",
+		levels: []plan.SortedLevel{
+			{Name: "kpi", Freq: 5 * time.Second},
+			{Name: "nightly", Freq: 10 * time.Second, Window: window},
+			{Name: "size", Freq: time.Hour, Schedule: sched},
+		},
+		next:  map[string]time.Time{},
+		splay: map[string]time.Duration{"size": 30 * time.Second},
+	}
+	t0 := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	c.next["size"] = sched.Next(t0).Add(30 * time.Second) // 03:05:30
+
+	// In window, freq multiple
+	if diff := deep.Equal(levelNames(c.due(10*time.Second, t0)), []string{"nightly"}); diff != nil {
+		t.Error(diff)
+	}
+	// In window, not freq multiple
+	if diff := deep.Equal(levelNames(c.due(5*time.Second, t0)), []string{}); diff != nil {
+		t.Error(diff)
+	}
+	// Schedule without splay is not yet due
+	if diff := deep.Equal(levelNames(c.due(5*time.Second, t0.Add(5*time.Minute))), []string{}); diff != nil {
+		t.Error(diff)
+	}
+	// Schedule with splay is due, then next is next hour
+	if diff := deep.Equal(levelNames(c.due(5*time.Second, t0.Add(5*time.Minute+30*time.Second))), []string{"size"}); diff != nil {
+		t.Error(diff)
+	}
+	if expect := time.Date(2024, 1, 1, 4, 5, 30, 0, time.UTC); !c.next["size"].Equal(expect) {
+		t.Errorf("next %s, expected %s", c.next["size"], expect)
+	}
+	// Out of window
+	if diff := deep.Equal(levelNames(c.due(10*time.Second, t0.Add(time.Hour))), []string{}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestLevelCollectorScheduledNotBlocking(t *testing.T) {
+	// A slow scheduled level must not block the other levels: while the slow
+	// collector runs, the fast level must keep collecting
+	TickerDuration(10*time.Millisecond, time.Second)
+	defer TickerDuration(time.Second, time.Second)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	collector := func(domain string, collect func(context.Context) error) mock.MetricFactory {
+		return mock.MetricFactory{
+			MakeFunc: func(string, blip.CollectorFactoryArgs) (blip.Collector, error) {
+				return mock.MetricsCollector{
+					DomainFunc: func() string { return domain },
+					CollectFunc: func(ctx context.Context, levelName string) ([]blip.MetricValue, error) {
+						return []blip.MetricValue{{Name: "n", Value: 1, Type: blip.GAUGE}}, collect(ctx)
+					},
+				}, nil
+			},
+		}
+	}
+	metrics.Register("test.fast", collector("test.fast", func(context.Context) error { return nil }))
+	defer metrics.Remove("test.fast")
+	metrics.Register("test.slow", collector("test.slow", func(ctx context.Context) error {
+		once.Do(func() { close(started) })
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	}))
+	defer metrics.Remove("test.slow")
+
+	// Window around now so the slow level is due
+	now := time.Now().UTC()
+	window := now.Add(-time.Hour).Format("15:04") + "-" + now.Add(time.Hour).Format("15:04")
+	pl := plan.NewLoader(func(blip.ConfigPlans) ([]blip.Plan, error) {
+		return []blip.Plan{{
+			Name: "test",
+			Levels: map[string]blip.Level{
+				"fast": {Name: "fast", Freq: "1s", Collect: map[string]blip.Domain{
+					"test.fast": {Name: "test.fast", Metrics: []string{"n"}},
+				}},
+				"slow": {Name: "slow", Freq: "2s", Window: window, Collect: map[string]blip.Domain{
+					"test.slow": {Name: "test.slow", Metrics: []string{"n"}},
+				}},
+			},
+		}}, nil
+	})
+	if err := pl.LoadShared(blip.ConfigPlans{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := make(chan string, 100)
+	c := NewLevelCollector(LevelCollectorArgs{
+		Config:     blip.ConfigMonitor{MonitorId: "db1"},
+		DB:         mock.NewDB(),
+		PlanLoader: pl,
+		Sinks: []blip.Sink{mock.Sink{
+			SendFunc: func(ctx context.Context, m *blip.Metrics) error {
+				select {
+				case sent <- m.Level:
+				default:
+				}
+				return nil
+			},
+		}},
+	})
+	stopChan := make(chan struct{})
+	doneChan := make(chan struct{})
+	go c.Run(stopChan, doneChan)
+	defer func() {
+		close(stopChan)
+		<-doneChan
+	}()
+	c.ChangePlan(blip.STATE_ACTIVE, "test")
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for slow level")
+	}
+	fast := 0
+	timeout := time.After(time.Second)
+	for fast < 3 {
+		select {
+		case level := <-sent:
+			if level == "slow" {
+				t.Fatal("slow level collected before it was released")
+			}
+			fast++
+		case <-timeout:
+			t.Fatalf("fast level collected %d times while slow level running, expected 3", fast)
+		}
+	}
+
+	close(release)
+	timeout = time.After(time.Second)
+	for {
+		select {
+		case level := <-sent:
+			if level == "slow" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for slow level metrics")
+		}
+	}
+}
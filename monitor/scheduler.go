@@ -0,0 +1,171 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/status"
+)
+
+// schedulerSlots is the number of slots per tick. Jitter is rounded down to
+// a whole number of slots: 100ms when ticks are 1s.
+const schedulerSlots = 10
+
+// Scheduler drives metrics collection for all monitors (config.scheduler).
+// Instead of one ticker per LevelCollector, one ticker sends ticks to every
+// LevelCollector subscribed. Ticks are aligned to whole seconds (wall clock)
+// plus jitter: each monitor is assigned a constant slot in the second based on
+// a hash of its monitor ID. Every LevelCollector still receives one tick per
+// second, and it still works the same, so the per-monitor API is unchanged.
+// Only the LevelCollector ticker is shared: the PlanChanger, heartbeat reader
+// and writer, and sink.Retry still run their own goroutines per monitor.
+//
+// The Scheduler also limits the number of domains collecting at once across
+// all monitors (max-collect), and the number per monitor (collect-parallel),
+// which is otherwise CollectParallel. The Engine calls acquire and release.
+//
+// A nil Scheduler is valid: LevelCollectors use their own ticker, and there's
+// no global limit. This is the case when config.scheduler.disable is true and
+// in tests.
+type Scheduler struct {
+	parallel    int
+	jitterSlots int
+	budget      chan struct{} // nil if no limit
+	*sync.Mutex
+	slots []map[string]chan time.Time // keyed on monitor ID
+	subs  int
+}
+
+// NewScheduler returns a new Scheduler. The config must be valid and have
+// defaults applied.
+func NewScheduler(cfg blip.ConfigScheduler) *Scheduler {
+	s := &Scheduler{
+		parallel: CollectParallel,
+		Mutex:    &sync.Mutex{},
+		slots:    make([]map[string]chan time.Time, schedulerSlots),
+	}
+	for i := range s.slots {
+		s.slots[i] = map[string]chan time.Time{}
+	}
+	if n, _ := strconv.Atoi(cfg.CollectParallel); n > 0 {
+		s.parallel = n
+	}
+	if n, _ := strconv.Atoi(cfg.MaxCollect); n > 0 {
+		s.budget = make(chan struct{}, n)
+	}
+	jitter, _ := time.ParseDuration(cfg.Jitter)
+	s.jitterSlots = int(jitter / (time.Second / schedulerSlots))
+	return s
+}
+
+// Subscribe returns a channel that receives one tick per second for the monitor,
+// and a function to unsubscribe. Like a time.Ticker, ticks are dropped if the
+// receiver is not ready.
+func (s *Scheduler) Subscribe(monitorId string) (<-chan time.Time, func()) {
+	slot := s.slot(monitorId)
+	c := make(chan time.Time, 1)
+	s.Lock()
+	if _, ok := s.slots[slot][monitorId]; !ok {
+		s.subs++
+	}
+	s.slots[slot][monitorId] = c
+	s.Unlock()
+	return c, func() {
+		s.Lock()
+		if s.slots[slot][monitorId] == c { // monitor can be re-subscribed
+			delete(s.slots[slot], monitorId)
+			s.subs--
+		}
+		s.Unlock()
+	}
+}
+
+// slot returns the slot for the monitor: 0 (no jitter) to jitterSlots-1.
+func (s *Scheduler) slot(monitorId string) int {
+	if s.jitterSlots <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(monitorId))
+	return int(h.Sum32() % uint32(s.jitterSlots))
+}
+
+// Run runs the Scheduler until stopChan is closed. It's a blocking call.
+func (s *Scheduler) Run(stopChan, doneChan chan struct{}) {
+	defer close(doneChan)
+
+	tickerMux.Lock() // make go test -race happy
+	d := tickerDuration / schedulerSlots
+	tickerMux.Unlock()
+
+	// Align first tick to the next whole slot (wall clock), which is
+	// slot 0 if tick duration is 1s
+	now := time.Now()
+	first := now.Truncate(d).Add(d)
+	select {
+	case <-time.After(first.Sub(now)):
+	case <-stopChan:
+		return
+	}
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	tick := first
+	for {
+		// Slot from wall clock (rounded because ticks are a little late) so
+		// slots stay aligned even if the ticker drops ticks
+		slot := int((tick.Sub(tick.Truncate(d*schedulerSlots))+d/2)/d) % schedulerSlots
+		s.Lock()
+		for _, c := range s.slots[slot] {
+			select {
+			case c <- tick:
+			default: // LCO busy; drop tick like a time.Ticker
+			}
+		}
+		if slot == 0 {
+			status.Blip(status.SCHEDULER, "%d monitors, %d collecting", s.subs, len(s.budget))
+		}
+		s.Unlock()
+
+		select {
+		case tick = <-ticker.C:
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+// acquire acquires one slot in the global budget (max-collect). It returns false
+// if ctx is done first. It always returns true if there's no global budget.
+func (s *Scheduler) acquire(ctx context.Context) bool {
+	if s == nil || s.budget == nil {
+		return true
+	}
+	select {
+	case s.budget <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release releases one slot acquired by acquire.
+func (s *Scheduler) release() {
+	if s == nil || s.budget == nil {
+		return
+	}
+	<-s.budget
+}
+
+// collectParallel returns the number of domains a monitor collects in parallel.
+func (s *Scheduler) collectParallel() int {
+	if s == nil {
+		return CollectParallel
+	}
+	return s.parallel
+}
@@ -0,0 +1,268 @@
+// Copyright 2024 Block, Inc.
+
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/metrics"
+	"github.com/cashapp/blip/plan"
+	"github.com/cashapp/blip/test/mock"
+)
+
+func TestSchedulerSubscribe(t *testing.T) {
+	s := NewScheduler(blip.ConfigScheduler{Jitter: "1s"})
+	if s.jitterSlots != schedulerSlots {
+		t.Errorf("jitterSlots = %d, expected %d", s.jitterSlots, schedulerSlots)
+	}
+
+	// Monitors are spread across slots, and a monitor is always in the same slot
+	seen := map[int]bool{}
+	for i := 0; i < 100; i++ {
+		monitorId := fmt.Sprintf("db%d", i)
+		slot := s.slot(monitorId)
+		if slot != s.slot(monitorId) {
+			t.Fatalf("%s slot changed", monitorId)
+		}
+		seen[slot] = true
+	}
+	if len(seen) < schedulerSlots/2 {
+		t.Errorf("100 monitors in %d slots, expected them spread across more slots", len(seen))
+	}
+
+	// Without jitter, all monitors in slot 0
+	s = NewScheduler(blip.ConfigScheduler{Jitter: "0s"})
+	if slot := s.slot("db1"); slot != 0 {
+		t.Errorf("slot %d, expected 0 without jitter", slot)
+	}
+
+	// Subscribe twice (monitor restarted), unsubscribe both
+	_, unsub1 := s.Subscribe("db1")
+	_, unsub2 := s.Subscribe("db1")
+	if s.subs != 1 {
+		t.Errorf("%d subs, expected 1", s.subs)
+	}
+	unsub1() // old subscription, doesn't remove the new one
+	if s.subs != 1 {
+		t.Errorf("%d subs, expected 1 after old unsubscribe", s.subs)
+	}
+	unsub2()
+	if s.subs != 0 {
+		t.Errorf("%d subs, expected 0", s.subs)
+	}
+}
+
+func TestSchedulerBudget(t *testing.T) {
+	// nil Scheduler is valid: no limit
+	var s *Scheduler
+	if !s.acquire(context.Background()) {
+		t.Error("nil Scheduler acquire returned false")
+	}
+	s.release()
+	if s.collectParallel() != CollectParallel {
+		t.Errorf("nil Scheduler collectParallel = %d, expected %d", s.collectParallel(), CollectParallel)
+	}
+
+	s = NewScheduler(blip.ConfigScheduler{MaxCollect: "2", CollectParallel: "4"})
+	if s.collectParallel() != 4 {
+		t.Errorf("collectParallel = %d, expected 4", s.collectParallel())
+	}
+	if !s.acquire(context.Background()) || !s.acquire(context.Background()) {
+		t.Fatal("acquire returned false with budget available")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if s.acquire(ctx) {
+		t.Error("acquire returned true with no budget available")
+	}
+	s.release()
+	if !s.acquire(context.Background()) {
+		t.Error("acquire returned false after release")
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	TickerDuration(100*time.Millisecond, time.Second)
+	defer TickerDuration(time.Second, time.Second)
+
+	s := NewScheduler(blip.ConfigScheduler{Jitter: "1s"})
+	tickChan1, unsub1 := s.Subscribe("db1")
+	defer unsub1()
+	tickChan2, unsub2 := s.Subscribe("db2")
+	defer unsub2()
+
+	stopChan := make(chan struct{})
+	doneChan := make(chan struct{})
+	go s.Run(stopChan, doneChan)
+	defer func() {
+		close(stopChan)
+		<-doneChan
+	}()
+
+	// Every monitor receives one tick per tick duration, offset by its slot
+	d := 100 * time.Millisecond / schedulerSlots
+	for _, tc := range []struct {
+		monitorId string
+		c         <-chan time.Time
+	}{{"db1", tickChan1}, {"db2", tickChan2}} {
+		var last time.Time
+		for i := 0; i < 3; i++ {
+			select {
+			case tick := <-tc.c:
+				offset := tick.Sub(tick.Truncate(100 * time.Millisecond))
+				slot := int((offset+d/2)/d) % schedulerSlots
+				if slot != s.slot(tc.monitorId) {
+					t.Errorf("%s tick in slot %d, expected slot %d", tc.monitorId, slot, s.slot(tc.monitorId))
+				}
+				if !last.IsZero() && tick.Sub(last) < 50*time.Millisecond {
+					t.Errorf("%s ticks %s apart, expected about 100ms", tc.monitorId, tick.Sub(last))
+				}
+				last = tick
+			case <-time.After(time.Second):
+				t.Fatalf("%s: timeout waiting for tick", tc.monitorId)
+			}
+		}
+	}
+}
+
+// BenchmarkScheduler runs 5,000 monitors in one process: full Monitors with
+// a mock DB, a plan with two levels and three mock collectors, and delta
+// counters. One op is one collection (tick) by every monitor, and ticks are
+// 10x faster than normal (100ms = 1s). It fails if monitors don't collect
+// every level, or if they would fall behind normal ticks. Run with:
+//
+//	go test -run XXX -bench Scheduler -benchmem ./monitor/
+func BenchmarkScheduler(b *testing.B) {
+	const nMonitors = 5000
+	const tick = 100 * time.Millisecond
+
+	TickerDuration(tick, time.Second)
+	defer TickerDuration(time.Second, time.Second)
+
+	for _, domain := range []string{"bench.status", "bench.trx", "bench.size"} {
+		domain := domain
+		metrics.Register(domain, mock.MetricFactory{
+			MakeFunc: func(string, blip.CollectorFactoryArgs) (blip.Collector, error) {
+				return mock.MetricsCollector{
+					DomainFunc: func() string { return domain },
+					CollectFunc: func(ctx context.Context, levelName string) ([]blip.MetricValue, error) {
+						return []blip.MetricValue{
+							{Name: "queries", Value: float64(time.Now().Unix()), Type: blip.CUMULATIVE_COUNTER},
+							{Name: "threads", Value: 1, Type: blip.GAUGE},
+						}, nil
+					},
+				}, nil
+			},
+		})
+		defer metrics.Remove(domain)
+	}
+
+	pl := plan.NewLoader(func(blip.ConfigPlans) ([]blip.Plan, error) {
+		return []blip.Plan{{
+			Name: "bench",
+			Levels: map[string]blip.Level{
+				"kpi": {Name: "kpi", Freq: "1s", Counters: blip.COUNTERS_DELTA, Collect: map[string]blip.Domain{
+					"bench.status": {Name: "bench.status", Metrics: []string{"queries", "threads"}},
+				}},
+				"trx": {Name: "trx", Freq: "5s", Collect: map[string]blip.Domain{
+					"bench.trx":  {Name: "bench.trx", Metrics: []string{"queries", "threads"}},
+					"bench.size": {Name: "bench.size", Metrics: []string{"queries", "threads"}},
+				}},
+			},
+		}}, nil
+	})
+	if err := pl.LoadShared(blip.ConfigPlans{}, nil); err != nil {
+		b.Fatal(err)
+	}
+
+	s := NewScheduler(blip.ConfigScheduler{Jitter: "1s", MaxCollect: "500", CollectParallel: "2"})
+	schedStopChan := make(chan struct{})
+	go s.Run(schedStopChan, make(chan struct{}))
+	defer close(schedStopChan)
+
+	// Each monitor has its own sink that counts collections and records the
+	// levels collected (bit 1 = kpi, bit 2 = trx)
+	var collected int64
+	levels := make([]int32, nMonitors)
+	goroutines := runtime.NumGoroutine()
+	monitors := make([]*Monitor, nMonitors)
+	for i := 0; i < nMonitors; i++ {
+		i := i
+		sink := mock.Sink{
+			SendFunc: func(ctx context.Context, m *blip.Metrics) error {
+				atomic.AddInt64(&collected, 1)
+				bit := int32(1)
+				if m.Level == "trx" {
+					bit = 2
+				}
+				for {
+					old := atomic.LoadInt32(&levels[i])
+					if old&bit != 0 || atomic.CompareAndSwapInt32(&levels[i], old, old|bit) {
+						break
+					}
+				}
+				return nil
+			},
+		}
+		monitors[i] = NewMonitor(MonitorArgs{
+			Config:     blip.ConfigMonitor{MonitorId: fmt.Sprintf("db%d", i), Plan: "bench"},
+			DbMaker:    mock.DbFactory{},
+			PlanLoader: pl,
+			Sinks:      []blip.Sink{sink},
+			Scheduler:  s,
+		})
+		if err := monitors[i].Start(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	defer func() {
+		var wg sync.WaitGroup
+		for _, m := range monitors {
+			wg.Add(1)
+			go func(m *Monitor) {
+				defer wg.Done()
+				m.Stop()
+			}(m)
+		}
+		wg.Wait()
+	}()
+
+	// Wait for all monitors to collect both levels: trx every 5 ticks
+	timeout := time.After(30 * time.Second)
+	for n := 0; n < nMonitors; {
+		select {
+		case <-timeout:
+			b.Fatalf("%d of %d monitors collected both levels, expected all", n, nMonitors)
+		case <-time.After(10 * time.Millisecond):
+		}
+		for n < nMonitors && atomic.LoadInt32(&levels[n]) == 3 {
+			n++
+		}
+	}
+	perMonitor := float64(runtime.NumGoroutine()-goroutines) / nMonitors
+
+	b.ResetTimer()
+	start := atomic.LoadInt64(&collected)
+	t0 := time.Now()
+	for atomic.LoadInt64(&collected)-start < int64(b.N*nMonitors) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	elapsed := time.Since(t0)
+	b.StopTimer()
+
+	// Every monitor collects once per tick, so one op should take one tick.
+	// Ticks are 10x faster than normal, so a slow machine might fall behind,
+	// but one op must take less than a normal tick (1s), else monitors would
+	// fall behind when running normally.
+	if perOp := elapsed / time.Duration(b.N); perOp >= time.Second {
+		b.Errorf("%s per op, expected less than 1s: monitors fell behind", perOp)
+	}
+	b.ReportMetric(perMonitor, "goroutines/monitor")
+}
@@ -5,6 +5,7 @@ package blip
 import (
 	"fmt"
 	"regexp"
+	"strings"
 	"time"
 )
 
@@ -36,6 +37,15 @@ type Plan struct {
 
 	// Source of plan: file name, table name, "plugin", or "blip" (internal plans).
 	Source string `yaml:"-"`
+
+	// Extends is the optional name of a base plan that this plan extends.
+	// The plan loader resolves the base plan into this plan before validating
+	// it, so Levels is the fully resolved plan after loading. See plan.Resolve.
+	Extends string `yaml:"-"`
+
+	// Remove is an optional list of base plan levels ("level") or domains
+	// ("level/domain") to remove when resolving Extends.
+	Remove []string `yaml:"-"`
 }
 
 // Level is one collection frequency in a plan.
@@ -43,14 +53,121 @@ type Level struct {
 	Name    string            `yaml:"-"`
 	Freq    string            `yaml:"freq"`
 	Collect map[string]Domain `yaml:"collect"`
+
+	// Counters is how the engine reports CUMULATIVE_COUNTER metrics at this
+	// level: COUNTERS_CUMULATIVE (default, as collected), COUNTERS_DELTA, or
+	// COUNTERS_RATE (per second). See monitor.Engine.
+	Counters string `yaml:"counters,omitempty"`
+
+	// When is an optional condition to collect the level. It applies to every
+	// domain in the level; see Domain.When.
+	When *Condition `yaml:"when,omitempty"`
+
+	// Schedule is an optional cron expression to collect the level instead of
+	// Freq, like "5 * * * *" (every hour at :05). See Schedule.
+	Schedule string `yaml:"schedule,omitempty"`
+
+	// Window is an optional daily time window to collect the level, like
+	// "02:00-04:00 UTC". See Window.
+	Window string `yaml:"window,omitempty"`
+
+	// Splay is the optional maximum delay after Schedule. Each monitor delays
+	// by a different but constant duration up to Splay, so monitors don't all
+	// collect at the same time.
+	Splay string `yaml:"splay,omitempty"`
 }
 
+// Scheduled returns true if the level has a schedule or window. Scheduled levels
+// are collected independently: they don't include domains from other levels,
+// and other levels don't include their domains. See plan.Sort.
+func (l Level) Scheduled() bool {
+	return l.Schedule != "" || l.Window != ""
+}
+
+const (
+	COUNTERS_CUMULATIVE = "cumulative"
+	COUNTERS_DELTA      = "delta"
+	COUNTERS_RATE       = "rate"
+)
+
 // Domain is one metric domain for collecting related metrics.
 type Domain struct {
 	Name    string            `yaml:"-"`
 	Metrics []string          `yaml:"metrics,omitempty"`
 	Options map[string]string `yaml:"options,omitempty"`
 	Errors  map[string]string `yaml:"errors,omitempty"`
+
+	// When is an optional condition to collect the domain. The engine evaluates
+	// it when preparing the plan, which happens on every monitor state change.
+	// If the domain is in a level with a condition, the domain condition fields
+	// override the level condition fields.
+	When *Condition `yaml:"when,omitempty"`
+}
+
+// Condition is when to collect a level or domain. All conditions that are set
+// must be true. For lists, any value matches.
+type Condition struct {
+	Role     string   `yaml:"role,omitempty"`     // CONDITION_ROLE_SOURCE or CONDITION_ROLE_REPLICA
+	State    []string `yaml:"state,omitempty"`    // monitor state (STATE_ACTIVE, etc.)
+	Writable *bool    `yaml:"writable,omitempty"` // true if read_only=0, false if read_only=1
+	Table    string   `yaml:"table,omitempty"`    // db.table exists
+	Flavor   []string `yaml:"flavor,omitempty"`   // MySQL flavor (FLAVOR_MYSQL, etc.)
+}
+
+const (
+	CONDITION_ROLE_SOURCE  = "source"  // not a replica
+	CONDITION_ROLE_REPLICA = "replica" // SHOW REPLICA STATUS returns a row
+)
+
+func (c Condition) Validate() error {
+	switch c.Role {
+	case "", CONDITION_ROLE_SOURCE, CONDITION_ROLE_REPLICA:
+	default:
+		return fmt.Errorf("invalid role: %s (valid values: %s, %s)", c.Role, CONDITION_ROLE_SOURCE, CONDITION_ROLE_REPLICA)
+	}
+	for _, state := range c.State {
+		switch state {
+		case STATE_ACTIVE, STATE_READ_ONLY, STATE_STANDBY:
+		default:
+			return fmt.Errorf("invalid state: %s (valid values: %s, %s, %s)", state, STATE_ACTIVE, STATE_READ_ONLY, STATE_STANDBY)
+		}
+	}
+	if c.Table != "" {
+		db, tbl, ok := strings.Cut(c.Table, ".")
+		if !ok || db == "" || tbl == "" {
+			return fmt.Errorf("invalid table: %s (must be db.table)", c.Table)
+		}
+	}
+	for _, flavor := range c.Flavor {
+		switch flavor {
+		case FLAVOR_MYSQL, FLAVOR_PERCONA, FLAVOR_MARIADB, FLAVOR_AURORA, FLAVOR_RDS:
+		default:
+			return fmt.Errorf("invalid flavor: %s (valid values: %s, %s, %s, %s, %s)",
+				flavor, FLAVOR_MYSQL, FLAVOR_PERCONA, FLAVOR_MARIADB, FLAVOR_AURORA, FLAVOR_RDS)
+		}
+	}
+	return nil
+}
+
+// Override returns a copy of the condition with fields set in o overriding
+// fields in c. It's used to apply a level condition to its domains.
+func (c Condition) Override(o Condition) Condition {
+	if o.Role != "" {
+		c.Role = o.Role
+	}
+	if len(o.State) > 0 {
+		c.State = o.State
+	}
+	if o.Writable != nil {
+		c.Writable = o.Writable
+	}
+	if o.Table != "" {
+		c.Table = o.Table
+	}
+	if len(o.Flavor) > 0 {
+		c.Flavor = o.Flavor
+	}
+	return c
 }
 
 const metricPattern = `^[a-zA-Z0-9_-]*$`
@@ -62,22 +179,74 @@ func (p Plan) Validate() error {
 
 	for levelName := range p.Levels {
 
-		// Validate freq: set, valid, and no duplicates
-		freq := p.Levels[levelName].Freq
-		if freq == "" {
+		// Validate schedule, window, and splay. A level has freq or schedule,
+		// not both.
+		level := p.Levels[levelName]
+		if level.Schedule != "" {
+			if level.Freq != "" {
+				return fmt.Errorf("at %s: freq and schedule are mutually exclusive", levelName)
+			}
+			sched, err := ParseSchedule(level.Schedule)
+			if err != nil {
+				return fmt.Errorf("at %s: invalid schedule: %s: %s", levelName, level.Schedule, err)
+			}
+			if sched.Next(time.Now()).IsZero() {
+				return fmt.Errorf("at %s: invalid schedule: %s: never scheduled", levelName, level.Schedule)
+			}
+		}
+		if level.Window != "" {
+			if _, err := ParseWindow(level.Window); err != nil {
+				return fmt.Errorf("at %s: invalid window: %s", levelName, err)
+			}
+		}
+		if level.Splay != "" {
+			if level.Schedule == "" {
+				return fmt.Errorf("at %s: splay requires schedule", levelName)
+			}
+			if _, err := time.ParseDuration(level.Splay); err != nil {
+				return fmt.Errorf("at %s: invalid splay: %s: %s", levelName, level.Splay, err)
+			}
+		}
+
+		// Validate freq: set, valid, and no duplicates. Scheduled levels can
+		// have the same freq because they're not merged with other levels.
+		freq := level.Freq
+		if freq == "" && level.Schedule == "" {
 			return fmt.Errorf("at %s: freq not set (Go time duration string required)", levelName)
 		}
-		d, err := time.ParseDuration(freq)
-		if err != nil {
-			return fmt.Errorf("at %s: invalid freq: %s: %s", levelName, freq, err)
+		if freq != "" {
+			d, err := time.ParseDuration(freq)
+			if err != nil {
+				return fmt.Errorf("at %s: invalid freq: %s: %s", levelName, freq, err)
+			}
+			if !level.Scheduled() {
+				if firstLevelName, ok := freqs[d]; ok {
+					return fmt.Errorf("at %s: duplicate freq: %s (%s): first seen at %s", levelName, freq, d, firstLevelName)
+				}
+				freqs[d] = levelName
+			}
 		}
-		if firstLevelName, ok := freqs[d]; ok {
-			return fmt.Errorf("at %s: duplicate freq: %s (%s): first seen at %s", levelName, freq, d, firstLevelName)
+
+		switch p.Levels[levelName].Counters {
+		case "", COUNTERS_CUMULATIVE, COUNTERS_DELTA, COUNTERS_RATE:
+		default:
+			return fmt.Errorf("at %s: invalid counters: %s (valid values: %s, %s, %s)",
+				levelName, p.Levels[levelName].Counters, COUNTERS_CUMULATIVE, COUNTERS_DELTA, COUNTERS_RATE)
+		}
+
+		if when := p.Levels[levelName].When; when != nil {
+			if err := when.Validate(); err != nil {
+				return fmt.Errorf("at %s: when: %s", levelName, err)
+			}
 		}
-		freqs[d] = levelName
 
 		// Validate that every metric matches metricPattern (help prevent SQL injection)
 		for domainName := range p.Levels[levelName].Collect {
+			if when := p.Levels[levelName].Collect[domainName].When; when != nil {
+				if err := when.Validate(); err != nil {
+					return fmt.Errorf("at %s/%s: when: %s", levelName, domainName, err)
+				}
+			}
 			for _, metricName := range p.Levels[levelName].Collect[domainName].Metrics {
 				if !validMetricRegex.MatchString(metricName) {
 					return fmt.Errorf("at %s/%s: invalid metric: %s (does not match /%s/)",
@@ -94,7 +263,7 @@ func (p Plan) Freq() (time.Duration, map[string]time.Duration) {
 	var min time.Duration
 	domain := map[string]time.Duration{}
 	for _, level := range p.Levels {
-		freqL, _ := time.ParseDuration(level.Freq) // already validated
+		freqL := level.freq()
 		if freqL < min || min == 0 {
 			min = freqL
 		}
@@ -110,6 +279,19 @@ func (p Plan) Freq() (time.Duration, map[string]time.Duration) {
 	return min, domain
 }
 
+// freq returns the level freq, or the schedule period if the level has a schedule.
+func (l Level) freq() time.Duration {
+	if l.Schedule != "" {
+		s, err := ParseSchedule(l.Schedule)
+		if err != nil {
+			return 0
+		}
+		return s.Period()
+	}
+	d, _ := time.ParseDuration(l.Freq) // already validated
+	return d
+}
+
 func (p *Plan) InterpolateEnvVars() {
 	for levelName := range p.Levels {
 		for domainName := range p.Levels[levelName].Collect {
@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
@@ -17,7 +16,6 @@ import (
 
 	"github.com/cashapp/blip"
 	"github.com/cashapp/blip/event"
-	"github.com/cashapp/blip/metrics"
 	default_plan "github.com/cashapp/blip/plan/default"
 	"github.com/cashapp/blip/sqlutil"
 )
@@ -69,7 +67,10 @@ func (pl *Loader) LoadShared(cfg blip.ConfigPlans, dbMaker blip.DbFactory) error
 		if len(plans) == 0 {
 			return fmt.Errorf("LoadPlans plugin returned zero plans, expected at least one in strict mode")
 		}
-		if err := ValidatePlans(plans); err != nil {
+		if err := Resolve(plans, nil); err != nil {
+			return err
+		}
+		if err := ValidatePlans(plans, cfg.Strict()); err != nil {
 			return err
 		}
 
@@ -106,16 +107,14 @@ func (pl *Loader) LoadShared(cfg blip.ConfigPlans, dbMaker blip.DbFactory) error
 		}
 		defer db.Close()
 
-		// Last arg "" = no monitorId, read all rows
+		// Last arg "" = no monitorId, read all rows. Plans are resolved and
+		// validated below, after reading files, because a table plan can
+		// extend a file plan.
 		plans, err := ReadTable(cfg.Table, db, "")
 		if err != nil {
 			return err
 		}
 
-		if err := ValidatePlans(plans); err != nil {
-			return err
-		}
-
 		// Save all plans from table by name
 		for _, plan := range plans {
 			sharedPlans = append(sharedPlans, Meta{
@@ -136,12 +135,17 @@ func (pl *Loader) LoadShared(cfg blip.ConfigPlans, dbMaker blip.DbFactory) error
 			return err
 		}
 
-		// Save all plans from table by name
+		// Save all plans from files by name
 		for _, pm := range plans {
 			sharedPlans = append(sharedPlans, pm)
 		}
 	}
 
+	// Resolve plan inheritance (Plan.Extends), then validate the resolved plans
+	if err := resolveMeta(sharedPlans, nil, cfg.Strict()); err != nil {
+		return err
+	}
+
 	// Load default plans if no shared plans are specified and default plans
 	// aren't disabled. This copies the default into the shared plans repo.
 	if len(sharedPlans) == 0 && !cfg.DisableDefaultPlans {
@@ -196,10 +200,6 @@ func (pl *Loader) LoadMonitor(mon blip.ConfigMonitor, dbMaker blip.DbFactory) er
 			return nil
 		}
 
-		if err := ValidatePlans(plans); err != nil {
-			return err
-		}
-
 		for _, plan := range plans {
 			monitorPlans = append(monitorPlans, Meta{
 				Name:   plan.Name,
@@ -221,6 +221,15 @@ func (pl *Loader) LoadMonitor(mon blip.ConfigMonitor, dbMaker blip.DbFactory) er
 		}
 	}
 
+	// Resolve plan inheritance (Plan.Extends), then validate the resolved plans.
+	// Monitor plans can extend shared plans.
+	pl.RLock()
+	err := resolveMeta(monitorPlans, pl.sharedPlans, mon.Plans.Strict())
+	pl.RUnlock()
+	if err != nil {
+		return err
+	}
+
 	pl.Lock()
 	pl.monitorPlans[mon.MonitorId] = monitorPlans
 	pl.Unlock()
@@ -333,8 +342,13 @@ func (pl *Loader) Print() {
 	var bytes []byte
 
 	for i := range pl.sharedPlans {
+		// Plans are resolved on load, so this prints the fully resolved plan
 		bytes, _ = yaml.Marshal(pl.sharedPlans[i].plan.Levels)
-		fmt.Printf("---\n# %s\n%s\n\n", pl.sharedPlans[i].plan.Name, string(bytes))
+		if pl.sharedPlans[i].plan.Extends != "" {
+			fmt.Printf("---\n# %s (extends %s)\n%s\n\n", pl.sharedPlans[i].plan.Name, pl.sharedPlans[i].plan.Extends, string(bytes))
+		} else {
+			fmt.Printf("---\n# %s\n%s\n\n", pl.sharedPlans[i].plan.Name, string(bytes))
+		}
 	}
 	/*
 		if len(pl.monitorPlans) > 0 {
@@ -347,8 +361,7 @@ func (pl *Loader) Print() {
 }
 
 func (pl *Loader) readPlans(filePaths []string) ([]Meta, error) {
-	meta := []Meta{}       // return value
-	plans := []blip.Plan{} // ValidatePlans()
+	meta := []Meta{} // return value; resolved and validated by caller
 
 	for _, filePattern := range filePaths {
 		files, err := filepath.Glob(filePattern)
@@ -391,15 +404,10 @@ func (pl *Loader) readPlans(filePaths []string) ([]Meta, error) {
 				Source: fileabs,
 			}
 			meta = append(meta, pm)
-			plans = append(plans, plan) // validate later
 			blip.Debug("loaded file %s (%s) as plan %s", file, fileabs, plan.Name)
 		}
 	}
 
-	if err := ValidatePlans(plans); err != nil {
-		return nil, err
-	}
-
 	return meta, nil
 }
 
@@ -412,9 +420,71 @@ func (pl *Loader) fileLoaded(file string) bool {
 	return false
 }
 
+// resolveMeta resolves and validates the plans in meta, which are modified in
+// place. Meta without a plan (shared plan references) are skipped. Plans in
+// base (already loaded) can be extended but are not modified.
+func resolveMeta(meta []Meta, base []Meta, strict bool) error {
+	plans := []blip.Plan{}
+	idx := []int{} // plans[i] => meta[idx[i]]
+	for i := range meta {
+		if meta[i].plan.Name == "" {
+			continue // shared plan reference
+		}
+		plans = append(plans, meta[i].plan)
+		idx = append(idx, i)
+	}
+	basePlans := make([]blip.Plan, 0, len(base))
+	for i := range base {
+		basePlans = append(basePlans, base[i].plan)
+	}
+
+	if err := Resolve(plans, basePlans); err != nil {
+		return err
+	}
+	if err := ValidatePlans(plans, strict); err != nil {
+		return err
+	}
+
+	for i := range plans {
+		meta[idx[i]].plan = plans[i]
+	}
+	return nil
+}
+
+func fileExists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
 // --------------------------------------------------------------------------
 
-type planFile map[string]*blip.Level
+// planFile is the YAML structure of a plan file or plan table row: optional
+// extends and remove keys, and levels keyed on name. Since levels are inlined,
+// "extends" and "remove" are reserved and cannot be used as level names.
+type planFile struct {
+	Extends string                 `yaml:"extends,omitempty"`
+	Remove  []string               `yaml:"remove,omitempty"`
+	Levels  map[string]*blip.Level `yaml:",inline"`
+}
+
+// plan returns a plan from the plan file. Only Name and Source need to be set
+// by the caller.
+func (pf planFile) plan() blip.Plan {
+	levels := make(map[string]blip.Level, len(pf.Levels))
+	for k := range pf.Levels {
+		if pf.Levels[k] == nil {
+			pf.Levels[k] = &blip.Level{}
+		}
+		level := *pf.Levels[k]
+		level.Name = k // must have, levels are collected by name
+		levels[k] = level
+	}
+	return blip.Plan{
+		Levels:  levels,
+		Extends: pf.Extends,
+		Remove:  pf.Remove,
+	}
+}
 
 func ReadFile(file string) (blip.Plan, error) {
 	bytes, err := os.ReadFile(file)
@@ -427,20 +497,9 @@ func ReadFile(file string) (blip.Plan, error) {
 		return blip.Plan{}, fmt.Errorf("cannot decode YAML in %s: %s", file, err)
 	}
 
-	levels := make(map[string]blip.Level, len(pf))
-	for k := range pf {
-		levels[k] = blip.Level{
-			Name:    k, // must have, levels are collected by name
-			Freq:    pf[k].Freq,
-			Collect: pf[k].Collect,
-		}
-	}
-
-	plan := blip.Plan{
-		Name:   file,
-		Levels: levels,
-		Source: file,
-	}
+	plan := pf.plan()
+	plan.Name = file
+	plan.Source = file
 	return plan, nil
 }
 
@@ -450,20 +509,9 @@ func ReadVariable(strVal, planName string) (blip.Plan, error) {
 		return blip.Plan{}, fmt.Errorf("cannot decode YAML: %s", err)
 	}
 
-	levels := make(map[string]blip.Level, len(pf))
-	for k := range pf {
-		levels[k] = blip.Level{
-			Name:    k, // must have, levels are collected by name
-			Freq:    pf[k].Freq,
-			Collect: pf[k].Collect,
-		}
-	}
-
-	plan := blip.Plan{
-		Name:   planName,
-		Levels: levels,
-		Source: "variable",
-	}
+	plan := pf.plan()
+	plan.Name = planName
+	plan.Source = "variable"
 	return plan, nil
 }
 
@@ -483,16 +531,18 @@ func ReadTable(table string, db *sql.DB, monitorId string) ([]blip.Plan, error)
 
 	plans := []blip.Plan{}
 	for rows.Next() {
-		var plan blip.Plan
-		var levels string
-		err := rows.Scan(&plan.Name, &levels, &plan.MonitorId)
+		var name, levels, monitorId string
+		err := rows.Scan(&name, &levels, &monitorId)
 		if err != nil {
 			return nil, err
 		}
-		err = yaml.Unmarshal([]byte(levels), &plan.Levels)
-		if err != nil {
-			return nil, err
+		var pf planFile
+		if err := yaml.Unmarshal([]byte(levels), &pf); err != nil {
+			return nil, fmt.Errorf("cannot decode YAML for plan %s in %s: %s", name, table, err)
 		}
+		plan := pf.plan()
+		plan.Name = name
+		plan.MonitorId = monitorId
 		plan.Source = table
 		plans = append(plans, plan)
 	}
@@ -500,68 +550,6 @@ func ReadTable(table string, db *sql.DB, monitorId string) ([]blip.Plan, error)
 	return plans, nil
 }
 
-// ValidatePlans returns nil if all plans are valid, else it returns an error
-// that lists each validation error.
-func ValidatePlans(plans []blip.Plan) error {
-	errMsgs := []string{}
-	mcList := map[string]blip.Collector{}
-
-	for i := range plans {
-
-		// First level validation: Plan does its own static analysis (e.g. check freq)
-		if err := plans[i].Validate(); err != nil {
-			errMsgs = append(errMsgs, fmt.Sprintf("invalid plan: %s: %s", plans[i].Name, err))
-			continue
-		}
-
-		// Second level validation: PlanLoader checks that domains exist, and
-		// domain options vs collector help
-		for levelName := range plans[i].Levels {
-		DOMAINS:
-			for domainName := range plans[i].Levels[levelName].Collect {
-
-				// Make collector if needed. We're not actually running the
-				// collector, so blip.CollectorFactoryArgs{} is fine (i.e.
-				// don't need a *sql.DB or anything).
-				mc, ok := mcList[domainName]
-				if !ok {
-
-					// Implicit domain check: if the domain in the plan causes
-					// a collectory factory error, then the domain is invalid/
-					// doesn't exist
-					var err error
-					mc, err = metrics.Make(domainName, blip.CollectorFactoryArgs{Validate: true})
-					if err != nil {
-						errMsgs = append(errMsgs, fmt.Sprintf("invalid plan: %s: at %s/%s: %s",
-							plans[i].Name, levelName, domainName, err))
-						continue DOMAINS
-					}
-
-					mcList[domainName] = mc
-				}
-
-				// Validate collector options given in plan. Help() returns
-				// a blip.CollectorHelp struct which knows how to validate
-				// the input options because it (the struct) contains all the
-				// valid options.
-				err := mc.Help().Validate(plans[i].Levels[levelName].Collect[domainName].Options)
-				if err != nil {
-					errMsgs = append(errMsgs, fmt.Sprintf("invalid plan: %s: at %s/%s: %s",
-						plans[i].Name, levelName, domainName, err))
-				}
-			}
-		}
-	}
-
-	// Third level validation is each collector Prepare, called by monitor/Engine.Prepare
-
-	if len(errMsgs) > 0 {
-		return fmt.Errorf("%d plan validation errors:\n%s", len(errMsgs), strings.Join(errMsgs, "\n"))
-	}
-
-	return nil
-}
-
 func deepcopyPlan(p *blip.Plan) (blip.Plan, error) {
 	// Since the operation needed here is not performance critical we can piggy back off of gob
 	// encode/decode to make the deep copy and not rely on staying up-to-date with the blip.Plan's
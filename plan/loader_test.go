@@ -164,3 +164,22 @@ func TestPlanShouldReturnDeepCopyOfPlan(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadLevelOptions(t *testing.T) {
+	// Level options other than freq and collect must be loaded from plan files
+	file := "../test/plans/level_options.yaml"
+	pl := plan.NewLoader(nil)
+	if err := pl.LoadShared(blip.ConfigPlans{Files: []string{file}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := pl.Plan("", file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Levels["level_1"].Counters != blip.COUNTERS_RATE {
+		t.Errorf("level_1 counters = %q, expected %q", got.Levels["level_1"].Counters, blip.COUNTERS_RATE)
+	}
+	if diff := deep.Equal(got.Levels["level_2"].When, &blip.Condition{Role: blip.CONDITION_ROLE_REPLICA}); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2024 Block, Inc.
+
+package plan
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/cashapp/blip"
+)
+
+// Resolve resolves plan inheritance: every plan that extends a base plan
+// (blip.Plan.Extends) is merged with its base plan. The plans are modified
+// in place. Base plans are looked up by name first in plans, then in base,
+// then read from a file of the same name if it exists, which allows a base
+// plan to be used only for inheritance (not loaded and used directly). A
+// relative file name is relative to the directory of the extending plan file.
+//
+// The merge rules are:
+//
+//  1. Start with a copy of the (resolved) base plan levels
+//  2. Remove base levels and domains listed in Remove ("level" or "level/domain")
+//  3. For each level in the plan:
+//     a. If the level is new, add it
+//     b. Else, override freq, schedule, window, splay, counters, and when (if set) and override or add each domain
+//
+// A domain override replaces the whole base domain: metrics, options, and errors.
+// A base plan can extend another plan (chained inheritance), but cycles are an
+// error. Remove without Extends is an error because there's nothing to remove.
+func Resolve(plans []blip.Plan, base []blip.Plan) error {
+	r := resolver{
+		plans:    map[string]*blip.Plan{},
+		base:     map[string]blip.Plan{},
+		resolved: map[string]bool{},
+		visiting: map[string]bool{},
+	}
+	for i := range base {
+		r.base[base[i].Name] = base[i]
+	}
+	for i := range plans {
+		r.plans[plans[i].Name] = &plans[i]
+	}
+	for i := range plans {
+		if err := r.resolve(&plans[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type resolver struct {
+	plans    map[string]*blip.Plan // being resolved; modified in place
+	base     map[string]blip.Plan  // already loaded (resolved) plans; not modified
+	resolved map[string]bool       // plan name => resolved
+	visiting map[string]bool       // plan name => resolving (cycle detection)
+}
+
+func (r *resolver) resolve(p *blip.Plan) error {
+	if p.Extends == "" {
+		if len(p.Remove) > 0 {
+			return fmt.Errorf("invalid plan: %s: remove requires extends", p.Name)
+		}
+		return nil
+	}
+	if r.resolved[p.Name] {
+		return nil
+	}
+	if r.visiting[p.Name] {
+		return fmt.Errorf("invalid plan: %s: extends cycle: %s extends %s", p.Name, p.Name, p.Extends)
+	}
+	r.visiting[p.Name] = true
+	defer delete(r.visiting, p.Name)
+
+	base, err := r.basePlan(p.Extends, p.Source)
+	if err != nil {
+		return fmt.Errorf("invalid plan: %s: extends %s: %s", p.Name, p.Extends, err)
+	}
+	blip.Debug("plan %s extends %s (%s)", p.Name, base.Name, base.Source)
+
+	levels, err := extend(base, *p)
+	if err != nil {
+		return fmt.Errorf("invalid plan: %s: extends %s: %s", p.Name, p.Extends, err)
+	}
+	p.Levels = levels
+	p.Remove = nil // applied
+	r.resolved[p.Name] = true
+	return nil
+}
+
+// basePlan returns a resolved copy of the named base plan. If the base plan is
+// read from a file, a relative file name is relative to the directory of the
+// extending plan file (source), if the extending plan is from a file.
+func (r *resolver) basePlan(name, source string) (blip.Plan, error) {
+	if p, ok := r.plans[name]; ok {
+		if err := r.resolve(p); err != nil {
+			return blip.Plan{}, err
+		}
+		return deepcopyPlan(p)
+	}
+	if p, ok := r.base[name]; ok {
+		return deepcopyPlan(&p)
+	}
+	if !filepath.IsAbs(name) && fileExists(source) {
+		name = filepath.Join(filepath.Dir(source), name)
+		if p, ok := r.plans[name]; ok {
+			if err := r.resolve(p); err != nil {
+				return blip.Plan{}, err
+			}
+			return deepcopyPlan(p)
+		}
+	}
+	if !fileExists(name) {
+		return blip.Plan{}, fmt.Errorf("base plan not loaded and file %s does not exist", name)
+	}
+	p, err := ReadFile(name)
+	if err != nil {
+		return blip.Plan{}, err
+	}
+	r.plans[name] = &p
+	if err := r.resolve(&p); err != nil {
+		return blip.Plan{}, err
+	}
+	return deepcopyPlan(&p)
+}
+
+// extend returns the levels of plan p merged on top of the levels of base.
+// Base is a copy, so it's modified and returned.
+func extend(base, p blip.Plan) (map[string]blip.Level, error) {
+	levels := base.Levels
+	if levels == nil {
+		levels = map[string]blip.Level{}
+	}
+
+	for _, rm := range p.Remove {
+		levelName, domainName, isDomain := strings.Cut(rm, "/")
+		level, ok := levels[levelName]
+		if !ok {
+			return nil, fmt.Errorf("remove %s: base plan has no level %s", rm, levelName)
+		}
+		if !isDomain {
+			delete(levels, levelName)
+			continue
+		}
+		if _, ok := level.Collect[domainName]; !ok {
+			return nil, fmt.Errorf("remove %s: base plan level %s has no domain %s", rm, levelName, domainName)
+		}
+		delete(level.Collect, domainName)
+	}
+
+	for levelName, level := range p.Levels {
+		baseLevel, ok := levels[levelName]
+		if !ok {
+			levels[levelName] = level
+			continue
+		}
+		if level.Freq != "" { // freq and schedule are mutually exclusive
+			baseLevel.Freq = level.Freq
+			baseLevel.Schedule = ""
+			baseLevel.Splay = ""
+		}
+		if level.Schedule != "" {
+			baseLevel.Schedule = level.Schedule
+			baseLevel.Freq = ""
+		}
+		if level.Window != "" {
+			baseLevel.Window = level.Window
+		}
+		if level.Splay != "" {
+			baseLevel.Splay = level.Splay
+		}
+		if level.Counters != "" {
+			baseLevel.Counters = level.Counters
+		}
+		if level.When != nil {
+			baseLevel.When = level.When
+		}
+		if baseLevel.Collect == nil {
+			baseLevel.Collect = map[string]blip.Domain{}
+		}
+		for domainName, domain := range level.Collect {
+			baseLevel.Collect[domainName] = domain
+		}
+		levels[levelName] = baseLevel
+	}
+
+	return levels, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Block, Inc.
+
+package plan_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/plan"
+)
+
+func TestLoadExtends(t *testing.T) {
+	// extends.yaml extends extends_base.yaml, which is not loaded, so it's
+	// read from file on resolve
+	file := "../test/plans/extends.yaml"
+	pl := plan.NewLoader(nil)
+	if err := pl.LoadShared(blip.ConfigPlans{Files: []string{file}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := pl.Plan("", file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]blip.Level{
+		"kpi": {
+			Name: "kpi",
+			Freq: "5s", // base
+			Collect: map[string]blip.Domain{
+				"status.global": { // override
+					Metrics: []string{"threads_running"},
+				},
+				// innodb removed
+			},
+		},
+		"standard": {
+			Name: "standard",
+			Freq: "30s", // override
+			Collect: map[string]blip.Domain{
+				"var.global": {
+					Metrics: []string{"max_connections"},
+				},
+			},
+		},
+		// data-size removed
+	}
+	if diff := deep.Equal(got.Levels, expect); diff != nil {
+		t.Error(diff)
+	}
+	if got.Extends != "extends_base.yaml" {
+		t.Errorf("got Extends %q, expected base file", got.Extends)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	base := blip.Plan{
+		Name: "base",
+		Levels: map[string]blip.Level{
+			"kpi": {
+				Name: "kpi",
+				Freq: "5s",
+				Collect: map[string]blip.Domain{
+					"status.global": {Metrics: []string{"queries"}},
+				},
+			},
+		},
+	}
+
+	// Chained: c extends b extends base (loaded), and b is resolved even
+	// though it's after c
+	plans := []blip.Plan{
+		{
+			Name:    "c",
+			Extends: "b",
+			Levels: map[string]blip.Level{
+				"slow": {Name: "slow", Freq: "60s", Collect: map[string]blip.Domain{"size.database": {}}},
+			},
+		},
+		{
+			Name:    "b",
+			Extends: "base",
+			Levels: map[string]blip.Level{
+				"kpi": {Name: "kpi", Collect: map[string]blip.Domain{"innodb": {Metrics: []string{"trx_rseg_history_len"}}}},
+			},
+		},
+	}
+	if err := plan.Resolve(plans, []blip.Plan{base}); err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]blip.Level{
+		"kpi": {
+			Name: "kpi",
+			Freq: "5s",
+			Collect: map[string]blip.Domain{
+				"status.global": {Metrics: []string{"queries"}},
+				"innodb":        {Metrics: []string{"trx_rseg_history_len"}},
+			},
+		},
+		"slow": {Name: "slow", Freq: "60s", Collect: map[string]blip.Domain{"size.database": {}}},
+	}
+	if diff := deep.Equal(plans[0].Levels, expect); diff != nil {
+		t.Error(diff)
+	}
+	if len(base.Levels["kpi"].Collect) != 1 {
+		t.Errorf("base plan modified: %+v", base.Levels["kpi"])
+	}
+
+	// Cycle
+	plans = []blip.Plan{
+		{Name: "a", Extends: "b"},
+		{Name: "b", Extends: "a"},
+	}
+	if err := plan.Resolve(plans, nil); err == nil {
+		t.Error("no error on extends cycle")
+	}
+
+	// Remove level that base doesn't have
+	plans = []blip.Plan{
+		{Name: "a", Extends: "base", Remove: []string{"nope"}},
+	}
+	if err := plan.Resolve(plans, []blip.Plan{base}); err == nil {
+		t.Error("no error removing level not in base plan")
+	}
+
+	// Remove without extends
+	plans = []blip.Plan{
+		{Name: "a", Remove: []string{"kpi"}},
+	}
+	if err := plan.Resolve(plans, []blip.Plan{base}); err == nil || !strings.Contains(err.Error(), "remove requires extends") {
+		t.Errorf("got error %v, expected remove requires extends", err)
+	}
+}
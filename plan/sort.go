@@ -13,14 +13,30 @@ import (
 type SortedLevel struct {
 	Freq time.Duration
 	Name string
+
+	// Scheduled levels (blip.Level.Scheduled) have a schedule or window.
+	// Freq is the schedule period if the level has a schedule.
+	Schedule *blip.Schedule
+	Window   *blip.Window
+	Splay    time.Duration
+}
+
+// Scheduled returns true if the level has a schedule or window.
+func (l SortedLevel) Scheduled() bool {
+	return l.Schedule != nil || l.Window != nil
 }
 
-// Sort levels ascending by frequency.
+// Sort levels ascending by frequency, scheduled levels last.
 type byFreq []SortedLevel
 
-func (a byFreq) Len() int           { return len(a) }
-func (a byFreq) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a byFreq) Less(i, j int) bool { return a[i].Freq < a[j].Freq }
+func (a byFreq) Len() int      { return len(a) }
+func (a byFreq) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byFreq) Less(i, j int) bool {
+	if a[i].Scheduled() != a[j].Scheduled() {
+		return !a[i].Scheduled()
+	}
+	return a[i].Freq < a[j].Freq
+}
 
 // Sort returns a list of levels sorted (asc) by frequency. Sorted levels
 // are used in the main Run loop: for i := range c.levels. Sorted levels are
@@ -35,6 +51,10 @@ func (a byFreq) Less(i, j int) bool { return a[i].Freq < a[j].Freq }
 //
 // Also, we convert duration strings from the plan level to integers for sorted
 // levels in order to do modulo (%) in the main Run loop.
+//
+// Scheduled levels (schedule or window) are sorted last and not merged: they
+// collect only their own domains, and other levels don't collect their domains.
+// The main Run loop checks them separately.
 func Sort(p *blip.Plan) []SortedLevel {
 	// Make a sorted level for each plan level
 	levels := make([]SortedLevel, len(p.Levels))
@@ -45,9 +65,36 @@ func Sort(p *blip.Plan) []SortedLevel {
 			Name: l.Name,
 			Freq: d,
 		}
+		// Already validated, so errors are ignored
+		if l.Schedule != "" {
+			levels[i].Schedule, _ = blip.ParseSchedule(l.Schedule)
+			levels[i].Freq = levels[i].Schedule.Period()
+		}
+		if l.Window != "" {
+			levels[i].Window, _ = blip.ParseWindow(l.Window)
+		}
+		if l.Splay != "" {
+			levels[i].Splay, _ = time.ParseDuration(l.Splay)
+		}
 		i++
 	}
 
+	// Apply level conditions to the level's domains before merging levels below
+	// so the conditions stay with the domains in higher levels
+	for levelName, level := range p.Levels {
+		if level.When == nil {
+			continue
+		}
+		for domainName, dom := range level.Collect {
+			when := *level.When
+			if dom.When != nil {
+				when = when.Override(*dom.When)
+			}
+			dom.When = &when
+			p.Levels[levelName].Collect[domainName] = dom
+		}
+	}
+
 	// Sort levels by ascending frequency
 	sort.Sort(byFreq(levels))
 	blip.Debug("%s levels: %v", p.Name, levels)
@@ -63,6 +110,9 @@ func Sort(p *blip.Plan) []SortedLevel {
 	// "Low level, high frequency"
 
 	for hi := len(levels) - 1; hi > 0; hi-- {
+		if levels[hi].Scheduled() {
+			continue
+		}
 		higher := p.Levels[levels[hi].Name]
 
 		for lo := hi - 1; lo >= 0; lo-- {
@@ -74,6 +124,12 @@ func Sort(p *blip.Plan) []SortedLevel {
 
 			lower := p.Levels[levels[lo].Name]
 
+			// Higher level collects lower level counters, so it reports them
+			// the same way unless it sets its own counters mode
+			if higher.Counters == "" {
+				higher.Counters = lower.Counters
+			}
+
 			for domain := range lower.Collect {
 				higherDomain, ok := higher.Collect[domain]
 				if !ok {
@@ -82,6 +138,7 @@ func Sort(p *blip.Plan) []SortedLevel {
 						Metrics: []string{},
 						Options: map[string]string{},
 						Errors:  map[string]string{},
+						When:    lower.Collect[domain].When,
 					}
 				}
 				higherDomain.Metrics = append(higherDomain.Metrics, lower.Collect[domain].Metrics...)
@@ -98,6 +155,7 @@ func Sort(p *blip.Plan) []SortedLevel {
 				higher.Collect[domain] = higherDomain
 			}
 		}
+		p.Levels[levels[hi].Name] = higher // Level is a copy
 	}
 
 	return levels
@@ -3,6 +3,8 @@
 package plan_test
 
 import (
+	"fmt"
+	"sort"
 	"testing"
 	"time"
 
@@ -483,3 +485,115 @@ func TestSortDefault_None(t *testing.T) {
 		t.Errorf("got %d levels from default.None plan, expected 0", len(gotLevels))
 	}
 }
+
+func TestSortCounters(t *testing.T) {
+	// Higher levels collect lower level counters, so they inherit the lower
+	// level counters mode unless they set their own
+	p := blip.Plan{
+		Name: "p1",
+		Levels: map[string]blip.Level{
+			"l1": {Name: "l1", Freq: "5s", Counters: blip.COUNTERS_RATE, Collect: map[string]blip.Domain{}},
+			"l2": {Name: "l2", Freq: "10s", Collect: map[string]blip.Domain{}},
+			"l3": {Name: "l3", Freq: "20s", Counters: blip.COUNTERS_CUMULATIVE, Collect: map[string]blip.Domain{}},
+		},
+	}
+	plan.Sort(&p)
+	got := map[string]string{}
+	for name, level := range p.Levels {
+		got[name] = level.Counters
+	}
+	expect := map[string]string{
+		"l1": blip.COUNTERS_RATE,
+		"l2": blip.COUNTERS_RATE,
+		"l3": blip.COUNTERS_CUMULATIVE,
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestSortConditions(t *testing.T) {
+	// Level conditions apply to the level's domains (domain fields override
+	// level fields), and stay with the domains merged into higher levels
+	replica := &blip.Condition{Role: blip.CONDITION_ROLE_REPLICA}
+	p := blip.Plan{
+		Name: "p1",
+		Levels: map[string]blip.Level{
+			"l1": {
+				Name: "l1",
+				Freq: "5s",
+				When: replica,
+				Collect: map[string]blip.Domain{
+					"repl":     {Name: "repl"},
+					"repl.lag": {Name: "repl.lag", When: &blip.Condition{Table: "blip.heartbeat"}},
+				},
+			},
+			"l2": {
+				Name: "l2",
+				Freq: "10s",
+				Collect: map[string]blip.Domain{
+					"status.global": {Name: "status.global"},
+				},
+			},
+		},
+	}
+	plan.Sort(&p)
+	got := map[string]*blip.Condition{}
+	for levelName, level := range p.Levels {
+		for domainName, dom := range level.Collect {
+			got[levelName+"/"+domainName] = dom.When
+		}
+	}
+	expect := map[string]*blip.Condition{
+		"l1/repl":          replica,
+		"l1/repl.lag":      {Role: blip.CONDITION_ROLE_REPLICA, Table: "blip.heartbeat"},
+		"l2/repl":          replica,
+		"l2/repl.lag":      {Role: blip.CONDITION_ROLE_REPLICA, Table: "blip.heartbeat"},
+		"l2/status.global": nil,
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestSortScheduled(t *testing.T) {
+	// Scheduled levels are sorted last and not merged with other levels
+	p := blip.Plan{
+		Name: "p1",
+		Levels: map[string]blip.Level{
+			"l1":   {Name: "l1", Freq: "5s", Collect: map[string]blip.Domain{"status.global": {Name: "status.global"}}},
+			"l2":   {Name: "l2", Freq: "10s", Collect: map[string]blip.Domain{"var.global": {Name: "var.global"}}},
+			"size": {Name: "size", Schedule: "5 * * * *", Splay: "5m", Collect: map[string]blip.Domain{"size.table": {Name: "size.table"}}},
+			"trx":  {Name: "trx", Freq: "10s", Window: "02:00-04:00", Collect: map[string]blip.Domain{"trx": {Name: "trx"}}},
+		},
+	}
+	levels := plan.Sort(&p)
+	got := []string{}
+	for _, l := range levels {
+		got = append(got, fmt.Sprintf("%s:%s:%t", l.Name, l.Freq, l.Scheduled()))
+	}
+	expect := []string{"l1:5s:false", "l2:10s:false", "trx:10s:true", "size:1h0m0s:true"}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+	if levels[3].Splay != 5*time.Minute {
+		t.Errorf("size splay %s, expected 5m", levels[3].Splay)
+	}
+
+	collect := map[string][]string{}
+	for levelName, level := range p.Levels {
+		for domainName := range level.Collect {
+			collect[levelName] = append(collect[levelName], domainName)
+		}
+		sort.Strings(collect[levelName])
+	}
+	expectCollect := map[string][]string{
+		"l1":   {"status.global"},
+		"l2":   {"status.global", "var.global"},
+		"size": {"size.table"},
+		"trx":  {"trx"},
+	}
+	if diff := deep.Equal(collect, expectCollect); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2024 Block, Inc.
+
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/derived"
+	"github.com/cashapp/blip/event"
+	"github.com/cashapp/blip/metrics"
+)
+
+// ValidationError is one plan validation error. Plan is always set. Level and
+// Domain are set if the error is specific to a domain in a level. Metric or
+// ErrorPolicy is set if the error is specific to a metric or error policy.
+type ValidationError struct {
+	Plan        string
+	Level       string
+	Domain      string
+	Metric      string
+	ErrorPolicy string
+	Msg         string
+}
+
+func (e ValidationError) Error() string {
+	if e.Level == "" {
+		return fmt.Sprintf("invalid plan: %s: %s", e.Plan, e.Msg)
+	}
+	return fmt.Sprintf("invalid plan: %s: at %s/%s: %s", e.Plan, e.Level, e.Domain, e.Msg)
+}
+
+// ValidationErrors is the error returned by ValidatePlans.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i := range e {
+		msgs[i] = e[i].Error()
+	}
+	return fmt.Sprintf("%d plan validation errors:\n%s", len(e), strings.Join(msgs, "\n"))
+}
+
+// ValidatePlans returns nil if all plans are valid, else it returns ValidationErrors
+// that lists each validation error.
+//
+// Metric names and error policy keys are validated against the collector help
+// (blip.CollectorHelp). If strict is true, invalid metric names and error policy
+// keys are errors. Else, they are warnings: reported as event.PLANS_VALIDATION_WARNING
+// but not returned.
+func ValidatePlans(plans []blip.Plan, strict bool) error {
+	errs := ValidationErrors{}
+	warnings := ValidationErrors{}
+	mcList := map[string]blip.Collector{}
+
+	for i := range plans {
+
+		// First level validation: Plan does its own static analysis (e.g. check freq)
+		if err := plans[i].Validate(); err != nil {
+			errs = append(errs, ValidationError{Plan: plans[i].Name, Msg: err.Error()})
+			continue
+		}
+
+		// Second level validation: PlanLoader checks that domains exist, and
+		// domain options, metrics, and error policies vs collector help
+		for levelName := range plans[i].Levels {
+		DOMAINS:
+			for domainName, dom := range plans[i].Levels[levelName].Collect {
+
+				// Pseudo-domain derived has no collector: validate expressions
+				// and that referenced domains exist
+				if domainName == derived.DOMAIN {
+					for _, err := range validateDerived(dom) {
+						errs = append(errs, ValidationError{
+							Plan:   plans[i].Name,
+							Level:  levelName,
+							Domain: domainName,
+							Msg:    err.Error(),
+						})
+					}
+					continue DOMAINS
+				}
+
+				// Make collector if needed. We're not actually running the
+				// collector, so blip.CollectorFactoryArgs{} is fine (i.e.
+				// don't need a *sql.DB or anything).
+				mc, ok := mcList[domainName]
+				if !ok {
+
+					// Implicit domain check: if the domain in the plan causes
+					// a collectory factory error, then the domain is invalid/
+					// doesn't exist
+					var err error
+					mc, err = metrics.Make(domainName, blip.CollectorFactoryArgs{Validate: true})
+					if err != nil {
+						errs = append(errs, ValidationError{
+							Plan:   plans[i].Name,
+							Level:  levelName,
+							Domain: domainName,
+							Msg:    err.Error(),
+						})
+						continue DOMAINS
+					}
+
+					mcList[domainName] = mc
+				}
+				help := mc.Help()
+
+				// Validate collector options given in plan. Help() returns
+				// a blip.CollectorHelp struct which knows how to validate
+				// the input options because it (the struct) contains all the
+				// valid options.
+				if err := help.Validate(dom.Options); err != nil {
+					errs = append(errs, ValidationError{
+						Plan:   plans[i].Name,
+						Level:  levelName,
+						Domain: domainName,
+						Msg:    err.Error(),
+					})
+				}
+
+				// Validate metric names (only if the collector declares a fixed
+				// list of metrics) and error policy keys. These are errors only
+				// in strict mode because, historically, they weren't validated.
+				invalid := ValidationErrors{}
+				for _, metricName := range dom.Metrics {
+					if err := help.ValidateMetrics([]string{metricName}); err != nil {
+						invalid = append(invalid, ValidationError{
+							Plan:   plans[i].Name,
+							Level:  levelName,
+							Domain: domainName,
+							Metric: metricName,
+							Msg:    err.Error(),
+						})
+					}
+				}
+				errKeys := make([]string, 0, len(dom.Errors))
+				for k := range dom.Errors {
+					errKeys = append(errKeys, k)
+				}
+				sort.Strings(errKeys)
+				for _, k := range errKeys {
+					if err := help.ValidateErrors(map[string]string{k: dom.Errors[k]}); err != nil {
+						invalid = append(invalid, ValidationError{
+							Plan:        plans[i].Name,
+							Level:       levelName,
+							Domain:      domainName,
+							ErrorPolicy: k,
+							Msg:         err.Error(),
+						})
+					}
+				}
+				if strict {
+					errs = append(errs, invalid...)
+				} else {
+					warnings = append(warnings, invalid...)
+				}
+			}
+		}
+	}
+
+	// Third level validation is each collector Prepare, called by monitor/Engine.Prepare
+
+	for _, w := range warnings {
+		event.Sendf(event.PLANS_VALIDATION_WARNING, w.Error())
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// validateDerived returns errors for derived metrics in the pseudo-domain:
+// invalid expressions, references to domains that don't exist, and metrics
+// or error policies (which derived doesn't have).
+func validateDerived(dom blip.Domain) []error {
+	if len(dom.Metrics) > 0 || len(dom.Errors) > 0 {
+		return []error{fmt.Errorf("only options allowed (derived metric name: expression)")}
+	}
+	derivedMetrics, err := derived.Metrics(dom.Options)
+	if err != nil {
+		return []error{err}
+	}
+	errs := []error{}
+	for _, m := range derivedMetrics {
+		for _, ref := range m.Refs {
+			domain := ref[:strings.LastIndex(ref, ".")]
+			if !metrics.Exists(domain) {
+				errs = append(errs, fmt.Errorf("derived metric %s: invalid domain: %s (no factory registered)", m.Name, domain))
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 Block, Inc.
+
+package plan_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/event"
+	"github.com/cashapp/blip/plan"
+	"github.com/cashapp/blip/test/mock"
+)
+
+func TestValidatePlansMetrics(t *testing.T) {
+	plans := []blip.Plan{
+		{
+			Name: "p1",
+			Levels: map[string]blip.Level{
+				"kpi": {
+					Name: "kpi",
+					Freq: "5s",
+					Collect: map[string]blip.Domain{
+						"trx": { // fixed metrics: oldest
+							Metrics: []string{"oldest", "oldst"},
+						},
+						"repl": {
+							Metrics: []string{"running"},
+							Errors:  map[string]string{"access-denied": "ignore,drop,stop", "no-such-error": "ignore"},
+						},
+						"status.global": { // not fixed metrics
+							Metrics: []string{"threads_runing"},
+						},
+					},
+				},
+			},
+		},
+	}
+	expect := plan.ValidationErrors{
+		{
+			Plan:   "p1",
+			Level:  "kpi",
+			Domain: "trx",
+			Metric: "oldst",
+			Msg:    "unknown metric: oldst (run 'blip --print-domains' to list collector metrics)",
+		},
+		{
+			Plan:        "p1",
+			Level:       "kpi",
+			Domain:      "repl",
+			ErrorPolicy: "no-such-error",
+			Msg:         "unknown error policy: no-such-error (run 'blip --print-domains' to list collector errors)",
+		},
+	}
+
+	// Strict: invalid metrics and error policies are errors
+	err := plan.ValidatePlans(plans, true)
+	var got plan.ValidationErrors
+	if !errors.As(err, &got) {
+		t.Fatalf("got error %v (%T), expected plan.ValidationErrors", err, err)
+	}
+	if len(got) == 2 && got[0].Domain == "repl" {
+		got[0], got[1] = got[1], got[0] // domain order is random
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Lenient: invalid metrics and error policies are warnings (events)
+	events := []event.Event{}
+	event.Subscribe(mock.EventReceiver{
+		RecvFunc: func(e event.Event) {
+			if e.Event == event.PLANS_VALIDATION_WARNING {
+				events = append(events, e)
+			}
+		},
+	})
+	defer event.RemoveSubscribers()
+	if err := plan.ValidatePlans(plans, false); err != nil {
+		t.Errorf("got error in lenient mode, expected nil: %s", err)
+	}
+	if len(events) != 2 {
+		t.Errorf("got %d warning events, expected 2: %+v", len(events), events)
+	}
+}
+
+func TestValidatePlansDerived(t *testing.T) {
+	plans := []blip.Plan{
+		{
+			Name: "p1",
+			Levels: map[string]blip.Level{
+				"kpi": {
+					Name: "kpi",
+					Freq: "5s",
+					Collect: map[string]blip.Domain{
+						"status.global": {
+							Metrics: []string{"threads_connected"},
+						},
+						"derived": {
+							Options: map[string]string{
+								"util": "status.global.threads_connected / var.global.max_connections",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if err := plan.ValidatePlans(plans, true); err != nil {
+		t.Errorf("got error for valid derived metrics: %s", err)
+	}
+
+	plans[0].Levels["kpi"].Collect["derived"] = blip.Domain{
+		Options: map[string]string{
+			"util": "status.global.threads_connected / no.such.domain.max_connections",
+		},
+	}
+	expect := plan.ValidationErrors{
+		{
+			Plan:   "p1",
+			Level:  "kpi",
+			Domain: "derived",
+			Msg:    "derived metric util: invalid domain: no.such.domain (no factory registered)",
+		},
+	}
+	err := plan.ValidatePlans(plans, true)
+	var got plan.ValidationErrors
+	if !errors.As(err, &got) {
+		t.Fatalf("got error %v, expected plan.ValidationErrors", err)
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -129,3 +129,96 @@ func TestPlanFreq(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+func TestValidateCounters(t *testing.T) {
+	plan := blip.Plan{
+		Name: "p1",
+		Levels: map[string]blip.Level{
+			"kpi": {Name: "kpi", Freq: "5s", Counters: blip.COUNTERS_RATE},
+			"std": {Name: "std", Freq: "1m", Counters: blip.COUNTERS_DELTA},
+		},
+	}
+	if err := plan.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	plan.Levels["std"] = blip.Level{Name: "std", Freq: "1m", Counters: "per-second"}
+	err := plan.Validate()
+	if err == nil {
+		t.Fatalf("Validate no error, expected error for invalid counters")
+	}
+	if !strings.Contains(err.Error(), "per-second") {
+		t.Errorf("error message does not state invalid counters, expected 'per-second': %s", err)
+	}
+}
+
+func TestValidateConditions(t *testing.T) {
+	writable := true
+	plan := blip.Plan{
+		Name: "p1",
+		Levels: map[string]blip.Level{
+			"kpi": {
+				Name: "kpi",
+				Freq: "5s",
+				When: &blip.Condition{Role: blip.CONDITION_ROLE_REPLICA},
+				Collect: map[string]blip.Domain{
+					"repl": {
+						Name: "repl",
+						When: &blip.Condition{
+							State:    []string{blip.STATE_ACTIVE},
+							Writable: &writable,
+							Table:    "blip.heartbeat",
+							Flavor:   []string{blip.FLAVOR_PERCONA},
+						},
+					},
+				},
+			},
+		},
+	}
+	if err := plan.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	invalid := []blip.Condition{
+		{Role: "primary"},
+		{State: []string{"offline"}},
+		{Table: "heartbeat"},
+		{Flavor: []string{"postgres"}},
+	}
+	for _, when := range invalid {
+		w := when
+		plan.Levels["kpi"] = blip.Level{Name: "kpi", Freq: "5s", When: &w}
+		if err := plan.Validate(); err == nil {
+			t.Errorf("Validate no error, expected error for invalid condition %+v", when)
+		}
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	plan := blip.Plan{
+		Name: "p1",
+		Levels: map[string]blip.Level{
+			"kpi":     {Name: "kpi", Freq: "5s"},
+			"size":    {Name: "size", Schedule: "5 * * * *", Splay: "5m"},
+			"nightly": {Name: "nightly", Freq: "5s", Window: "02:00-04:00 UTC"}, // same freq as kpi
+		},
+	}
+	if err := plan.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	invalid := []blip.Level{
+		{Name: "size", Freq: "1h", Schedule: "5 * * * *"}, // mutually exclusive
+		{Name: "size", Schedule: "61 * * * *"},
+		{Name: "size", Schedule: "0 0 31 2 *"},  // never
+		{Name: "size", Freq: "1h", Splay: "5m"}, // splay requires schedule
+		{Name: "size", Schedule: "5 * * * *", Splay: "5"},
+		{Name: "size", Freq: "1h", Window: "02:00"},
+	}
+	for _, level := range invalid {
+		plan.Levels["size"] = level
+		if err := plan.Validate(); err == nil {
+			t.Errorf("Validate no error, expected error for invalid level %+v", level)
+		}
+	}
+}
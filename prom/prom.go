@@ -42,7 +42,7 @@ func NewAPI(cfg blip.ConfigExporter, monitorId string, exp Exporter) *API {
 func (api *API) Run() error {
 	blip.Debug("%s: prom addr %s", api.monitorId, api.srv.Addr)
 	status.Monitor(api.monitorId, "exporter", "listening on %s", api.srv.Addr)
-	defer status.Monitor(api.monitorId, "exporter", "stopped")
+	defer status.MonitorState(api.monitorId, "exporter", status.STATE_STOPPED, "stopped")
 
 	path := blip.SetOrDefault(api.cfg.Flags["web.telemetry-path"], blip.DEFAULT_EXPORTER_PATH)
 	mux := http.NewServeMux()
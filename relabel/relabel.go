@@ -0,0 +1,171 @@
+// Copyright 2024 Block, Inc.
+
+// Package relabel provides declarative metric relabeling: keep, drop, rename,
+// tag, and hash-mod shard metrics before they're sent to sinks. Rules are
+// configured in config.relabel (blip.ConfigRelabel), and they're applied in
+// order by a Pipeline. This is the config alternative to the TransformMetrics
+// plugin for common transformations.
+package relabel
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+
+	"github.com/cashapp/blip"
+)
+
+// Pipeline applies relabel rules in order. It's safe for concurrent use
+// because it's immutable once created.
+type Pipeline struct {
+	rules []rule
+}
+
+type rule struct {
+	cfg    blip.ConfigRelabelRule
+	domain *regexp.Regexp // nil matches all
+	name   *regexp.Regexp // nil matches all
+	group  map[string]*regexp.Regexp
+}
+
+// New returns a Pipeline for the rules, or an error if a rule is invalid.
+// An empty list of rules returns a nil Pipeline, which is valid: Apply
+// on a nil Pipeline returns metrics unchanged.
+func New(rules []blip.ConfigRelabelRule) (*Pipeline, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	p := &Pipeline{rules: make([]rule, len(rules))}
+	for i, cfg := range rules {
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("relabel rule %d: %s", i, err)
+		}
+		r := rule{cfg: cfg}
+		r.domain = anchored(cfg.Domain)
+		r.name = anchored(cfg.Name)
+		if len(cfg.Group) > 0 {
+			r.group = make(map[string]*regexp.Regexp, len(cfg.Group))
+			for k, re := range cfg.Group {
+				r.group[k] = anchored(re)
+			}
+		}
+		p.rules[i] = r
+	}
+	return p, nil
+}
+
+// anchored returns the regex anchored to match whole values like Prometheus
+// relabel rules, or nil if re is empty. The regex is already validated.
+func anchored(re string) *regexp.Regexp {
+	if re == "" {
+		return nil
+	}
+	return regexp.MustCompile("^(?:" + re + ")$")
+}
+
+// Apply returns a copy of metrics with all rules applied. The given metrics
+// are not modified. If p is nil, metrics are returned unchanged (not copied).
+// Domains with no metrics after applying rules are removed.
+func (p *Pipeline) Apply(metrics *blip.Metrics) *blip.Metrics {
+	if p == nil {
+		return metrics
+	}
+	m := *metrics
+	m.Values = make(map[string][]blip.MetricValue, len(metrics.Values))
+	for domain, values := range metrics.Values {
+		out := make([]blip.MetricValue, 0, len(values))
+	VALUES:
+		for _, v := range values {
+			for i := range p.rules {
+				var keep bool
+				v, keep = p.rules[i].apply(m.MonitorId, domain, v)
+				if !keep {
+					continue VALUES
+				}
+			}
+			out = append(out, v)
+		}
+		if len(out) > 0 {
+			m.Values[domain] = out
+		}
+	}
+	return &m
+}
+
+// apply applies the rule to one metric value. It returns the (possibly
+// modified) value, and false if the value is dropped.
+func (r rule) apply(monitorId, domain string, v blip.MetricValue) (blip.MetricValue, bool) {
+	match := r.match(domain, v)
+	switch r.cfg.Action {
+	case blip.RELABEL_KEEP:
+		return v, match
+	case blip.RELABEL_DROP:
+		return v, !match
+	}
+	if !match {
+		return v, true
+	}
+	switch r.cfg.Action {
+	case blip.RELABEL_RENAME:
+		if r.name != nil {
+			v.Name = r.name.ReplaceAllString(v.Name, r.cfg.Replacement)
+		} else {
+			v.Name = r.cfg.Replacement
+		}
+	case blip.RELABEL_TAG:
+		val := r.cfg.Value
+		if r.cfg.Source != "" {
+			val = source(r.cfg.Source, monitorId, domain, v)
+		}
+		meta := make(map[string]string, len(v.Meta)+1) // copy: don't modify shared map
+		for k, mv := range v.Meta {
+			meta[k] = mv
+		}
+		meta[r.cfg.Tag] = val
+		v.Meta = meta
+	case blip.RELABEL_HASHMOD:
+		src := r.cfg.Source
+		if src == "" {
+			src = blip.RELABEL_SOURCE_METRIC
+		}
+		h := fnv.New32a()
+		h.Write([]byte(source(src, monitorId, domain, v)))
+		return v, uint(h.Sum32())%r.cfg.Modulus == r.cfg.Shard
+	}
+	return v, true
+}
+
+func (r rule) match(domain string, v blip.MetricValue) bool {
+	if r.domain != nil && !r.domain.MatchString(domain) {
+		return false
+	}
+	if r.name != nil && !r.name.MatchString(v.Name) {
+		return false
+	}
+	for k, re := range r.group {
+		if !re.MatchString(v.Group[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// source returns the value of a relabel source: blip.RELABEL_SOURCE_* const.
+func source(src, monitorId, domain string, v blip.MetricValue) string {
+	switch {
+	case src == blip.RELABEL_SOURCE_MONITOR:
+		return monitorId
+	case src == blip.RELABEL_SOURCE_DOMAIN:
+		return domain
+	case src == blip.RELABEL_SOURCE_NAME:
+		return v.Name
+	case src == blip.RELABEL_SOURCE_METRIC:
+		return domain + "." + v.Name
+	case strings.HasPrefix(src, blip.RELABEL_SOURCE_GROUP):
+		return v.Group[strings.TrimPrefix(src, blip.RELABEL_SOURCE_GROUP)]
+	case strings.HasPrefix(src, blip.RELABEL_SOURCE_META):
+		return v.Meta[strings.TrimPrefix(src, blip.RELABEL_SOURCE_META)]
+	}
+	return ""
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 Block, Inc.
+
+package relabel_test
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/relabel"
+)
+
+func metrics() *blip.Metrics {
+	return &blip.Metrics{
+		MonitorId: "db1",
+		Values: map[string][]blip.MetricValue{
+			"status.global": {
+				{Name: "queries", Value: 10, Type: blip.CUMULATIVE_COUNTER},
+				{Name: "threads_running", Value: 2, Type: blip.GAUGE},
+			},
+			"size.table": {
+				{Name: "bytes", Value: 100, Type: blip.GAUGE, Group: map[string]string{"db": "test", "tbl": "t1"}},
+				{Name: "bytes", Value: 200, Type: blip.GAUGE, Group: map[string]string{"db": "mysql", "tbl": "user"}},
+			},
+		},
+	}
+}
+
+func TestNilPipeline(t *testing.T) {
+	p, err := relabel.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := metrics()
+	if got := p.Apply(m); got != m {
+		t.Errorf("nil pipeline returned different metrics")
+	}
+}
+
+func TestKeepDrop(t *testing.T) {
+	p, err := relabel.New([]blip.ConfigRelabelRule{
+		{Action: blip.RELABEL_DROP, Group: map[string]string{"db": "mysql|sys"}},
+		{Action: blip.RELABEL_KEEP, Name: "bytes|queries"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := metrics()
+	got := p.Apply(in)
+	expect := map[string][]blip.MetricValue{
+		"status.global": {
+			{Name: "queries", Value: 10, Type: blip.CUMULATIVE_COUNTER},
+		},
+		"size.table": {
+			{Name: "bytes", Value: 100, Type: blip.GAUGE, Group: map[string]string{"db": "test", "tbl": "t1"}},
+		},
+	}
+	if diff := deep.Equal(got.Values, expect); diff != nil {
+		t.Error(diff)
+	}
+	// Input not modified
+	if diff := deep.Equal(in, metrics()); diff != nil {
+		t.Error(diff)
+	}
+
+	// Regex are anchored: "query" doesn't match "queries", and domains with
+	// no metrics are removed
+	p, err = relabel.New([]blip.ConfigRelabelRule{
+		{Action: blip.RELABEL_KEEP, Domain: "status.global", Name: "query"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = p.Apply(metrics())
+	if len(got.Values) != 0 {
+		t.Errorf("got %v, expected no values", got.Values)
+	}
+}
+
+func TestRenameTag(t *testing.T) {
+	p, err := relabel.New([]blip.ConfigRelabelRule{
+		{Action: blip.RELABEL_RENAME, Domain: "status.global", Name: "threads_(.+)", Replacement: "threads.$1"},
+		{Action: blip.RELABEL_TAG, Tag: "env", Value: "prod"},
+		{Action: blip.RELABEL_TAG, Domain: "size.table", Tag: "schema", Source: "group.db"},
+		{Action: blip.RELABEL_TAG, Name: "queries", Tag: "src", Source: blip.RELABEL_SOURCE_METRIC},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := metrics()
+	in.Values["status.global"][0].Meta = map[string]string{"foo": "bar"}
+	got := p.Apply(in)
+	expect := map[string][]blip.MetricValue{
+		"status.global": {
+			{Name: "queries", Value: 10, Type: blip.CUMULATIVE_COUNTER, Meta: map[string]string{"foo": "bar", "env": "prod", "src": "status.global.queries"}},
+			{Name: "threads.running", Value: 2, Type: blip.GAUGE, Meta: map[string]string{"env": "prod"}},
+		},
+		"size.table": {
+			{Name: "bytes", Value: 100, Type: blip.GAUGE, Group: map[string]string{"db": "test", "tbl": "t1"}, Meta: map[string]string{"env": "prod", "schema": "test"}},
+			{Name: "bytes", Value: 200, Type: blip.GAUGE, Group: map[string]string{"db": "mysql", "tbl": "user"}, Meta: map[string]string{"env": "prod", "schema": "mysql"}},
+		},
+	}
+	if diff := deep.Equal(got.Values, expect); diff != nil {
+		t.Error(diff)
+	}
+	// Input meta not modified
+	if diff := deep.Equal(in.Values["status.global"][0].Meta, map[string]string{"foo": "bar"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestHashmod(t *testing.T) {
+	// Every metric is in exactly one shard
+	const modulus = 3
+	seen := map[string]int{}
+	for shard := uint(0); shard < modulus; shard++ {
+		p, err := relabel.New([]blip.ConfigRelabelRule{
+			{Action: blip.RELABEL_HASHMOD, Domain: "size.table", Source: "group.tbl", Modulus: modulus, Shard: shard},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := p.Apply(metrics())
+		// Non-matching domain passes through to every shard
+		if len(got.Values["status.global"]) != 2 {
+			t.Errorf("shard %d: got %d status.global values, expected 2", shard, len(got.Values["status.global"]))
+		}
+		for _, v := range got.Values["size.table"] {
+			seen[v.Group["tbl"]]++
+		}
+	}
+	if diff := deep.Equal(seen, map[string]int{"t1": 1, "user": 1}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	invalid := [][]blip.ConfigRelabelRule{
+		{{Action: "bogus"}},
+		{{Action: blip.RELABEL_KEEP, Name: "("}},
+		{{Action: blip.RELABEL_TAG}},
+		{{Action: blip.RELABEL_HASHMOD, Modulus: 2, Shard: 2}},
+	}
+	for _, rules := range invalid {
+		if _, err := relabel.New(rules); err == nil {
+			t.Errorf("no error for %+v", rules)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2024 Block, Inc.
+
+package blip
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression for Level.Schedule. It has the standard
+// five fields—minute, hour, day of month, month, day of week—and supports
+// "*", lists ("1,15"), ranges ("1-5"), and steps ("*/15", "0-30/10"), plus the
+// macros @hourly, @daily, @weekly, and @monthly. Times are UTC unless the
+// expression is prefixed with a time zone like "CRON_TZ=America/New_York".
+// Like cron, if both day of month and day of week are restricted (not "*"),
+// a day matches if either field matches.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // bit sets
+	domStar, dowStar              bool
+	loc                           *time.Location
+}
+
+var scheduleMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// ParseSchedule parses a cron expression. See Schedule.
+func ParseSchedule(expr string) (*Schedule, error) {
+	s := &Schedule{loc: time.UTC}
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "CRON_TZ=") {
+		tz, rest, _ := strings.Cut(expr, " ")
+		loc, err := time.LoadLocation(strings.TrimPrefix(tz, "CRON_TZ="))
+		if err != nil {
+			return nil, err
+		}
+		s.loc = loc
+		expr = strings.TrimSpace(rest)
+	}
+	if macro, ok := scheduleMacros[expr]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%d fields, expected 5 (minute hour day-of-month month day-of-week)", len(fields))
+	}
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %s", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %s", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month: %s", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %s", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week: %s", err)
+	}
+	if s.dow&(1<<7) != 0 { // 7 = Sunday, same as 0
+		s.dow |= 1
+	}
+	s.domStar = fields[2] == "*"
+	s.dowStar = fields[4] == "*"
+	return s, nil
+}
+
+// parseCronField parses one cron field into a bit set of values min to max.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step: %s", part)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			n, err := strconv.Atoi(loStr)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value: %s", part)
+			}
+			lo, hi = n, n
+			if isRange {
+				if hi, err = strconv.Atoi(hiStr); err != nil {
+					return 0, fmt.Errorf("invalid value: %s", part)
+				}
+			} else if hasStep {
+				hi = max // "5/15" = "5-max/15"
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("out of range %d-%d: %s", min, max, part)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (s *Schedule) dayMatch(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the next scheduled time after t, or the zero time if there is
+// none in the next five years (e.g. "0 0 31 2 *").
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		prev := t
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+		case !s.dayMatch(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+		if !t.After(prev) { // DST transition
+			t = prev.Add(time.Minute)
+		}
+	}
+	return time.Time{}
+}
+
+// Period returns the shortest time between scheduled times. It's an estimate
+// (the next 10 scheduled times) used like Level.Freq to limit collection time.
+func (s *Schedule) Period() time.Duration {
+	var min time.Duration
+	t := s.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, s.loc).Add(-time.Minute))
+	for i := 0; i < 10 && !t.IsZero(); i++ {
+		next := s.Next(t)
+		if next.IsZero() {
+			break
+		}
+		if d := next.Sub(t); d < min || min == 0 {
+			min = d
+		}
+		t = next
+	}
+	return min
+}
+
+// Window is a parsed daily time window for Level.Window, like "02:00-04:00" or
+// "22:00-02:00 America/New_York". Times are UTC unless a time zone is given.
+// The start time is inclusive and the end time is exclusive.
+type Window struct {
+	start, end int // minutes since midnight
+	loc        *time.Location
+}
+
+// ParseWindow parses a daily time window. See Window.
+func ParseWindow(s string) (*Window, error) {
+	w := &Window{loc: time.UTC}
+	fields := strings.Fields(s)
+	if len(fields) < 1 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid window: %s (expected HH:MM-HH:MM [time zone])", s)
+	}
+	if len(fields) == 2 {
+		loc, err := time.LoadLocation(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		w.loc = loc
+	}
+	startStr, endStr, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid window: %s (expected HH:MM-HH:MM [time zone])", s)
+	}
+	var err error
+	if w.start, err = parseClock(startStr); err != nil {
+		return nil, err
+	}
+	if w.end, err = parseClock(endStr); err != nil {
+		return nil, err
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("invalid window: %s: start and end are equal", s)
+	}
+	return w, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time: %s (expected HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// In returns true if t is in the window. A window can span midnight, like
+// "22:00-02:00".
+func (w *Window) In(t time.Time) bool {
+	t = t.In(w.loc)
+	m := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+// End returns the first end of the window after t. If t is in the window,
+// it's when the window closes.
+func (w *Window) End(t time.Time) time.Time {
+	t = t.In(w.loc)
+	end := time.Date(t.Year(), t.Month(), t.Day(), w.end/60, w.end%60, 0, 0, w.loc)
+	if !end.After(t) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Block, Inc.
+
+package blip_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cashapp/blip"
+)
+
+func TestScheduleNext(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 30, 15, 0, time.UTC) // Monday
+	tests := []struct {
+		expr   string
+		next   time.Time
+		period time.Duration
+	}{
+		{"5 * * * *", time.Date(2024, 1, 1, 11, 5, 0, 0, time.UTC), time.Hour},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC), 15 * time.Minute},
+		{"0 2-4 * * *", time.Date(2024, 1, 2, 2, 0, 0, 0, time.UTC), time.Hour},
+		{"30 10 * * *", time.Date(2024, 1, 2, 10, 30, 0, 0, time.UTC), 24 * time.Hour},
+		{"0 0 * * 0", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC), 7 * 24 * time.Hour},
+		{"0 0 * * 7", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC), 7 * 24 * time.Hour},
+		{"@daily", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), 24 * time.Hour},
+		{"CRON_TZ=America/New_York 0 9 * * *", time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC), 24 * time.Hour},
+	}
+	for _, test := range tests {
+		s, err := blip.ParseSchedule(test.expr)
+		if err != nil {
+			t.Errorf("%s: %s", test.expr, err)
+			continue
+		}
+		if got := s.Next(now); !got.Equal(test.next) {
+			t.Errorf("%s: next %s, expected %s", test.expr, got, test.next)
+		}
+		if got := s.Period(); got != test.period {
+			t.Errorf("%s: period %s, expected %s", test.expr, got, test.period)
+		}
+	}
+
+	invalid := []string{
+		"* * * *",     // 4 fields
+		"60 * * * *",  // minute out of range
+		"* 24 * * *",  // hour out of range
+		"*/0 * * * *", // invalid step
+		"5-1 * * * *", // invalid range
+		"CRON_TZ=Nowhere/Zone * * * * *",
+	}
+	for _, expr := range invalid {
+		if _, err := blip.ParseSchedule(expr); err == nil {
+			t.Errorf("%s: no error, expected error", expr)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	w, err := blip.ParseWindow("02:00-04:00 UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := map[string]bool{"01:59": false, "02:00": true, "03:59": true, "04:00": false}
+	for clock, expect := range in {
+		tm, _ := time.Parse("15:04", clock)
+		if got := w.In(tm); got != expect {
+			t.Errorf("02:00-04:00 at %s = %t, expected %t", clock, got, expect)
+		}
+	}
+
+	// Window can span midnight
+	w, err = blip.ParseWindow("22:00-02:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in = map[string]bool{"21:59": false, "22:00": true, "00:00": true, "01:59": true, "02:00": false}
+	for clock, expect := range in {
+		tm, _ := time.Parse("15:04", clock)
+		if got := w.In(tm); got != expect {
+			t.Errorf("22:00-02:00 at %s = %t, expected %t", clock, got, expect)
+		}
+	}
+
+	// End is when the window closes, the next day if it spans midnight
+	t0 := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+	if got, expect := w.End(t0), time.Date(2024, 1, 2, 2, 0, 0, 0, time.UTC); !got.Equal(expect) {
+		t.Errorf("22:00-02:00 end at %s = %s, expected %s", t0, got, expect)
+	}
+
+	for _, s := range []string{"02:00", "02:00-02:00", "2am-4am", "02:00-04:00 Nowhere/Zone"} {
+		if _, err := blip.ParseWindow(s); err == nil {
+			t.Errorf("%s: no error, expected error", s)
+		}
+	}
+}
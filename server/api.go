@@ -4,18 +4,24 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
+	"io"
 	"net/http"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gopkg.in/yaml.v2"
 
 	"github.com/cashapp/blip"
 	"github.com/cashapp/blip/event"
+	"github.com/cashapp/blip/maintenance"
 	"github.com/cashapp/blip/metrics"
 	"github.com/cashapp/blip/monitor"
 	"github.com/cashapp/blip/sink"
@@ -28,29 +34,64 @@ type API struct {
 	// --
 	httpServer *http.Server
 	startTs    time.Time
+	events     *event.Buffer
 }
 
+// EventBufferSize is the number of recent events the API keeps for GET /events.
+var EventBufferSize = 1000
+
+// EventStreamBuffer is the number of events buffered per GET /events/stream
+// client. If a client is too slow, events are dropped, not blocked.
+var EventStreamBuffer = 100
+
 func NewAPI(cfg blip.Config, ml *monitor.Loader) *API {
 	api := &API{
 		cfg:           cfg,
 		monitorLoader: ml,
+		events:        event.NewBuffer(EventBufferSize),
 	}
+	event.Subscribe(api.events)
 
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/config", api.config)
-	mux.HandleFunc("/registered", api.registered)
-	mux.HandleFunc("/version", api.version)
-
-	mux.HandleFunc("/monitors", api.monitors)
-	mux.HandleFunc("/monitors/stop", api.monitorsStop)
-	mux.HandleFunc("/monitors/start", api.monitorsStart)
-	mux.HandleFunc("/monitors/reload", api.monitorsReload)
-
-	mux.HandleFunc("/status", api.status)
-	mux.HandleFunc("/status/monitors", api.statusMonitors)
-
-	mux.HandleFunc("/debug", api.debug)
+	read := blip.SCOPE_READ
+	admin := blip.SCOPE_ADMIN
+
+	mux.HandleFunc("/config", api.auth(read, api.config))
+	mux.HandleFunc("/registered", api.auth(read, api.registered))
+	mux.HandleFunc("/version", api.auth(read, api.version))
+
+	mux.HandleFunc("/monitors", api.methods(map[string]http.HandlerFunc{
+		http.MethodGet:    api.auth(read, api.monitors),
+		http.MethodPost:   api.auth(admin, api.monitorsAdd),
+		http.MethodPut:    api.auth(admin, api.monitorsReplace),
+		http.MethodDelete: api.auth(admin, api.monitorsRemove),
+	}))
+	mux.HandleFunc("/monitors/metrics", api.auth(read, api.monitorsMetrics))
+	mux.HandleFunc("/monitors/plan", api.methods(map[string]http.HandlerFunc{
+		http.MethodGet:    api.auth(read, api.monitorsPlan),
+		http.MethodPost:   api.auth(admin, api.monitorsPlanPin),
+		http.MethodDelete: api.auth(admin, api.monitorsPlanUnpin),
+	}))
+	mux.HandleFunc("/monitors/stop", api.auth(admin, api.monitorsStop))
+	mux.HandleFunc("/monitors/start", api.auth(admin, api.monitorsStart))
+	mux.HandleFunc("/monitors/reload", api.auth(admin, api.monitorsReload))
+
+	mux.HandleFunc("/maintenance", api.methods(map[string]http.HandlerFunc{
+		http.MethodGet:    api.auth(read, api.maintenanceList),
+		http.MethodPost:   api.auth(admin, api.maintenanceAdd),
+		http.MethodDelete: api.auth(admin, api.maintenanceRemove),
+	}))
+
+	mux.HandleFunc("/status", api.auth(read, api.status))
+	mux.HandleFunc("/status/monitors", api.auth(read, api.statusMonitors))
+
+	mux.HandleFunc("/debug", api.auth(admin, api.debug))
+
+	mux.HandleFunc("/events", api.auth(read, api.eventsSince))
+	mux.HandleFunc("/events/stream", api.auth(read, api.eventsStream))
+
+	mux.HandleFunc("/metrics", api.auth(read, promhttp.HandlerFor(newPromRegistry(ml), promhttp.HandlerOpts{}).ServeHTTP))
 
 	api.httpServer = &http.Server{
 		Addr:    cfg.API.Bind,
@@ -65,7 +106,19 @@ func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	api.httpServer.Handler.ServeHTTP(w, r)
 }
 
-// Run runs the API and restarts on error.
+// loadTLS loads the TLS config (config.api.tls), if any. It's called on boot,
+// not in Run, so that Blip fails to boot if the TLS config cannot be loaded.
+func (api *API) loadTLS() error {
+	tlsConfig, err := api.cfg.API.TLS.LoadTLS()
+	if err != nil {
+		return err
+	}
+	api.httpServer.TLSConfig = tlsConfig
+	return nil
+}
+
+// Run runs the API and restarts on error. It returns nil when the API is
+// shut down.
 func (api *API) Run() error {
 	api.startTs = time.Now()
 	errChan := make(chan error, 1)
@@ -81,7 +134,11 @@ func (api *API) Run() error {
 				errChan <- serr
 			}()
 			blip.Debug("listen")
-			serr = api.httpServer.ListenAndServe()
+			if api.httpServer.TLSConfig != nil {
+				serr = api.httpServer.ListenAndServeTLS("", "") // certs in TLSConfig
+			} else {
+				serr = api.httpServer.ListenAndServe()
+			}
 		}()
 		err := <-errChan
 		switch err {
@@ -102,10 +159,11 @@ func (api *API) Run() error {
 func (api *API) config(w http.ResponseWriter, r *http.Request) {
 	blip.Debug("%v", r)
 	q := r.URL.Query()
+	cfg := api.cfg.Redacted()
 	if q.Has("json") {
-		json.NewEncoder(w).Encode(api.cfg)
+		json.NewEncoder(w).Encode(cfg)
 	} else {
-		yaml.NewEncoder(w).Encode(api.cfg)
+		yaml.NewEncoder(w).Encode(cfg)
 	}
 }
 
@@ -148,6 +206,167 @@ func (api *API) monitors(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(ml)
 }
 
+// MaxMonitorConfigSize is the maximum size (bytes) of a monitor config sent to
+// POST or PUT /monitors.
+var MaxMonitorConfigSize int64 = 1 << 20 // 1 MiB
+
+func (api *API) monitorsAdd(w http.ResponseWriter, r *http.Request) {
+	blip.Debug("%v", r)
+	cfg, ok := monitorConfig(w, r)
+	if !ok {
+		return // monitorConfig() wrote error response
+	}
+	api.addMonitor(w, r, cfg, false)
+}
+
+func (api *API) monitorsReplace(w http.ResponseWriter, r *http.Request) {
+	blip.Debug("%v", r)
+	monitorId, _, ok := api.monitorId(w, r)
+	if !ok {
+		return // monitorId() wrote error response
+	}
+	cfg, ok := monitorConfig(w, r)
+	if !ok {
+		return // monitorConfig() wrote error response
+	}
+	if cfg.MonitorId == "" {
+		cfg.MonitorId = monitorId
+	} else if cfg.MonitorId != monitorId {
+		http.Error(w, "monitor config id does not match id in query", http.StatusBadRequest)
+		return
+	}
+	api.addMonitor(w, r, cfg, true)
+}
+
+func (api *API) addMonitor(w http.ResponseWriter, r *http.Request, cfg blip.ConfigMonitor, replace bool) {
+	ok := http.StatusCreated
+	if replace {
+		ok = http.StatusOK
+	}
+	monitorId, err := api.monitorLoader.Add(r.Context(), cfg, replace)
+	if err != nil {
+		errMsg := html.EscapeString(fmt.Sprintf("Error adding monitor: %s", err))
+		switch {
+		case errors.Is(err, monitor.ErrMonitorStart):
+			// Monitor added, so same status code as success, plus the error
+			w.WriteHeader(ok)
+			fmt.Fprintf(w, "%s\n%s", html.EscapeString(monitorId), errMsg)
+		case err == monitor.ErrMonitorExists:
+			http.Error(w, errMsg, http.StatusConflict)
+		case err == monitor.ErrMonitorNotLoaded:
+			http.Error(w, errMsg, http.StatusNotFound)
+		case errors.Is(err, monitor.ErrAPIFile):
+			http.Error(w, errMsg, http.StatusInternalServerError)
+		default:
+			http.Error(w, errMsg, http.StatusBadRequest)
+		}
+		return
+	}
+	w.WriteHeader(ok)
+	fmt.Fprint(w, html.EscapeString(monitorId))
+}
+
+func (api *API) monitorsRemove(w http.ResponseWriter, r *http.Request) {
+	blip.Debug("%v", r)
+	monitorId, _, ok := api.monitorId(w, r)
+	if !ok {
+		return // monitorId() wrote error response
+	}
+	blip.Debug("remove %s", monitorId)
+	if err := api.monitorLoader.Remove(monitorId); err != nil {
+		errMsg := html.EscapeString(fmt.Sprintf("Error removing monitor %s: %s", monitorId, err))
+		if err == monitor.ErrMonitorNotLoaded {
+			http.Error(w, errMsg, http.StatusNotFound) // removed since monitorId()
+		} else {
+			http.Error(w, errMsg, http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (api *API) monitorsMetrics(w http.ResponseWriter, r *http.Request) {
+	blip.Debug("%v", r)
+	_, mon, ok := api.monitorId(w, r)
+	if !ok {
+		return // monitorId() wrote error response
+	}
+	q := r.URL.Query()
+	n := 1 // most recent
+	if q.Has("n") {
+		var err error
+		n, err = strconv.Atoi(q.Get("n"))
+		if err != nil || n < 1 {
+			http.Error(w, "invalid n: must be an integer greater than zero", http.StatusBadRequest)
+			return
+		}
+	}
+	metrics := mon.LastMetrics(q.Get("level"))
+	if len(metrics) > n {
+		metrics = metrics[:n]
+	}
+	json.NewEncoder(w).Encode(metrics)
+}
+
+type planPin struct {
+	Plan  string     `json:"plan,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+}
+
+func (api *API) monitorsPlan(w http.ResponseWriter, r *http.Request) {
+	blip.Debug("%v", r)
+	_, mon, ok := api.monitorId(w, r)
+	if !ok {
+		return // monitorId() wrote error response
+	}
+	var pin planPin
+	if plan, until := mon.PinnedPlan(); plan != "" {
+		pin = planPin{Plan: plan, Until: &until}
+	}
+	json.NewEncoder(w).Encode(pin)
+}
+
+func (api *API) monitorsPlanPin(w http.ResponseWriter, r *http.Request) {
+	blip.Debug("%v", r)
+	monitorId, mon, ok := api.monitorId(w, r)
+	if !ok {
+		return // monitorId() wrote error response
+	}
+	q := r.URL.Query()
+	planName := q.Get("plan")
+	if planName == "" {
+		http.Error(w, "missing plan=name in query", http.StatusBadRequest)
+		return
+	}
+	ttl, err := time.ParseDuration(q.Get("ttl"))
+	if err != nil || ttl <= 0 {
+		http.Error(w, "invalid ttl: must be a duration greater than zero like 30m", http.StatusBadRequest)
+		return
+	}
+	blip.Debug("pin %s plan %s for %s", monitorId, planName, ttl)
+	if err := mon.PinPlan(planName, ttl); err != nil {
+		errMsg := html.EscapeString(fmt.Sprintf("Error pinning plan for monitor %s: %s", monitorId, err))
+		http.Error(w, errMsg, http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (api *API) monitorsPlanUnpin(w http.ResponseWriter, r *http.Request) {
+	blip.Debug("%v", r)
+	monitorId, mon, ok := api.monitorId(w, r)
+	if !ok {
+		return // monitorId() wrote error response
+	}
+	blip.Debug("unpin %s plan", monitorId)
+	if err := mon.UnpinPlan(); err != nil {
+		errMsg := html.EscapeString(fmt.Sprintf("Error unpinning plan for monitor %s: %s", monitorId, err))
+		http.Error(w, errMsg, http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
 func (api *API) monitorsReload(w http.ResponseWriter, r *http.Request) {
 	blip.Debug("%v", r)
 	if err := api.monitorLoader.Load(context.Background()); err != nil {
@@ -198,17 +417,223 @@ func (api *API) monitorsStop(w http.ResponseWriter, r *http.Request) {
 func (api *API) status(w http.ResponseWriter, r *http.Request) {
 	blip.Debug("%v", r)
 	status.Blip("uptime", "%d", int(time.Since(api.startTs).Seconds()))
+	if r.URL.Query().Has("records") {
+		json.NewEncoder(w).Encode(status.BlipRecords())
+		return
+	}
 	json.NewEncoder(w).Encode(status.ReportBlip())
 }
 
 func (api *API) statusMonitors(w http.ResponseWriter, r *http.Request) {
 	blip.Debug("%v", r)
-	json.NewEncoder(w).Encode(status.ReportMonitors())
+	q := r.URL.Query()
+	var ids []string
+	if id := q.Get("id"); id != "" {
+		ids = []string{id}
+	}
+	if q.Has("records") {
+		json.NewEncoder(w).Encode(status.MonitorRecords(ids...))
+		return
+	}
+	json.NewEncoder(w).Encode(status.ReportMonitors(ids...))
+}
+
+// --------------------------------------------------------------------------
+// Maintenance endpoints
+// --------------------------------------------------------------------------
+
+func (api *API) maintenanceList(w http.ResponseWriter, r *http.Request) {
+	blip.Debug("%v", r)
+	json.NewEncoder(w).Encode(maintenance.List())
+}
+
+func (api *API) maintenanceAdd(w http.ResponseWriter, r *http.Request) {
+	blip.Debug("%v", r)
+	var cfg blip.ConfigMaintenanceWindow
+	bytes, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxMonitorConfigSize))
+	if err != nil {
+		http.Error(w, html.EscapeString(fmt.Sprintf("Error reading maintenance window: %s", err)), http.StatusBadRequest)
+		return
+	}
+	if err := yaml.UnmarshalStrict(bytes, &cfg); err != nil {
+		http.Error(w, html.EscapeString(fmt.Sprintf("Invalid maintenance window: %s", err)), http.StatusBadRequest)
+		return
+	}
+	if cfg.Plan == "" {
+		cfg.Plan = api.cfg.Maintenance.Plan
+	}
+	if err := cfg.Validate(); err != nil {
+		http.Error(w, html.EscapeString(fmt.Sprintf("Invalid maintenance window: %s", err)), http.StatusBadRequest)
+		return
+	}
+	mw, err := maintenance.Add(maintenance.NewWindow(cfg, time.Now()))
+	if err != nil {
+		http.Error(w, html.EscapeString(fmt.Sprintf("Invalid maintenance window: %s", err)), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(mw)
+}
+
+func (api *API) maintenanceRemove(w http.ResponseWriter, r *http.Request) {
+	blip.Debug("%v", r)
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id=windowId in query", http.StatusBadRequest)
+		return
+	}
+	if !maintenance.Remove(id) {
+		http.Error(w, fmt.Sprintf("maintenance window %s not found", html.EscapeString(id)), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// --------------------------------------------------------------------------
+// Event endpoints
+// --------------------------------------------------------------------------
+
+func (api *API) eventsSince(w http.ResponseWriter, r *http.Request) {
+	blip.Debug("%v", r)
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		// Duration ago like "5m", or time like "2024-10-04T12:00:00Z"
+		if d, err := time.ParseDuration(v); err == nil {
+			since = time.Now().Add(-d)
+		} else if since, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			http.Error(w, "invalid since: must be a duration like 5m or an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(api.events.Since(since, eventFilter(r)))
+}
+
+func (api *API) eventsStream(w http.ResponseWriter, r *http.Request) {
+	blip.Debug("%v", r)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	s := event.NewStream(EventStreamBuffer, eventFilter(r))
+	event.Subscribe(s)
+	defer event.Unsubscribe(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Comment lines (":") keep the connection alive and report dropped events
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case e := <-s.Events():
+			if n := s.Dropped(); n > 0 {
+				fmt.Fprintf(w, ": dropped %d events\n\n", n)
+			}
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Event, data)
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// eventFilter returns the event filter from URL query params: id (monitor ID),
+// event (name or pattern), and errors (only error events).
+func eventFilter(r *http.Request) event.Filter {
+	q := r.URL.Query()
+	return event.Filter{
+		MonitorId: q.Get("id"),
+		Event:     q.Get("event"),
+		Errors:    q.Has("errors"),
+	}
 }
 
 // --------------------------------------------------------------------------
 // Helper funcs
 
+// auth wraps the handler to require authentication (config.api.auth) with the
+// given scope. If auth is not enabled, it returns the handler as-is. Admin scope
+// includes read scope.
+func (api *API) auth(scope string, handler http.HandlerFunc) http.HandlerFunc {
+	if !api.cfg.API.Auth.Enabled() {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientScope, ok := api.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="blip"`)
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		if scope == blip.SCOPE_ADMIN && clientScope != blip.SCOPE_ADMIN {
+			http.Error(w, "admin scope required", http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// authenticate returns the scope of the client credentials (bearer token or
+// basic auth) and true, or false if the credentials are missing or invalid.
+func (api *API) authenticate(r *http.Request) (string, bool) {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token := strings.TrimPrefix(h, "Bearer ")
+		for _, t := range api.cfg.API.Auth.Tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+				return t.Scope, true
+			}
+		}
+		return "", false
+	}
+	if username, password, ok := r.BasicAuth(); ok {
+		for _, u := range api.cfg.API.Auth.Users {
+			if u.Username == username && subtle.ConstantTimeCompare([]byte(password), []byte(u.Password)) == 1 {
+				return u.Scope, true
+			}
+		}
+	}
+	return "", false
+}
+
+// methods returns a handler that calls the handler for the request method,
+// or returns 405 (method not allowed) if there's no handler for the method.
+func (api *API) methods(handlers map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := handlers[r.Method]
+		if !ok {
+			http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// monitorConfig returns the monitor config from the request body, which is
+// YAML or JSON (YAML is a superset of JSON). Keys are the same as the Blip config
+// file; unknown keys are an error. The caller must return without doing anything
+// else on false because this func writes the HTTP error response on false.
+func monitorConfig(w http.ResponseWriter, r *http.Request) (blip.ConfigMonitor, bool) {
+	var cfg blip.ConfigMonitor
+	bytes, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxMonitorConfigSize))
+	if err != nil {
+		http.Error(w, html.EscapeString(fmt.Sprintf("Error reading monitor config: %s", err)), http.StatusBadRequest)
+		return cfg, false
+	}
+	if err := yaml.UnmarshalStrict(bytes, &cfg); err != nil {
+		http.Error(w, html.EscapeString(fmt.Sprintf("Invalid monitor config: %s", err)), http.StatusBadRequest)
+		return cfg, false
+	}
+	return cfg, true
+}
+
 // monitorId returns the monitor ID from URL query param '?id=monitorId' if set.
 // Else it returns an empty string and false. The caller must return without
 // doing anything else on false because this func writes the HTTP error response
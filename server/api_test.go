@@ -3,18 +3,27 @@
 package server_test
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cashapp/blip"
 	"github.com/cashapp/blip/aws"
 	"github.com/cashapp/blip/dbconn"
+	"github.com/cashapp/blip/event"
+	"github.com/cashapp/blip/maintenance"
 	"github.com/cashapp/blip/monitor"
 	"github.com/cashapp/blip/plan"
 	"github.com/cashapp/blip/server"
+	"github.com/cashapp/blip/status"
 	"github.com/cashapp/blip/test"
 	"github.com/cashapp/blip/test/mock"
 )
@@ -27,7 +36,10 @@ type testAPI struct {
 }
 
 func setup(t *testing.T) testAPI {
-	cfg := blip.DefaultConfig()
+	return setupConfig(t, blip.DefaultConfig())
+}
+
+func setupConfig(t *testing.T, cfg blip.Config) testAPI {
 	ml := monitor.NewLoader(monitor.LoaderArgs{
 		Config: cfg,
 		Factories: blip.Factories{
@@ -70,3 +82,354 @@ func TestAPIStatusGet(t *testing.T) {
 		t.Errorf("/status response does not have uptime: %+v", gotStatus)
 	}
 }
+
+func TestAPIStatusRecords(t *testing.T) {
+	server := setup(t)
+	defer server.ts.Close()
+
+	status.Monitor("db1", status.MONITOR, "running")
+	status.Monitor("db2", status.MONITOR, "running")
+	defer status.RemoveMonitor("db1")
+	defer status.RemoveMonitor("db2")
+
+	var got map[string]map[string]status.Record
+	statusCode, err := test.MakeHTTPRequest("GET", server.url+"/status/monitors?records&id=db1", nil, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("got HTTP status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d monitors, expected 1: %+v", len(got), got)
+	}
+	r := got["db1"][status.MONITOR]
+	if r.State != status.STATE_OK || r.Message != "running" || len(r.History) != 1 {
+		t.Errorf("got record %+v", r)
+	}
+
+	var gotBlip map[string]status.Record
+	if _, err := test.MakeHTTPRequest("GET", server.url+"/status?records", nil, &gotBlip); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := gotBlip["uptime"]; !ok {
+		t.Errorf("/status?records response does not have uptime: %+v", gotBlip)
+	}
+}
+
+func TestAPIMetrics(t *testing.T) {
+	server := setup(t)
+	defer server.ts.Close()
+
+	resp, err := http.Get(server.url + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got HTTP status = %d, expected %d", resp.StatusCode, http.StatusOK)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{
+		`blip_info{version="` + blip.VERSION + `"} 1`,
+		"blip_monitors_loaded 0",
+		"blip_monitors_running 0",
+		"blip_monitors_errored 0",
+		"go_goroutines ",
+	} {
+		if !strings.Contains(string(body), expect) {
+			t.Errorf("/metrics response does not have %q:\n%s", expect, body)
+		}
+	}
+}
+
+func TestAPIAuth(t *testing.T) {
+	cfg := blip.DefaultConfig()
+	cfg.API.Auth = blip.ConfigAPIAuth{
+		Tokens: []blip.ConfigAPIToken{
+			{Token: "read-token", Scope: blip.SCOPE_READ},
+			{Token: "admin-token", Scope: blip.SCOPE_ADMIN},
+		},
+		Users: []blip.ConfigAPIUser{
+			{Username: "ops", Password: "ops-pass", Scope: blip.SCOPE_READ},
+		},
+	}
+	server := setupConfig(t, cfg)
+	defer server.ts.Close()
+
+	tests := []struct {
+		path   string
+		auth   func(*http.Request)
+		status int
+	}{
+		{"/version", func(*http.Request) {}, http.StatusUnauthorized},
+		{"/version", func(r *http.Request) { r.Header.Set("Authorization", "Bearer bad") }, http.StatusUnauthorized},
+		{"/version", func(r *http.Request) { r.Header.Set("Authorization", "Bearer read-token") }, http.StatusOK},
+		{"/version", func(r *http.Request) { r.SetBasicAuth("ops", "ops-pass") }, http.StatusOK},
+		{"/version", func(r *http.Request) { r.SetBasicAuth("ops", "bad") }, http.StatusUnauthorized},
+		{"/debug", func(r *http.Request) { r.Header.Set("Authorization", "Bearer read-token") }, http.StatusForbidden},
+		{"/debug", func(r *http.Request) { r.SetBasicAuth("ops", "ops-pass") }, http.StatusForbidden},
+		{"/debug", func(r *http.Request) { r.Header.Set("Authorization", "Bearer admin-token") }, http.StatusOK},
+		{"/metrics", func(*http.Request) {}, http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		req, _ := http.NewRequest("GET", server.url+tc.path, nil)
+		tc.auth(req)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s %v: got HTTP status %d, expected %d", tc.path, req.Header, resp.StatusCode, tc.status)
+		}
+	}
+	blip.Debugging = false // toggled by /debug
+}
+
+func TestAPIConfigRedacted(t *testing.T) {
+	cfg := blip.DefaultConfig()
+	cfg.MySQL.Password = "secret"
+	cfg.Sinks = blip.ConfigSinks{"signalfx": {"auth-token": "secret"}}
+	server := setupConfig(t, cfg)
+	defer server.ts.Close()
+
+	resp, err := http.Get(server.url + "/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if strings.Contains(string(body), "secret") {
+		t.Errorf("/config response has secret:\n%s", body)
+	}
+}
+
+func TestAPIEvents(t *testing.T) {
+	server := setup(t)
+	defer server.ts.Close()
+	defer event.RemoveSubscribers()
+
+	// Stream events for db1 errors only
+	resp, err := http.Get(server.url + "/events/stream?id=db1&errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("got Content-Type %s, expected text/event-stream", ct)
+	}
+
+	m := event.MonitorReceiver{MonitorId: "db1"}
+	m.Sendf(event.CHANGE_PLAN, "not an error")
+	event.Errorf(event.SERVER_API_ERROR, "not db1")
+	m.Errorf(event.ENGINE_COLLECT_ERROR, "test error")
+
+	lines := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	expect := []string{"event: " + event.ENGINE_COLLECT_ERROR, "data: "}
+	for _, prefix := range expect {
+		select {
+		case line := <-lines:
+			if !strings.HasPrefix(line, prefix) {
+				t.Errorf("got line %q, expected prefix %q", line, prefix)
+			}
+			if strings.HasPrefix(line, "data: ") {
+				var e event.Event
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+					t.Fatal(err)
+				}
+				if e.MonitorId != "db1" || e.Message != "test error" || !e.Error {
+					t.Errorf("wrong event: %+v", e)
+				}
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for event stream")
+		}
+	}
+
+	// Recent events, filtered by monitor ID
+	var got []event.Event
+	statusCode, err := test.MakeHTTPRequest("GET", server.url+"/events?since=1m&id=db1", nil, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("got HTTP status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if len(got) != 2 || got[0].Event != event.CHANGE_PLAN || got[1].Event != event.ENGINE_COLLECT_ERROR {
+		t.Errorf("got events %+v, expected %s and %s", got, event.CHANGE_PLAN, event.ENGINE_COLLECT_ERROR)
+	}
+
+	statusCode, _ = test.MakeHTTPRequest("GET", server.url+"/events?since=yesterday", nil, nil)
+	if statusCode != http.StatusBadRequest {
+		t.Errorf("got HTTP status = %d for invalid since, expected %d", statusCode, http.StatusBadRequest)
+	}
+}
+
+// setupMockMonitors returns a monitor loader that uses mock DBs and doesn't
+// run monitors, and an API test server using the loader.
+func setupMockMonitors(t *testing.T) (*monitor.Loader, *httptest.Server) {
+	cfg := blip.DefaultConfig()
+	cfg.MonitorLoader.Local.DisableAuto = true
+	ml := monitor.NewLoader(monitor.LoaderArgs{
+		Config:    cfg,
+		Factories: blip.Factories{DbConn: mock.DbFactory{}},
+		Plugins: blip.Plugins{
+			StartMonitor: func(blip.ConfigMonitor) bool { return false }, // don't run monitors
+		},
+		PlanLoader: plan.NewLoader(nil),
+	})
+	return ml, httptest.NewServer(server.NewAPI(cfg, ml))
+}
+
+func TestAPIMonitorsAdd(t *testing.T) {
+	ml, ts := setupMockMonitors(t)
+	defer ts.Close()
+
+	// POST with YAML or JSON body
+	statusCode, err := test.MakeHTTPRequest("POST", ts.URL+"/monitors", []byte("id: db1\nhostname: db1.local\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusCreated {
+		t.Errorf("POST: got HTTP status = %d, expected %d", statusCode, http.StatusCreated)
+	}
+	statusCode, _ = test.MakeHTTPRequest("POST", ts.URL+"/monitors", []byte(`{"hostname": "db2.local"}`), nil)
+	if statusCode != http.StatusCreated {
+		t.Errorf("POST JSON: got HTTP status = %d, expected %d", statusCode, http.StatusCreated)
+	}
+	var got map[string]string
+	test.MakeHTTPRequest("GET", ts.URL+"/monitors", nil, &got)
+	_, ok1 := got["db1"]
+	_, ok2 := got["db2.local"]
+	if len(got) != 2 || !ok1 || !ok2 {
+		t.Errorf("GET /monitors returned %v, expected db1 and db2.local", got)
+	}
+
+	// Errors
+	tests := []struct {
+		method string
+		url    string
+		body   string
+		status int
+	}{
+		{"POST", "/monitors", "id: db1\nhostname: db1.local\n", http.StatusConflict},         // already loaded
+		{"POST", "/monitors", "id: db3\nfoo: bar\n", http.StatusBadRequest},                  // unknown key
+		{"PUT", "/monitors?id=db3", "hostname: db3.local\n", http.StatusNotFound},            // not loaded
+		{"PUT", "/monitors?id=db1", "id: db2\nhostname: db1.local\n", http.StatusBadRequest}, // id mismatch
+		{"DELETE", "/monitors?id=db3", "", http.StatusNotFound},
+		{"PATCH", "/monitors", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		statusCode, _ = test.MakeHTTPRequest(tt.method, ts.URL+tt.url, []byte(tt.body), nil)
+		if statusCode != tt.status {
+			t.Errorf("%s %s: got HTTP status = %d, expected %d", tt.method, tt.url, statusCode, tt.status)
+		}
+	}
+
+	// PUT replaces, DELETE removes
+	statusCode, _ = test.MakeHTTPRequest("PUT", ts.URL+"/monitors?id=db1", []byte("hostname: db1-new.local\n"), nil)
+	if statusCode != http.StatusOK {
+		t.Errorf("PUT: got HTTP status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if h := ml.Monitor("db1").Config().Hostname; h != "db1-new.local" {
+		t.Errorf("PUT did not replace monitor: got hostname %s, expected db1-new.local", h)
+	}
+	statusCode, _ = test.MakeHTTPRequest("DELETE", ts.URL+"/monitors?id=db1", nil, nil)
+	if statusCode != http.StatusOK {
+		t.Errorf("DELETE: got HTTP status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if ml.Monitor("db1") != nil {
+		t.Error("DELETE did not remove monitor")
+	}
+}
+
+func TestAPIMonitorsPlan(t *testing.T) {
+	ml, ts := setupMockMonitors(t)
+	defer ts.Close()
+	if _, err := ml.Add(context.Background(), blip.ConfigMonitor{MonitorId: "db1", Hostname: "db1.local"}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// No plan pinned
+	var got map[string]string
+	statusCode, err := test.MakeHTTPRequest("GET", ts.URL+"/monitors/plan?id=db1", nil, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK || len(got) != 0 {
+		t.Errorf("got HTTP status = %d and %v, expected %d and no pin", statusCode, got, http.StatusOK)
+	}
+
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{"/monitors/plan?id=db1&ttl=30m", http.StatusBadRequest},            // no plan
+		{"/monitors/plan?id=db1&plan=debug", http.StatusBadRequest},         // no ttl
+		{"/monitors/plan?id=db1&plan=debug&ttl=-1m", http.StatusBadRequest}, // invalid ttl
+		{"/monitors/plan?id=db2&plan=debug&ttl=30m", http.StatusNotFound},   // not loaded
+		{"/monitors/plan?id=db1&plan=debug&ttl=30m", http.StatusConflict},   // not running
+	}
+	for _, tt := range tests {
+		statusCode, _ = test.MakeHTTPRequest("POST", ts.URL+tt.url, nil, nil)
+		if statusCode != tt.status {
+			t.Errorf("POST %s: got HTTP status = %d, expected %d", tt.url, statusCode, tt.status)
+		}
+	}
+
+	// Unpin is a noop if no plan is pinned
+	statusCode, _ = test.MakeHTTPRequest("DELETE", ts.URL+"/monitors/plan?id=db1", nil, nil)
+	if statusCode != http.StatusOK {
+		t.Errorf("DELETE: got HTTP status = %d, expected %d", statusCode, http.StatusOK)
+	}
+}
+
+func TestAPIMaintenance(t *testing.T) {
+	server := setup(t)
+	defer server.ts.Close()
+	defer maintenance.RemoveAll()
+
+	var w maintenance.Window
+	statusCode, err := test.MakeHTTPRequest("POST", server.url+"/maintenance", []byte(`{"monitors": ["db1"], "duration": "1h", "reason": "upgrade"}`), &w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Fatalf("got HTTP status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if w.Id == "" || w.End.Sub(w.Start) != time.Hour || w.Reason != "upgrade" {
+		t.Errorf("wrong window: %+v", w)
+	}
+
+	var list []maintenance.Window
+	test.MakeHTTPRequest("GET", server.url+"/maintenance", nil, &list)
+	if len(list) != 1 || list[0].Id != w.Id {
+		t.Errorf("GET /maintenance returned %+v, expected window %s", list, w.Id)
+	}
+
+	for _, body := range []string{`{"duration": "1h"}`, `{"monitors": ["db1"]}`, `{"monitors": ["db1"], "foo": 1}`} {
+		statusCode, _ = test.MakeHTTPRequest("POST", server.url+"/maintenance", []byte(body), nil)
+		if statusCode != http.StatusBadRequest {
+			t.Errorf("POST %s: got HTTP status = %d, expected %d", body, statusCode, http.StatusBadRequest)
+		}
+	}
+
+	statusCode, _ = test.MakeHTTPRequest("DELETE", server.url+"/maintenance?id="+w.Id, nil, nil)
+	if statusCode != http.StatusOK {
+		t.Errorf("DELETE: got HTTP status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	statusCode, _ = test.MakeHTTPRequest("DELETE", server.url+"/maintenance?id="+w.Id, nil, nil)
+	if statusCode != http.StatusNotFound {
+		t.Errorf("DELETE again: got HTTP status = %d, expected %d", statusCode, http.StatusNotFound)
+	}
+}
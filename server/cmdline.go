@@ -13,16 +13,23 @@ import (
 
 // Options represents typical command line options: --addr, --config, etc.
 type Options struct {
+	CollectOnce   bool   `arg:"--collect-once"`
 	Config        string `arg:"env:BLIP_CONFIG"`
 	Debug         bool   `arg:"env:BLIP_DEBUG"`
+	Doctor        bool   `arg:"--doctor"`
 	Help          bool
-	Log           bool `arg:"env:BLIP_LOG"`
-	PrintConfig   bool `arg:"--print-config"`
-	PrintDomains  bool `arg:"--print-domains"`
-	PrintMonitors bool `arg:"--print-monitors"`
-	PrintPlans    bool `arg:"--print-plans"`
-	Run           bool `arg:"env:BLIP_RUN" default:"true"`
-	Version       bool `arg:"-v"`
+	Interval      uint   `arg:"--interval"`
+	JSON          bool   `arg:"--json"`
+	Level         string `arg:"--level"`
+	Log           bool   `arg:"env:BLIP_LOG"`
+	Monitor       string `arg:"--monitor"`
+	Plan          string `arg:"--plan"`
+	PrintConfig   bool   `arg:"--print-config"`
+	PrintDomains  bool   `arg:"--print-domains"`
+	PrintMonitors bool   `arg:"--print-monitors"`
+	PrintPlans    bool   `arg:"--print-plans"`
+	Run           bool   `arg:"env:BLIP_RUN" default:"true"`
+	Version       bool   `arg:"-v"`
 }
 
 // CommandLine represents options (--addr, etc.) and args: entity type, return
@@ -62,13 +69,21 @@ func printHelp() {
 	fmt.Printf("Usage:\n"+
 		"  blip [options]\n\n"+
 		"Options:\n"+
+		"  --collect-once   Collect metrics once, print them, then exit\n"+
 		"  --config         Config file (default: %s)\n"+
 		"  --debug          Print debug to stderr\n"+
+		"  --doctor         Check monitors against their plans, then exit\n"+
 		"  --help           Print help and exit\n"+
+		"  --interval       Collect twice N seconds apart (--collect-once)\n"+
+		"  --json           Print metrics as JSON (--collect-once)\n"+
+		"  --level          Level to collect (--collect-once)\n"+
 		"  --log            Log info events to STDOUT\n"+
+		"  --monitor        Monitor ID to collect (--collect-once)\n"+
+		"  --plan           Plan to collect (--collect-once)\n"+
 		"  --print-config   Print config on boot\n"+
 		"  --print-domains  Print metric domains\n"+
 		"  --print-monitors Print monitors on boot\n"+
+		"  --print-plans    Print plans on boot\n"+
 		"  --run            Run monitors (if false, boot then exit)\n"+
 		"  --version        Print version and exit\n"+
 		"\n"+
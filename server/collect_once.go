@@ -0,0 +1,159 @@
+// Copyright 2024 Block, Inc.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/monitor"
+	"github.com/cashapp/blip/plan"
+)
+
+// collectOnce runs monitor.CollectOnce for --collect-once and prints the metrics.
+// If --monitor isn't specified, there must be only one monitor.
+func collectOnce(opts Options, monitors []*monitor.Monitor, dbMaker blip.DbFactory, planLoader *plan.Loader) error {
+	var mon *monitor.Monitor
+	if opts.Monitor == "" {
+		if len(monitors) != 1 {
+			return fmt.Errorf("%d monitors loaded; specify --monitor", len(monitors))
+		}
+		mon = monitors[0]
+	} else {
+		for _, m := range monitors {
+			if m.MonitorId() == opts.Monitor {
+				mon = m
+				break
+			}
+		}
+		if mon == nil {
+			return fmt.Errorf("monitor %s not loaded", opts.Monitor)
+		}
+	}
+
+	all, err := monitor.CollectOnce(context.Background(), monitor.CollectOnceArgs{
+		Config:     mon.Config(),
+		DbMaker:    dbMaker,
+		PlanLoader: planLoader,
+		Plan:       opts.Plan,
+		Level:      opts.Level,
+		Interval:   time.Duration(opts.Interval) * time.Second,
+	})
+	if len(all) > 0 {
+		if opts.JSON {
+			printMetricsJSON(os.Stdout, all)
+		} else {
+			printMetricsTable(os.Stdout, all)
+		}
+	}
+	return err
+}
+
+// printMetricsJSON prints all collections as one JSON array of blip.Metrics.
+func printMetricsJSON(w io.Writer, all [][]*blip.Metrics) {
+	flat := []*blip.Metrics{}
+	for _, metrics := range all {
+		flat = append(flat, metrics...)
+	}
+	bytes, err := json.MarshalIndent(flat, "", "  ")
+	if err != nil {
+		fmt.Fprintln(w, err) // shouldn't happen
+		return
+	}
+	fmt.Fprintln(w, string(bytes))
+}
+
+// printMetricsTable prints each collection as a table of metrics sorted by
+// domain, metric name, and group. If there are two collections, the second
+// table has a DELTA column for cumulative counters.
+func printMetricsTable(w io.Writer, all [][]*blip.Metrics) {
+	var prev map[string]float64
+	for _, metrics := range all {
+		cur := map[string]float64{}
+		for _, m := range metrics {
+			fmt.Fprintf(w, "# %s\n", m)
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			if prev == nil {
+				fmt.Fprintln(tw, "DOMAIN\tMETRIC\tTYPE\tVALUE\tGROUP\tMETA")
+			} else {
+				fmt.Fprintln(tw, "DOMAIN\tMETRIC\tTYPE\tVALUE\tDELTA\tGROUP\tMETA")
+			}
+			domains := make([]string, 0, len(m.Values))
+			for domain := range m.Values {
+				domains = append(domains, domain)
+			}
+			sort.Strings(domains)
+			for _, domain := range domains {
+				values := m.Values[domain]
+				sort.SliceStable(values, func(i, j int) bool {
+					if values[i].Name != values[j].Name {
+						return values[i].Name < values[j].Name
+					}
+					return tuples(values[i].Group) < tuples(values[j].Group)
+				})
+				for _, v := range values {
+					group := tuples(v.Group)
+					key := domain + "." + v.Name + " " + group
+					cur[key] = v.Value
+					if prev == nil {
+						fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", domain, v.Name, metricType(v.Type), formatValue(v.Value), group, tuples(v.Meta))
+						continue
+					}
+					delta := ""
+					if last, ok := prev[key]; ok && v.Type == blip.CUMULATIVE_COUNTER {
+						delta = formatValue(v.Value - last)
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", domain, v.Name, metricType(v.Type), formatValue(v.Value), delta, group, tuples(v.Meta))
+				}
+			}
+			tw.Flush()
+			fmt.Fprintln(w)
+		}
+		prev = cur
+	}
+}
+
+func metricType(t byte) string {
+	switch t {
+	case blip.CUMULATIVE_COUNTER:
+		return "counter"
+	case blip.DELTA_COUNTER:
+		return "delta"
+	case blip.GAUGE:
+		return "gauge"
+	case blip.BOOL:
+		return "bool"
+	case blip.EVENT:
+		return "event"
+	}
+	return "unknown"
+}
+
+func formatValue(v float64) string {
+	if v == float64(int64(v)) {
+		return fmt.Sprintf("%d", int64(v))
+	}
+	return fmt.Sprintf("%f", v)
+}
+
+// tuples returns k=v pairs sorted by key, like "db=test,tbl=t1".
+func tuples(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + m[k]
+	}
+	return strings.Join(pairs, ",")
+}
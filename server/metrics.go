@@ -0,0 +1,137 @@
+// Copyright 2024 Block, Inc.
+
+package server
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/health"
+	"github.com/cashapp/blip/monitor"
+)
+
+// Blip server metrics reported by the API GET /metrics.
+var (
+	promBlipInfo = prometheus.NewDesc(
+		"blip_info", "Blip version", []string{"version"}, nil)
+	promMonitorsLoaded = prometheus.NewDesc(
+		"blip_monitors_loaded", "Number of monitors loaded", nil, nil)
+	promMonitorsRunning = prometheus.NewDesc(
+		"blip_monitors_running", "Number of monitors running", nil, nil)
+	promMonitorsErrored = prometheus.NewDesc(
+		"blip_monitors_errored", "Number of monitors with an error", nil, nil)
+
+	promMonitorUp = prometheus.NewDesc(
+		"blip_monitor_up", "1 if the monitor is running, else 0", []string{"monitor_id"}, nil)
+	promMonitorError = prometheus.NewDesc(
+		"blip_monitor_error", "1 if the monitor has an error, else 0", []string{"monitor_id"}, nil)
+	promMonitorMaintenance = prometheus.NewDesc(
+		"blip_monitor_maintenance", "1 if the monitor is in a maintenance window, else 0", []string{"monitor_id"}, nil)
+	promMonitorPlan = prometheus.NewDesc(
+		"blip_monitor_plan_info", "Current state and plan set by the plan changer", []string{"monitor_id", "state", "plan"}, nil)
+	promMonitorLastCollect = prometheus.NewDesc(
+		"blip_monitor_last_collect_timestamp_seconds", "Unix time of the last successful collection", []string{"monitor_id", "level"}, nil)
+
+	promSinkSends = prometheus.NewDesc(
+		"blip_sink_sends_total", "Sends to the sink", []string{"monitor_id", "sink"}, nil)
+	promSinkErrors = prometheus.NewDesc(
+		"blip_sink_errors_total", "Sink send errors", []string{"monitor_id", "sink"}, nil)
+	promRetryBuffer = prometheus.NewDesc(
+		"blip_sink_retry_buffer", "Metrics buffered by the sink retry buffer", []string{"monitor_id", "sink"}, nil)
+	promRetryDrops = prometheus.NewDesc(
+		"blip_sink_retry_drops_total", "Metrics dropped because the retry buffer is full", []string{"monitor_id", "sink"}, nil)
+	promRetryErrors = prometheus.NewDesc(
+		"blip_sink_retry_errors_total", "Retry errors sending to the sink", []string{"monitor_id", "sink"}, nil)
+)
+
+// promServer is a Prometheus collector for Blip server and monitor internals.
+// Values are read from the health package on scrape.
+type promServer struct {
+	monitorLoader *monitor.Loader
+}
+
+var _ prometheus.Collector = promServer{}
+
+// newPromRegistry returns a Prometheus registry with Go runtime and process
+// metrics, and Blip server metrics (promServer).
+func newPromRegistry(ml *monitor.Loader) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		promServer{monitorLoader: ml},
+	)
+	return reg
+}
+
+func (p promServer) Describe(descs chan<- *prometheus.Desc) {
+	descs <- promBlipInfo
+	descs <- promMonitorsLoaded
+	descs <- promMonitorsRunning
+	descs <- promMonitorsErrored
+	descs <- promMonitorUp
+	descs <- promMonitorError
+	descs <- promMonitorMaintenance
+	descs <- promMonitorPlan
+	descs <- promMonitorLastCollect
+	descs <- promSinkSends
+	descs <- promSinkErrors
+	descs <- promRetryBuffer
+	descs <- promRetryDrops
+	descs <- promRetryErrors
+}
+
+func (p promServer) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(promBlipInfo, prometheus.GaugeValue, 1, blip.VERSION)
+
+	monitors := p.monitorLoader.Monitors()
+	running := 0
+	errored := 0
+	for _, mon := range monitors {
+		id := mon.MonitorId()
+		h := health.Get(id).Snapshot()
+
+		if h.Running {
+			running++
+		}
+		ch <- prometheus.MustNewConstMetric(promMonitorUp, prometheus.GaugeValue, b2f(h.Running), id)
+
+		if h.Error != "" {
+			errored++
+		}
+		ch <- prometheus.MustNewConstMetric(promMonitorError, prometheus.GaugeValue, b2f(h.Error != ""), id)
+
+		ch <- prometheus.MustNewConstMetric(promMonitorMaintenance, prometheus.GaugeValue, b2f(h.Maintenance), id)
+
+		if h.Plan != "" {
+			ch <- prometheus.MustNewConstMetric(promMonitorPlan, prometheus.GaugeValue, 1, id, h.State, h.Plan)
+		}
+
+		for level, ts := range h.LastCollect {
+			ch <- prometheus.MustNewConstMetric(promMonitorLastCollect, prometheus.GaugeValue, float64(ts.UnixMilli())/1000, id, level)
+		}
+
+		for name, s := range h.Sinks {
+			ch <- prometheus.MustNewConstMetric(promSinkSends, prometheus.CounterValue, float64(s.Sends), id, name)
+			ch <- prometheus.MustNewConstMetric(promSinkErrors, prometheus.CounterValue, float64(s.Errors), id, name)
+			if !s.Retry {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(promRetryBuffer, prometheus.GaugeValue, float64(s.RetryBuffer), id, name)
+			ch <- prometheus.MustNewConstMetric(promRetryDrops, prometheus.CounterValue, float64(s.RetryDrops), id, name)
+			ch <- prometheus.MustNewConstMetric(promRetryErrors, prometheus.CounterValue, float64(s.RetryErrors), id, name)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(promMonitorsLoaded, prometheus.GaugeValue, float64(len(monitors)))
+	ch <- prometheus.MustNewConstMetric(promMonitorsRunning, prometheus.GaugeValue, float64(running))
+	ch <- prometheus.MustNewConstMetric(promMonitorsErrored, prometheus.GaugeValue, float64(errored))
+}
+
+func b2f(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
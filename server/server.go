@@ -14,9 +14,11 @@ import (
 	"time"
 
 	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/aggregate"
 	"github.com/cashapp/blip/aws"
 	"github.com/cashapp/blip/dbconn"
 	"github.com/cashapp/blip/event"
+	"github.com/cashapp/blip/maintenance"
 	"github.com/cashapp/blip/metrics"
 	"github.com/cashapp/blip/monitor"
 	"github.com/cashapp/blip/plan"
@@ -74,6 +76,9 @@ type Server struct {
 	cmdline       CommandLine
 	planLoader    *plan.Loader
 	monitorLoader *monitor.Loader
+	aggregator    *aggregate.Aggregator
+	scheduler     *monitor.Scheduler
+	webhooks      []*event.Webhook
 	api           *API
 }
 
@@ -162,6 +167,7 @@ func (s *Server) Boot(env blip.Env, plugins blip.Plugins, factories blip.Factori
 		event.Errorf(event.BOOT_CONFIG_INVALID, err.Error())
 		return err
 	}
+	event.SetLogFormat(s.cfg.Events.LogFormat)
 	event.Send(event.BOOT_CONFIG_LOADED)
 
 	if s.cmdline.Options.PrintConfig {
@@ -184,6 +190,18 @@ func (s *Server) Boot(env blip.Env, plugins blip.Plugins, factories blip.Factori
 	sink.InitFactory(factories)
 	metrics.InitFactory(factories)
 
+	// Subscribe event webhooks now to queue boot events. They're started in Run.
+	for i, cfg := range s.cfg.Events.Webhooks {
+		client, err := factories.HTTPClient.MakeForSink("webhook", "", nil, nil)
+		if err != nil {
+			event.Sendf(event.BOOT_ERROR, "config.events.webhooks[%d]: %s", i, err)
+			return err
+		}
+		wh := event.NewWebhook(cfg, client)
+		event.Subscribe(wh)
+		s.webhooks = append(s.webhooks, wh)
+	}
+
 	// ----------------------------------------------------------------------
 	// Load level plans
 	status.Blip(status.SERVER, "boot: loading plans")
@@ -206,6 +224,31 @@ func (s *Server) Boot(env blip.Env, plugins blip.Plugins, factories blip.Factori
 	// Load monitors
 	status.Blip(status.SERVER, "boot: load monitors")
 
+	// Create the aggregator for cross-monitor rollups, if any, before monitors
+	// because member monitors send metrics to it. It's started in Run.
+	if len(s.cfg.Aggregate) > 0 {
+		s.aggregator, err = aggregate.New(s.cfg)
+		if err != nil {
+			event.Sendf(event.BOOT_ERROR, err.Error())
+			return err
+		}
+	}
+
+	// Create the shared scheduler, unless disabled, before monitors because
+	// they subscribe to it. It's started in Run.
+	if !s.cfg.Scheduler.Disable {
+		s.scheduler = monitor.NewScheduler(s.cfg.Scheduler)
+	}
+
+	// Add maintenance windows from the config file before monitors because
+	// monitors check for windows when started
+	for _, cfg := range s.cfg.Maintenance.Windows {
+		if _, err := maintenance.Add(maintenance.NewWindow(cfg, startTs)); err != nil {
+			event.Sendf(event.BOOT_ERROR, err.Error())
+			return err
+		}
+	}
+
 	// Create, but don't start, database monitors. They're started later in Run.
 	s.monitorLoader = monitor.NewLoader(monitor.LoaderArgs{
 		Config:     s.cfg,
@@ -213,6 +256,8 @@ func (s *Server) Boot(env blip.Env, plugins blip.Plugins, factories blip.Factori
 		Plugins:    plugins,
 		PlanLoader: s.planLoader,
 		RDSLoader:  aws.RDSLoader{ClientFactory: aws.NewRDSClientFactory(factories.AWSConfig)},
+		Aggregator: s.aggregator,
+		Scheduler:  s.scheduler,
 	})
 	if err := s.monitorLoader.Load(context.Background()); err != nil {
 		event.Sendf(event.BOOT_ERROR, err.Error())
@@ -223,10 +268,36 @@ func (s *Server) Boot(env blip.Env, plugins blip.Plugins, factories blip.Factori
 		fmt.Println(s.monitorLoader.Print())
 	}
 
+	if s.cmdline.Options.Doctor {
+		ok := true
+		for _, d := range s.monitorLoader.Doctor(context.Background()) {
+			fmt.Print(d.String())
+			if !d.OK() {
+				ok = false
+			}
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if s.cmdline.Options.CollectOnce {
+		if err := collectOnce(s.cmdline.Options, s.monitorLoader.Monitors(), factories.DbConn, s.planLoader); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// ----------------------------------------------------------------------
 	// API
 	if !s.cfg.API.Disable {
 		s.api = NewAPI(s.cfg, s.monitorLoader)
+		if err := s.api.loadTLS(); err != nil {
+			event.Sendf(event.BOOT_ERROR, err.Error())
+			return err
+		}
 	} else {
 		blip.Debug("API disabled")
 	}
@@ -242,6 +313,22 @@ func (s *Server) Run(stopChan, doneChan chan struct{}) error {
 	if !s.cmdline.Options.Run {
 		return nil
 	}
+	// Run event webhooks until the server stops. Stop them last (first defer)
+	// so they send the final events, like server-stopped. They're stopped
+	// together, so stop waits for the longest webhook timeout, not the sum.
+	whStopChan := make(chan struct{})
+	whDoneChans := make([]chan struct{}, len(s.webhooks))
+	for i, wh := range s.webhooks {
+		whDoneChans[i] = make(chan struct{})
+		go wh.Run(whStopChan, whDoneChans[i])
+	}
+	defer func() {
+		close(whStopChan)
+		for _, whDoneChan := range whDoneChans {
+			<-whDoneChan
+		}
+	}()
+
 	event.Send(event.SERVER_RUN)
 
 	stopReason := "unknown"
@@ -249,11 +336,31 @@ func (s *Server) Run(stopChan, doneChan chan struct{}) error {
 		event.Errorf(event.SERVER_STOPPED, stopReason)
 	}()
 
+	// Run scheduler, if any, until the server stops. Start it before monitors
+	// so they don't wait for their first tick.
+	if s.scheduler != nil {
+		schedStopChan := make(chan struct{})
+		defer close(schedStopChan)
+		go s.scheduler.Run(schedStopChan, make(chan struct{}))
+	}
+
 	// Start all monitors. Then if config.monitor-load.freq is specified, start
 	// periodical monitor reloading.
 	status.Blip(status.SERVER, "starting monitors")
 	s.monitorLoader.StartMonitors()
 
+	// Run maintenance window checks for all monitors until the server stops
+	maintStopChan := make(chan struct{})
+	defer close(maintStopChan)
+	go s.monitorLoader.RunMaintenance(maintStopChan, make(chan struct{}))
+
+	// Run aggregator, if any, until the server stops
+	if s.aggregator != nil {
+		aggStopChan := make(chan struct{})
+		defer close(aggStopChan)
+		go s.aggregator.Run(aggStopChan, make(chan struct{}))
+	}
+
 	// Run API, restart on panic
 	if !s.cfg.API.Disable {
 		go s.api.Run()
@@ -3,6 +3,9 @@
 package server_test
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/cashapp/blip/server"
@@ -39,3 +42,31 @@ func TestServerBootCheck(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestServerBootAPITLSError(t *testing.T) {
+	// Boot fails if the API TLS config can't be loaded, not later in Run
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	key := filepath.Join(dir, "key.pem")
+	cfgFile := filepath.Join(dir, "blip.yaml")
+	for file, content := range map[string]string{
+		cert:    "not a cert",
+		key:     "not a key",
+		cfgFile: "api:\n  tls:\n    cert: " + cert + "\n    key: " + key + "\n",
+	} {
+		if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := server.Server{}
+	env, plugins, factories := server.Defaults()
+	env.Args = []string{"--config", cfgFile, "--run=false"}
+	err := s.Boot(env, plugins, factories)
+	if err == nil {
+		t.Fatal("no error, expected api.tls error")
+	}
+	if !strings.HasPrefix(err.Error(), "api.tls:") {
+		t.Errorf("got error %q, expected api.tls error", err)
+	}
+}
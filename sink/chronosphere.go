@@ -90,7 +90,7 @@ func (s *Chronosphere) Send(ctx context.Context, m *blip.Metrics) (lerr error) {
 			status.Monitor(s.monitorId, "chronosphere", "last sent %d metrics at %s", n, time.Now())
 		} else {
 			s.event.Errorf(event.SINK_SEND_ERROR, lerr.Error())
-			status.Monitor(s.monitorId, "chronosphere", "error on last send at %s: %s", time.Now(), lerr)
+			status.MonitorState(s.monitorId, "chronosphere", status.STATE_ERROR, "error on last send at %s: %s", time.Now(), lerr)
 		}
 	}()
 
@@ -180,8 +180,9 @@ func (s *Chronosphere) Send(ctx context.Context, m *blip.Metrics) (lerr error) {
 					},
 				}
 			default:
-				// Chronosphere (or OpenMetrics) doesn't support this (includes DELTA_COUNTER) Blip metric type, so skip it
-				// TODO: Either error out or maintain cumulative value from delta
+				// OpenMetrics doesn't support this Blip metric type, so skip it.
+				// DELTA_COUNTER isn't received: the factory wraps this sink in
+				// a Cumulative sink that converts deltas to cumulative counters.
 				continue METRICS
 			}
 
@@ -0,0 +1,91 @@
+// Copyright 2024 Block, Inc.
+
+package sink
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cashapp/blip"
+)
+
+// The Cumulative sink is the reverse of the Delta sink: it converts DELTA_COUNTER
+// metrics to CUMULATIVE_COUNTER metrics by keeping a running total of every
+// delta counter. It wraps sinks that only support cumulative counters, like
+// OpenMetrics, so plan levels can set counters: delta (blip.Level.Counters)
+// without the sink dropping the counters. The total of each counter starts at
+// zero when the sink is created, which is a counter reset to the metrics system.
+//
+// Like the Delta sink, it should wrap the Retry sink, not be wrapped by it,
+// so every delta is added to the total exactly once and in order.
+type Cumulative struct {
+	sink   blip.Sink
+	mux    *sync.Mutex
+	totals map[string]float64 // keyed on blip.MetricKey
+}
+
+var _ blip.Sink = &Cumulative{}
+
+func NewCumulative(sink blip.Sink) *Cumulative {
+	if sink == nil {
+		panic("sink is nil; value required")
+	}
+	if _, ok := sink.(*Cumulative); ok {
+		panic("sink cannot be a Cumulative sink.")
+	}
+	return &Cumulative{
+		sink:   sink,
+		mux:    &sync.Mutex{},
+		totals: map[string]float64{},
+	}
+}
+
+func (c *Cumulative) Name() string {
+	return "cumulative"
+}
+
+// Send converts DELTA_COUNTER values to CUMULATIVE_COUNTER values and forwards
+// the metrics to the wrapped sink. If there are no delta counters, the metrics
+// are forwarded unchanged. This is safe to call from multiple goroutines.
+func (c *Cumulative) Send(ctx context.Context, metrics *blip.Metrics) error {
+	c.mux.Lock()
+	var newValues map[string][]blip.MetricValue
+	for domain, values := range metrics.Values {
+		var converted []blip.MetricValue
+		for i, v := range values {
+			if v.Type != blip.DELTA_COUNTER {
+				if converted != nil {
+					converted = append(converted, v)
+				}
+				continue
+			}
+			if converted == nil {
+				converted = make([]blip.MetricValue, i, len(values))
+				copy(converted, values[:i])
+			}
+			key := blip.MetricKey(domain, v.Name, v.Group)
+			c.totals[key] += v.Value
+			v.Value = c.totals[key]
+			v.Type = blip.CUMULATIVE_COUNTER
+			converted = append(converted, v)
+		}
+		if converted == nil {
+			continue
+		}
+		if newValues == nil {
+			newValues = make(map[string][]blip.MetricValue, len(metrics.Values))
+			for d, v := range metrics.Values {
+				newValues[d] = v
+			}
+		}
+		newValues[domain] = converted
+	}
+	c.mux.Unlock()
+
+	if newValues == nil {
+		return c.sink.Send(ctx, metrics) // no delta counters
+	}
+	m := *metrics // copy all fields, only values changed
+	m.Values = newValues
+	return c.sink.Send(ctx, &m)
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 Block, Inc.
+
+package sink
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/test/mock"
+)
+
+func TestCumulativeSink(t *testing.T) {
+	var got *blip.Metrics
+	mockSink := &mock.Sink{
+		SendFunc: func(ctx context.Context, m *blip.Metrics) error {
+			got = m
+			return nil
+		},
+	}
+	c := NewCumulative(mockSink)
+
+	interval := uint(0)
+	send := func(delta1, delta2 float64) *blip.Metrics {
+		interval++
+		m := &blip.Metrics{
+			Begin:     time.Now(),
+			End:       time.Now(),
+			MonitorId: "m1",
+			Plan:      "p1",
+			Level:     "l1",
+			State:     blip.STATE_ACTIVE,
+			Interval:  interval,
+			Values: map[string][]blip.MetricValue{
+				"status.global": {
+					{Name: "threads_running", Value: 5, Type: blip.GAUGE},
+					{Name: "queries", Value: delta1, Type: blip.DELTA_COUNTER},
+				},
+				"size.table": {
+					{Name: "rows", Value: delta2, Type: blip.DELTA_COUNTER, Group: map[string]string{"db": "test", "tbl": "t1"}},
+				},
+			},
+		}
+		if err := c.Send(context.Background(), m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	send(10, 1)
+	sent := send(5, 2)
+
+	expect := map[string][]blip.MetricValue{
+		"status.global": {
+			{Name: "threads_running", Value: 5, Type: blip.GAUGE},
+			{Name: "queries", Value: 15, Type: blip.CUMULATIVE_COUNTER},
+		},
+		"size.table": {
+			{Name: "rows", Value: 3, Type: blip.CUMULATIVE_COUNTER, Group: map[string]string{"db": "test", "tbl": "t1"}},
+		},
+	}
+	if diff := deep.Equal(got.Values, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// All other fields are copied, like Interval
+	meta := *got
+	meta.Values = sent.Values
+	if diff := deep.Equal(&meta, sent); diff != nil {
+		t.Error(diff)
+	}
+	if got.Interval != 2 {
+		t.Errorf("got interval %d, expected 2", got.Interval)
+	}
+
+	// Input metrics are not modified
+	if sent.Values["status.global"][1].Type != blip.DELTA_COUNTER || sent.Values["status.global"][1].Value != 5 {
+		t.Errorf("input metrics modified: %+v", sent.Values["status.global"][1])
+	}
+}
+
+func TestCumulativeSink_Passthrough(t *testing.T) {
+	var got *blip.Metrics
+	mockSink := &mock.Sink{
+		SendFunc: func(ctx context.Context, m *blip.Metrics) error {
+			got = m
+			return nil
+		},
+	}
+	m := &blip.Metrics{
+		Values: map[string][]blip.MetricValue{
+			"status.global": {{Name: "queries", Value: 1, Type: blip.CUMULATIVE_COUNTER}},
+		},
+	}
+	if err := NewCumulative(mockSink).Send(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+	if got != m {
+		t.Error("metrics without delta counters were copied, expected same pointer")
+	}
+}
@@ -19,6 +19,10 @@ import (
 // as the presence of a Retry sink can cause metrics to be sent to wrapped sink out of order, which
 // can cause incorrect metric values to be submitted then delta calculations are performed.
 // The Delta sink should never be wrapped inside of a Retry sink to prevent this.
+//
+// Plan levels can also convert counters in the engine (blip.Level.Counters), in
+// which case this sink receives DELTA_COUNTER (or GAUGE for rates) values and
+// passes them through.
 type Delta struct {
 	sink     blip.Sink
 	counters map[string]float64 // holds last value of the counter so deltas can be calculated
@@ -97,9 +97,9 @@ func InitFactory(factories blip.Factories) {
 }
 
 func (f *factory) Make(args blip.SinkFactoryArgs) (blip.Sink, error) {
-	// Return early for sinks with no options
+	// Return early for sinks that do not use Retry
 	if args.SinkName == "log" {
-		return NewLogSink(args.MonitorId)
+		return NewLogSink(args.MonitorId, args.Options)
 	}
 	if args.SinkName == "noop" {
 		return noop, nil
@@ -172,10 +172,14 @@ func (f *factory) Make(args blip.SinkFactoryArgs) (blip.Sink, error) {
 
 	// Wrap the sink as needed. All sinks should be wrapped with the
 	// built-in Retry sink, but some need to calculate delta
-	// versions for counters, which should wrap the Retry sink
+	// versions for counters, which should wrap the Retry sink.
+	// Chronosphere (OpenMetrics) needs the reverse: cumulative versions
+	// of delta counters (plan level counters: delta).
 	switch args.SinkName {
 	case "datadog":
 		return NewDelta(NewRetry(retryArgs)), nil
+	case "chronosphere":
+		return NewCumulative(NewRetry(retryArgs)), nil
 	default:
 		return NewRetry(retryArgs), nil
 	}
@@ -4,29 +4,59 @@ package sink
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/event"
 )
 
 // Sink logs metrics.
 type logSink struct {
 	monitorId string
+	format    string
+	out       io.Writer
 }
 
-func NewLogSink(monitorId string) (logSink, error) {
-	return logSink{monitorId: monitorId}, nil
+// NewLogSink returns the log sink. Option format is the output format:
+// text, json, or logfmt. If not set, it's the event log format
+// (config.events.log-format).
+func NewLogSink(monitorId string, opts map[string]string) (logSink, error) {
+	s := logSink{
+		monitorId: monitorId,
+		format:    event.LogFormat(),
+		out:       os.Stdout,
+	}
+	for k, v := range opts {
+		switch k {
+		case "format":
+			if err := blip.ValidLogFormat(v); err != nil {
+				return s, fmt.Errorf("invalid format: %s", err)
+			}
+			s.format = v
+		default:
+			return s, fmt.Errorf("invalid option: %s", k)
+		}
+	}
+	return s, nil
 }
 
 func (s logSink) Send(ctx context.Context, m *blip.Metrics) error {
-	fmt.Printf("# monitor:  %s\n", m.MonitorId)
-	fmt.Printf("# plan:     %s\n", m.Plan)
-	fmt.Printf("# level:    %s\n", m.Level)
-	fmt.Printf("# ts:       %s\n", m.Begin.Format(time.RFC3339Nano))
-	fmt.Printf("# duration: %d ms\n", m.End.Sub(m.Begin).Milliseconds())
+	switch s.format {
+	case blip.LOG_FORMAT_JSON, blip.LOG_FORMAT_LOGFMT:
+		return s.sendLines(m)
+	}
+	fmt.Fprintf(s.out, "# monitor:  %s\n", m.MonitorId)
+	fmt.Fprintf(s.out, "# plan:     %s\n", m.Plan)
+	fmt.Fprintf(s.out, "# level:    %s\n", m.Level)
+	fmt.Fprintf(s.out, "# ts:       %s\n", m.Begin.Format(time.RFC3339Nano))
+	fmt.Fprintf(s.out, "# duration: %d ms\n", m.End.Sub(m.Begin).Milliseconds())
 	for domain, values := range m.Values {
 		for i := range values {
 			metricStr := fmt.Sprintf("%s.%s = %d", domain, values[i].Name, int64(values[i].Value))
@@ -36,13 +66,78 @@ func (s logSink) Send(ctx context.Context, m *blip.Metrics) error {
 			if len(values[i].Meta) > 0 {
 				metricStr = fmt.Sprintf("%s (meta: %s)", metricStr, sortedTuples(values[i].Meta))
 			}
-			fmt.Println(metricStr)
+			fmt.Fprintln(s.out, metricStr)
 		}
 	}
-	fmt.Println()
+	fmt.Fprintln(s.out)
 	return nil
 }
 
+// logMetric is one metric value printed by the log sink in JSON format.
+type logMetric struct {
+	Ts        string            `json:"ts"`
+	MonitorId string            `json:"monitor_id"`
+	Plan      string            `json:"plan"`
+	Level     string            `json:"level"`
+	Domain    string            `json:"domain"`
+	Name      string            `json:"name"`
+	Value     float64           `json:"value"`
+	Group     map[string]string `json:"group,omitempty"`
+	Meta      map[string]string `json:"meta,omitempty"`
+}
+
+// sendLines prints one line per metric value in JSON or logfmt format. Domains
+// are sorted, so output is stable. Logfmt group and meta keys are prefixed
+// "group." and "meta.", like group.db=test.
+func (s logSink) sendLines(m *blip.Metrics) error {
+	ts := m.Begin.Format(time.RFC3339Nano)
+	domains := make([]string, 0, len(m.Values))
+	for domain := range m.Values {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	var b strings.Builder
+	for _, domain := range domains {
+		for _, v := range m.Values[domain] {
+			if s.format == blip.LOG_FORMAT_JSON {
+				bytes, err := json.Marshal(logMetric{
+					Ts:        ts,
+					MonitorId: m.MonitorId,
+					Plan:      m.Plan,
+					Level:     m.Level,
+					Domain:    domain,
+					Name:      v.Name,
+					Value:     v.Value,
+					Group:     v.Group,
+					Meta:      v.Meta,
+				})
+				if err != nil {
+					return err
+				}
+				b.Write(bytes)
+				b.WriteByte('\n')
+				continue
+			}
+			kv := []string{
+				"ts", ts,
+				"monitor_id", m.MonitorId,
+				"plan", m.Plan,
+				"level", m.Level,
+				"domain", domain,
+				"name", v.Name,
+				"value", strconv.FormatFloat(v.Value, 'f', -1, 64),
+			}
+			kv = append(kv, prefixedTuples("group.", v.Group)...)
+			kv = append(kv, prefixedTuples("meta.", v.Meta)...)
+			b.WriteString(blip.Logfmt(kv...))
+			b.WriteByte('\n')
+		}
+	}
+	_, err := io.WriteString(s.out, b.String())
+	return err
+}
+
 func (s logSink) Status() string {
 	return "swimmingly"
 }
@@ -69,3 +164,18 @@ func sortedTuples(m map[string]string) string {
 	}
 	return strings.Join(tuples, ",")
 }
+
+// prefixedTuples returns key-value pairs sorted by key with keys prefixed, like
+// [group.db, test, group.tbl, t1].
+func prefixedTuples(prefix string, m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kv := make([]string, 0, len(m)*2)
+	for _, k := range keys {
+		kv = append(kv, prefix+k, m[k])
+	}
+	return kv
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Block, Inc.
+
+package sink
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cashapp/blip"
+)
+
+func TestLogSinkFormats(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	m := &blip.Metrics{
+		Begin:     ts,
+		End:       ts.Add(5 * time.Millisecond),
+		MonitorId: "db1",
+		Plan:      "p1",
+		Level:     "kpi",
+		Values: map[string][]blip.MetricValue{
+			"status.global": {{Name: "queries", Value: 5}},
+			"size.table":    {{Name: "bytes", Value: 1.5, Group: map[string]string{"tbl": "t1", "db": "test"}}},
+		},
+	}
+
+	expect := map[string]string{
+		blip.LOG_FORMAT_JSON: `{"ts":"2024-05-01T12:00:00Z","monitor_id":"db1","plan":"p1","level":"kpi","domain":"size.table","name":"bytes","value":1.5,"group":{"db":"test","tbl":"t1"}}` + "\n" +
+			`{"ts":"2024-05-01T12:00:00Z","monitor_id":"db1","plan":"p1","level":"kpi","domain":"status.global","name":"queries","value":5}` + "\n",
+		blip.LOG_FORMAT_LOGFMT: "ts=2024-05-01T12:00:00Z monitor_id=db1 plan=p1 level=kpi domain=size.table name=bytes value=1.5 group.db=test group.tbl=t1\n" +
+			"ts=2024-05-01T12:00:00Z monitor_id=db1 plan=p1 level=kpi domain=status.global name=queries value=5\n",
+	}
+	for format, want := range expect {
+		s, err := NewLogSink("db1", map[string]string{"format": format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		s.out = &buf
+		if err := s.Send(context.Background(), m); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != want {
+			t.Errorf("%s: got:\n%s\nexpected:\n%s", format, got, want)
+		}
+	}
+
+	if _, err := NewLogSink("db1", map[string]string{"format": "xml"}); err == nil {
+		t.Error("no error for invalid format")
+	}
+	if _, err := NewLogSink("db1", map[string]string{"foo": "bar"}); err == nil {
+		t.Error("no error for invalid option")
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2024 Block, Inc.
+
+package sink
+
+import (
+	"context"
+
+	"github.com/cashapp/blip"
+	"github.com/cashapp/blip/relabel"
+)
+
+// Relabel applies relabel rules (config.relabel) to metrics before sending them
+// to the wrapped sink. Metrics are copied, not modified, because the same metrics
+// are sent to every sink and each sink can have different rules. If no metrics
+// remain after relabeling, nothing is sent.
+//
+// The Relabel sink should wrap all other sinks (including Delta and Retry) so
+// that rules are applied once per interval.
+type Relabel struct {
+	sink     blip.Sink
+	pipeline *relabel.Pipeline
+}
+
+var _ blip.Sink = &Relabel{}
+
+func NewRelabel(sink blip.Sink, pipeline *relabel.Pipeline) *Relabel {
+	if sink == nil {
+		panic("sink is nil; value required")
+	}
+	return &Relabel{
+		sink:     sink,
+		pipeline: pipeline,
+	}
+}
+
+// Name returns the name of the wrapped sink.
+func (r *Relabel) Name() string {
+	return r.sink.Name()
+}
+
+// Send applies relabel rules and sends the remaining metrics to the wrapped sink.
+func (r *Relabel) Send(ctx context.Context, metrics *blip.Metrics) error {
+	m := r.pipeline.Apply(metrics)
+	if len(m.Values) == 0 {
+		return nil
+	}
+	return r.sink.Send(ctx, m)
+}
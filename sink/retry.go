@@ -9,6 +9,7 @@ import (
 
 	"github.com/cashapp/blip"
 	"github.com/cashapp/blip/event"
+	"github.com/cashapp/blip/health"
 )
 
 const (
@@ -26,6 +27,8 @@ const (
 // metrics and keeps the latest metrics, up to its buffer size, which is configurable.
 //
 // Retry sends SINK_SEND_ERROR events on Send error; the real sink should not.
+// It also records its buffer depth, drops, and errors in the blip domain
+// (metrics/blip).
 type Retry struct {
 	sink blip.Sink
 
@@ -34,7 +37,8 @@ type Retry struct {
 	sendTimeout time.Duration
 	retryWait   time.Duration
 
-	event event.MonitorReceiver
+	event  event.MonitorReceiver
+	health *health.Monitor
 
 	stackMux *sync.Mutex
 	stack    []*blip.Metrics // LIFO
@@ -75,8 +79,9 @@ func NewRetry(args RetryArgs) *Retry {
 	}
 
 	rb := &Retry{
-		sink:  args.Sink,
-		event: event.MonitorReceiver{MonitorId: args.MonitorId},
+		sink:   args.Sink,
+		event:  event.MonitorReceiver{MonitorId: args.MonitorId},
+		health: health.Get(args.MonitorId),
 
 		sendMux:     &sync.Mutex{},
 		sending:     false,
@@ -143,6 +148,7 @@ func (rb *Retry) Send(ctx context.Context, m *blip.Metrics) error {
 		// Send next oldest metrics
 		if err := rb.sink.Send(ctx, next); err != nil {
 			rb.event.Errorf(event.SINK_SEND_ERROR, err.Error())
+			rb.health.RetryError(rb.sink.Name())
 			next = nil // don't pop metrics; retry stack from top down
 		}
 	}
@@ -153,13 +159,16 @@ func (rb *Retry) Send(ctx context.Context, m *blip.Metrics) error {
 func (rb *Retry) push(m *blip.Metrics) {
 	rb.stackMux.Lock()
 	defer rb.stackMux.Unlock()
+	dropped := false
 	if rb.top < rb.max {
 		rb.top++
 	} else {
 		// Push down stack (push off oldest metrics)
 		copy(rb.stack, rb.stack[1:])
+		dropped = true
 	}
 	rb.stack[rb.top] = m
+	rb.health.RetryBuffer(rb.sink.Name(), rb.top+1, dropped)
 }
 
 func (rb *Retry) pop(sent *blip.Metrics) *blip.Metrics {
@@ -192,6 +201,8 @@ func (rb *Retry) pop(sent *blip.Metrics) *blip.Metrics {
 		}
 	}
 
+	rb.health.RetryBuffer(rb.sink.Name(), rb.top+1, false)
+
 	// Stack empty? Nothing to pop.
 	if rb.top == -1 {
 		return nil
@@ -0,0 +1,109 @@
+// Copyright 2024 Block, Inc.
+
+package sink
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/cashapp/blip"
+)
+
+// Sink options for routing metrics to a sink. These options are common to all
+// sinks (built-in and custom), so they're removed by ParseRoute before the
+// remaining options are passed to the sink factory. Values are comma-separated
+// glob patterns (path.Match syntax).
+const (
+	ROUTE_DOMAINS = "domains" // domain names, like "status.*"
+	ROUTE_LEVELS  = "levels"  // level names
+	ROUTE_METRICS = "metrics" // metric names, like "threads_*"
+)
+
+// Route filters metrics sent to one sink by level, domain, and metric name. A
+// zero value Route matches all metrics. The LevelCollector applies the route
+// before calling Sink.Send, so filtered metrics don't use sink buffer space
+// (see Retry).
+type Route struct {
+	Domains []string
+	Levels  []string
+	Metrics []string
+}
+
+// ParseRoute returns the Route from the sink options, and a copy of the options
+// without the route options.
+func ParseRoute(opts map[string]string) (Route, map[string]string, error) {
+	r := Route{}
+	rest := map[string]string{}
+	for k, v := range opts {
+		var patterns *[]string
+		switch k {
+		case ROUTE_DOMAINS:
+			patterns = &r.Domains
+		case ROUTE_LEVELS:
+			patterns = &r.Levels
+		case ROUTE_METRICS:
+			patterns = &r.Metrics
+		default:
+			rest[k] = v
+			continue
+		}
+		for _, p := range strings.Split(v, ",") {
+			p = strings.TrimSpace(p)
+			if p == "" {
+				continue
+			}
+			if _, err := path.Match(p, ""); err != nil {
+				return Route{}, nil, fmt.Errorf("invalid %s pattern: %s: %s", k, p, err)
+			}
+			*patterns = append(*patterns, p)
+		}
+	}
+	return r, rest, nil
+}
+
+// Filter returns the metrics that match the route, or nil if none match. If all
+// metrics match, it returns the given metrics; else, it returns a copy with only
+// the matching metrics. The given metrics are not modified because they're sent
+// to every sink.
+func (r Route) Filter(m *blip.Metrics) *blip.Metrics {
+	if len(r.Levels) > 0 && !match(r.Levels, m.Level) {
+		return nil
+	}
+	if len(r.Domains) == 0 && len(r.Metrics) == 0 {
+		return m
+	}
+	f := *m
+	f.Values = make(map[string][]blip.MetricValue, len(m.Values))
+	for domain, values := range m.Values {
+		if len(r.Domains) > 0 && !match(r.Domains, domain) {
+			continue
+		}
+		if len(r.Metrics) == 0 {
+			f.Values[domain] = values
+			continue
+		}
+		keep := make([]blip.MetricValue, 0, len(values))
+		for _, v := range values {
+			if match(r.Metrics, v.Name) {
+				keep = append(keep, v)
+			}
+		}
+		if len(keep) > 0 {
+			f.Values[domain] = keep
+		}
+	}
+	if len(f.Values) == 0 {
+		return nil
+	}
+	return &f
+}
+
+func match(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok { // patterns validated by ParseRoute
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package sink
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/cashapp/blip"
+)
+
+func routeMetrics() *blip.Metrics {
+	return &blip.Metrics{
+		MonitorId: "db1",
+		Level:     "kpi",
+		Values: map[string][]blip.MetricValue{
+			"status.global": {
+				{Name: "queries", Value: 10, Type: blip.CUMULATIVE_COUNTER},
+				{Name: "threads_running", Value: 2, Type: blip.GAUGE},
+			},
+			"size.table": {
+				{Name: "bytes", Value: 100, Type: blip.GAUGE, Group: map[string]string{"db": "test", "tbl": "t1"}},
+			},
+		},
+	}
+}
+
+func TestParseRoute(t *testing.T) {
+	route, opts, err := ParseRoute(map[string]string{
+		"domains":     "status.*, size.table",
+		"levels":      "kpi",
+		"metrics":     "threads_*",
+		"buffer-size": "10",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := Route{
+		Domains: []string{"status.*", "size.table"},
+		Levels:  []string{"kpi"},
+		Metrics: []string{"threads_*"},
+	}
+	if diff := deep.Equal(route, expect); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(opts, map[string]string{"buffer-size": "10"}); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, _, err := ParseRoute(map[string]string{"domains": "status.["}); err == nil {
+		t.Error("no error for invalid pattern")
+	}
+}
+
+func TestRouteFilter(t *testing.T) {
+	// Zero value Route matches all: same metrics returned
+	m := routeMetrics()
+	if got := (Route{}).Filter(m); got != m {
+		t.Errorf("zero value Route did not return same metrics")
+	}
+
+	// Level doesn't match
+	if got := (Route{Levels: []string{"slow"}}).Filter(m); got != nil {
+		t.Errorf("got %v, expected nil for level that doesn't match", got)
+	}
+
+	// Filter domains and metrics
+	got := (Route{Domains: []string{"status.*"}, Metrics: []string{"threads_*"}}).Filter(m)
+	expect := map[string][]blip.MetricValue{
+		"status.global": {
+			{Name: "threads_running", Value: 2, Type: blip.GAUGE},
+		},
+	}
+	if got == nil {
+		t.Fatal("got nil, expected metrics")
+	}
+	if diff := deep.Equal(got.Values, expect); diff != nil {
+		t.Error(diff)
+	}
+	if got.Level != "kpi" || got.MonitorId != "db1" {
+		t.Errorf("metrics fields not copied: %+v", got)
+	}
+	// Given metrics not modified
+	if diff := deep.Equal(m, routeMetrics()); diff != nil {
+		t.Error(diff)
+	}
+
+	// No metrics match
+	if got := (Route{Metrics: []string{"nope"}}).Filter(m); got != nil {
+		t.Errorf("got %v, expected nil when no metrics match", got)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -14,6 +15,8 @@ import (
 
 	my "github.com/go-mysql/errors"
 	ver "github.com/hashicorp/go-version"
+
+	"github.com/cashapp/blip"
 )
 
 // Float64 converts string to float64. If successful, it returns the float64
@@ -109,6 +112,48 @@ func MySQLVersionGTE(version string, db *sql.DB, ctx context.Context) (bool, err
 	return cuurentVersion.GreaterThanOrEqual(targetVersion), nil
 }
 
+// VersionGTE returns true if version >= min, like VersionGTE("8.0.32", "8.0.22").
+// It returns false if either version is empty or invalid.
+func VersionGTE(version, min string) bool {
+	v, err := ver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	m, err := ver.NewVersion(min)
+	if err != nil {
+		return false
+	}
+	return v.GreaterThanOrEqual(m)
+}
+
+var reVersion = regexp.MustCompile(`^\d+\.\d+\.\d+`)
+
+// Flavor returns the MySQL flavor (blip.FLAVOR_ const) and version like "8.0.32".
+// Aurora is detected by @@aurora_version, RDS by @@basedir, MariaDB and Percona
+// by @@version and @@version_comment. Else the flavor is MySQL.
+func Flavor(ctx context.Context, db *sql.DB) (string, string, error) {
+	var version, comment, basedir string
+	err := db.QueryRowContext(ctx, "SELECT @@version, @@version_comment, @@basedir").Scan(&version, &comment, &basedir)
+	if err != nil {
+		return "", "", err
+	}
+
+	flavor := blip.FLAVOR_MYSQL
+	var aurora string
+	switch {
+	case strings.Contains(strings.ToLower(version), "mariadb"):
+		flavor = blip.FLAVOR_MARIADB
+	case db.QueryRowContext(ctx, "SELECT @@aurora_version").Scan(&aurora) == nil:
+		flavor = blip.FLAVOR_AURORA
+	case strings.HasPrefix(basedir, "/rdsdbbin/"):
+		flavor = blip.FLAVOR_RDS
+	case strings.Contains(strings.ToLower(comment), "percona"):
+		flavor = blip.FLAVOR_PERCONA
+	}
+
+	return flavor, reVersion.FindString(version), nil
+}
+
 // ReadOnly returns true if the err is a MySQL read-only error caused by writing
 // to a read-only instance.
 func ReadOnly(err error) bool {
@@ -27,3 +27,23 @@ func TestFloat64(t *testing.T) {
 		}
 	}
 }
+
+func TestVersionGTE(t *testing.T) {
+	var testCases = []struct {
+		version string
+		min     string
+		gte     bool
+	}{
+		{"8.0.32", "8.0.22", true},
+		{"8.0.22", "8.0.22", true},
+		{"8.0.14", "8.0.22", false},
+		{"8.4.0", "8.0.22", true}, // minor > 0
+		{"5.7.44", "8.0.14", false},
+		{"", "8.0.14", false}, // unknown
+	}
+	for _, tc := range testCases {
+		if got := VersionGTE(tc.version, tc.min); got != tc.gte {
+			t.Errorf("VersionGTE(%s, %s) = %t, expected %t", tc.version, tc.min, got, tc.gte)
+		}
+	}
+}
@@ -1,7 +1,8 @@
 package status
 
 const (
-	SERVER = "server"
+	SERVER    = "server"
+	SCHEDULER = "scheduler"
 
 	MONITOR     = "monitor"
 	MONITOR_DSN = "dsn"
@@ -9,6 +10,9 @@ const (
 	PLAN_CHANGER         = "plan-changer"
 	PLAN_CHANGER_STATE   = "state"
 	PLAN_CHANGER_PENDING = "state-pending"
+	PLAN_PIN             = "plan-pin"
+
+	MAINTENANCE = "maintenance"
 
 	LEVEL_COLLECTOR   = "level-collector"
 	LEVEL_PLAN        = "level-plan"
@@ -17,9 +21,12 @@ const (
 	LEVEL_SINKS       = "level-sinks"
 	LEVEL_CHANGE_PLAN = "level-change-plan"
 
-	ENGINE_COLLECT = "engine-collect"
-	ENGINE_PREPARE = "engine-prepare"
-	ENGINE_PLAN    = "engine-plan"
+	ENGINE_COLLECT     = "engine-collect"
+	ENGINE_CONDITIONS  = "engine-conditions"
+	ENGINE_LOAD_SHED   = "engine-load-shed"
+	ENGINE_PREPARE     = "engine-prepare"
+	ENGINE_PLAN        = "engine-plan"
+	ENGINE_UNSUPPORTED = "engine-unsupported"
 
 	HEARTBEAT_READER = "heartbeat-reader"
 	HEARTBEAT_WRITER = "heartbeat-writer"
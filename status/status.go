@@ -2,51 +2,197 @@
 
 // Package status provides real-time instantaneous status of every Blip component.
 // The only caller is server.API via GET /status.
+//
+// Status is reported two ways. The original string API (ReportBlip and
+// ReportMonitors) returns the last message per component. Records (BlipRecords
+// and MonitorRecords) return a Record per component with state, timestamps,
+// counters, and a short history. Both are set by the same calls: Blip, Monitor,
+// MonitorState, and RemoveComponent.
+//
+// By convention, components prefixed with "error:" report an error for the
+// component, like "error:collect", until removed. In records, the error is set
+// on the component without the prefix ("collect"), which remains in state error
+// until the error component is removed.
 package status
 
 import (
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 )
 
+// Component states
+const (
+	STATE_OK      = "ok"
+	STATE_ERROR   = "error"
+	STATE_STOPPED = "stopped"
+)
+
+// HistorySize is the number of changes kept per component in Record.History.
+var HistorySize = 10
+
+// Record is the structured status of one component.
+type Record struct {
+	Component string     `json:"component"`
+	State     string     `json:"state"`                // STATE_ const
+	Message   string     `json:"message"`              // last message
+	Error     string     `json:"error,omitempty"`      // error until removed ("error:" component)
+	Since     time.Time  `json:"since"`                // when State changed
+	Updated   time.Time  `json:"updated"`              // last update
+	LastError *time.Time `json:"last_error,omitempty"` // last update in state error
+	Updates   uint64     `json:"updates"`              // number of updates
+	Errors    uint64     `json:"errors"`               // number of updates in state error
+	History   []Change   `json:"history"`              // last HistorySize changes, oldest first
+}
+
+// Change is one change of state or error in Record.History.
+type Change struct {
+	Ts      time.Time `json:"ts"`
+	State   string    `json:"state"`
+	Message string    `json:"message"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// update sets the state and message. It records a change in the history only
+// if the state or error changed, not on every update, because some components
+// are updated several times per second.
+func (r *Record) update(now time.Time, state, msg string) {
+	if r.Error != "" {
+		state = STATE_ERROR // error component not removed yet
+	}
+	if state != r.State {
+		r.State = state
+		r.Since = now
+	}
+	r.Message = msg
+	r.Updated = now
+	r.Updates++
+	errMsg := r.Error
+	if state == STATE_ERROR {
+		r.Errors++
+		r.LastError = &now
+		if errMsg == "" {
+			errMsg = msg // MonitorState error
+		}
+	}
+	if n := len(r.History); HistorySize <= 0 || (n > 0 && r.History[n-1].State == state && r.History[n-1].Error == errMsg) {
+		return // no history or no change
+	}
+	if len(r.History) >= HistorySize {
+		copy(r.History, r.History[len(r.History)-HistorySize+1:])
+		r.History = r.History[:HistorySize-1]
+	}
+	r.History = append(r.History, Change{Ts: now, State: state, Message: msg, Error: errMsg})
+}
+
+func (r *Record) copy() Record {
+	c := *r
+	c.History = append([]Change{}, r.History...)
+	return c
+}
+
 type status struct {
 	*sync.Mutex
-	blip     map[string]string
-	monitors map[string]map[string]string
-	counters map[string]map[string]*uint64
+	blip        map[string]string
+	monitors    map[string]map[string]string
+	blipRecords records
+	records     map[string]records
 }
 
-var s = &status{
-	Mutex:    &sync.Mutex{},
-	blip:     map[string]string{},
-	monitors: map[string]map[string]string{},  // monitorId => component
-	counters: map[string]map[string]*uint64{}, // monitorId => component
+var s = newStatus()
+
+func newStatus() *status {
+	return &status{
+		Mutex:       &sync.Mutex{},
+		blip:        map[string]string{},
+		monitors:    map[string]map[string]string{}, // monitorId => component
+		blipRecords: records{},
+		records:     map[string]records{}, // monitorId => component
+	}
 }
 
 // Reset resets everything to zero values. It's only used for test.
 func Reset() {
-	s = &status{
-		Mutex:    &sync.Mutex{},
-		blip:     map[string]string{},
-		monitors: map[string]map[string]string{},  // monitorId => component
-		counters: map[string]map[string]*uint64{}, // monitorId => component
+	s = newStatus()
+}
+
+// records are component records keyed on component.
+type records map[string]*Record
+
+// set sets the record for the component. Caller must lock s.
+func (rs records) set(component, state, msg string) {
+	c, isErr := errorComponent(component)
+	r, ok := rs[c]
+	if !ok {
+		r = &Record{Component: c}
+		rs[c] = r
+	}
+	if isErr {
+		r.Error = msg
+		state = STATE_ERROR
+	}
+	r.update(time.Now(), state, msg)
+}
+
+// remove removes the record for the component. If it's an error component,
+// the error is removed and the component record is kept. Caller must lock s.
+func (rs records) remove(component string) {
+	c, isErr := errorComponent(component)
+	if !isErr {
+		delete(rs, component)
+		return
+	}
+	r, ok := rs[c]
+	if !ok || r.Error == "" {
+		return
+	}
+	r.Error = ""
+	r.update(time.Now(), STATE_OK, r.Message)
+}
+
+func (rs records) copy() map[string]Record {
+	c := map[string]Record{}
+	for component, r := range rs {
+		c[component] = r.copy()
 	}
+	return c
+}
+
+func errorComponent(component string) (string, bool) {
+	if !strings.HasPrefix(component, "error:") {
+		return component, false
+	}
+	return strings.TrimPrefix(component, "error:"), true
 }
 
 func Blip(component, msg string, args ...interface{}) {
 	s.Lock()
-	s.blip[component] = fmt.Sprintf(msg, args...)
-	s.Unlock()
+	defer s.Unlock()
+	msg = fmt.Sprintf(msg, args...)
+	s.blip[component] = msg
+	s.blipRecords.set(component, STATE_OK, msg)
 }
 
+// Monitor sets the monitor component status. The state is STATE_OK unless the
+// component has an error (see package doc). Use MonitorState to set the state.
 func Monitor(monitorId, component string, msg string, args ...interface{}) {
+	MonitorState(monitorId, component, STATE_OK, msg, args...)
+}
+
+// MonitorState sets the monitor component status and state. Unlike an "error:"
+// component, STATE_ERROR applies only to this update: the next update without
+// an error sets another state.
+func MonitorState(monitorId, component, state string, msg string, args ...interface{}) {
 	s.Lock()
 	defer s.Unlock()
 	if _, ok := s.monitors[monitorId]; !ok {
 		s.monitors[monitorId] = map[string]string{}
-		s.counters[monitorId] = map[string]*uint64{}
+		s.records[monitorId] = records{}
 	}
-	s.monitors[monitorId][component] = fmt.Sprintf(msg, args...)
+	msg = fmt.Sprintf(msg, args...)
+	s.monitors[monitorId][component] = msg
+	s.records[monitorId].set(component, state, msg)
 }
 
 func RemoveComponent(monitorId, component string) {
@@ -54,6 +200,7 @@ func RemoveComponent(monitorId, component string) {
 	m, ok := s.monitors[monitorId]
 	if ok {
 		delete(m, component)
+		s.records[monitorId].remove(component)
 	}
 	s.Unlock()
 }
@@ -71,13 +218,7 @@ func ReportBlip() map[string]string {
 func ReportMonitors(ids ...string) map[string]map[string]string {
 	s.Lock()
 	defer s.Unlock()
-	var allow map[string]bool
-	if len(ids) > 0 {
-		allow = map[string]bool{}
-		for _, id := range ids {
-			allow[id] = true
-		}
-	}
+	allow := allowIds(ids)
 	status := map[string]map[string]string{}
 	for monitorId := range s.monitors {
 		if len(allow) > 0 && !allow[monitorId] {
@@ -91,9 +232,43 @@ func ReportMonitors(ids ...string) map[string]map[string]string {
 	return status
 }
 
+// BlipRecords returns a copy of Blip component records keyed on component.
+func BlipRecords() map[string]Record {
+	s.Lock()
+	defer s.Unlock()
+	return s.blipRecords.copy()
+}
+
+// MonitorRecords returns a copy of monitor component records keyed on monitor
+// ID and component. If ids are given, only those monitors are returned.
+func MonitorRecords(ids ...string) map[string]map[string]Record {
+	s.Lock()
+	defer s.Unlock()
+	allow := allowIds(ids)
+	status := map[string]map[string]Record{}
+	for monitorId, rs := range s.records {
+		if len(allow) > 0 && !allow[monitorId] {
+			continue
+		}
+		status[monitorId] = rs.copy()
+	}
+	return status
+}
+
 func RemoveMonitor(monitorId string) {
 	s.Lock()
 	delete(s.monitors, monitorId)
-	delete(s.counters, monitorId)
+	delete(s.records, monitorId)
 	s.Unlock()
 }
+
+func allowIds(ids []string) map[string]bool {
+	if len(ids) == 0 {
+		return nil
+	}
+	allow := map[string]bool{}
+	for _, id := range ids {
+		allow[id] = true
+	}
+	return allow
+}
@@ -5,10 +5,134 @@ package status_test
 import (
 	"testing"
 
+	"github.com/go-test/deep"
+
 	"github.com/cashapp/blip/status"
 )
 
 func TestStatus(t *testing.T) {
 	status.Reset()
-	// @todo
+
+	status.Blip(status.SERVER, "running")
+	status.Monitor("db1", status.MONITOR, "starting")
+	status.Monitor("db1", status.MONITOR, "running")
+	status.Monitor("db2", status.MONITOR, "running")
+
+	// Original string API is unchanged
+	if diff := deep.Equal(status.ReportBlip(), map[string]string{status.SERVER: "running"}); diff != nil {
+		t.Error(diff)
+	}
+	expect := map[string]map[string]string{
+		"db1": {status.MONITOR: "running"},
+	}
+	if diff := deep.Equal(status.ReportMonitors("db1"), expect); diff != nil {
+		t.Error(diff)
+	}
+
+	r := status.BlipRecords()[status.SERVER]
+	if r.State != status.STATE_OK || r.Message != "running" || r.Updates != 1 {
+		t.Errorf("got blip record %+v, expected state ok, message running, 1 update", r)
+	}
+
+	records := status.MonitorRecords("db1")
+	if len(records) != 1 {
+		t.Fatalf("got records for %d monitors, expected 1: %+v", len(records), records)
+	}
+	r = records["db1"][status.MONITOR]
+	if r.Component != status.MONITOR || r.State != status.STATE_OK || r.Message != "running" || r.Updates != 2 || r.Errors != 0 || r.LastError != nil {
+		t.Errorf("got record %+v", r)
+	}
+	if len(r.History) != 1 || r.History[0].Message != "starting" {
+		t.Errorf("got history %+v, expected only starting (no change of state or error)", r.History)
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	status.Reset()
+
+	// "error:" component sets the error on the component until removed
+	status.Monitor("db1", "collect", "collecting")
+	status.Monitor("db1", "error:collect", "access denied")
+	status.Monitor("db1", "collect", "collecting again")
+
+	r := status.MonitorRecords()["db1"]["collect"]
+	if r.State != status.STATE_ERROR || r.Error != "access denied" || r.Message != "collecting again" {
+		t.Errorf("got record %+v, expected state error with error and last message", r)
+	}
+	if r.Errors != 2 || r.LastError == nil {
+		t.Errorf("got %d errors, last error %v; expected 2 errors and last error set", r.Errors, r.LastError)
+	}
+	since := r.Since
+
+	status.RemoveComponent("db1", "error:collect")
+	r = status.MonitorRecords()["db1"]["collect"]
+	if r.State != status.STATE_OK || r.Error != "" || r.LastError == nil {
+		t.Errorf("got record %+v, expected state ok, no error, last error set", r)
+	}
+	if r.Since.Before(since) {
+		t.Errorf("since not updated: %s", r.Since)
+	}
+	if got := status.ReportMonitors()["db1"]; len(got) != 1 || got["collect"] != "collecting again" {
+		t.Errorf("got string status %+v, expected only collect", got)
+	}
+
+	// MonitorState sets the state only for that update
+	status.MonitorState("db1", "writer", status.STATE_ERROR, "write error")
+	if r := status.MonitorRecords()["db1"]["writer"]; r.State != status.STATE_ERROR || r.Error != "" {
+		t.Errorf("got record %+v, expected state error without error", r)
+	}
+	status.Monitor("db1", "writer", "write")
+	if r := status.MonitorRecords()["db1"]["writer"]; r.State != status.STATE_OK || r.Errors != 1 {
+		t.Errorf("got record %+v, expected state ok and 1 error", r)
+	}
+
+	// Removing the component removes the record
+	status.RemoveComponent("db1", "writer")
+	if _, ok := status.MonitorRecords()["db1"]["writer"]; ok {
+		t.Errorf("writer record not removed")
+	}
+	status.RemoveMonitor("db1")
+	if len(status.MonitorRecords()) != 0 {
+		t.Errorf("monitor records not removed")
+	}
+}
+
+func TestStatusHistory(t *testing.T) {
+	status.Reset()
+	defer func(n int) { status.HistorySize = n }(status.HistorySize)
+	status.HistorySize = 3
+
+	// Only changes of state or error are recorded: "1" is the first change,
+	// "2" and "4" are the same state and error as the previous change
+	status.Monitor("db1", "c", "1")
+	status.Monitor("db1", "c", "2")
+	status.MonitorState("db1", "c", status.STATE_ERROR, "3")
+	status.MonitorState("db1", "c", status.STATE_ERROR, "3")
+	status.Monitor("db1", "c", "4")
+	status.MonitorState("db1", "c", status.STATE_ERROR, "5")
+	status.MonitorState("db1", "c", status.STATE_ERROR, "6")
+	r := status.MonitorRecords()["db1"]["c"]
+	got := []string{}
+	for _, c := range r.History {
+		got = append(got, c.Message)
+	}
+	if diff := deep.Equal(got, []string{"4", "5", "6"}); diff != nil {
+		t.Error(diff)
+	}
+	if r.Updates != 7 {
+		t.Errorf("got %d updates, expected 7", r.Updates)
+	}
+
+	// Records are copies
+	r.History[0].Message = "x"
+	if status.MonitorRecords()["db1"]["c"].History[0].Message != "4" {
+		t.Errorf("history changed by caller")
+	}
+}
+
+func BenchmarkStatusMonitor(b *testing.B) {
+	status.Reset()
+	for i := 0; i < b.N; i++ {
+		status.Monitor("db1", "c", "collecting")
+	}
 }
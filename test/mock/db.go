@@ -0,0 +1,72 @@
+// Copyright 2024 Block, Inc.
+
+package mock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+
+	"github.com/cashapp/blip"
+)
+
+// DB_DRIVER is the name of the mock database/sql driver. Use NewDB, not
+// sql.Open, to create a mock DB.
+const DB_DRIVER = "blip-mock"
+
+// ErrQuery is returned by the mock driver for every query and exec.
+var ErrQuery = errors.New("mock DB: query not supported")
+
+var registerOnce sync.Once
+
+// NewDB returns a *sql.DB that does not connect to MySQL. Ping succeeds, and
+// queries and execs return ErrQuery. It's used to test and benchmark monitors
+// without MySQL, with mock collectors (MetricsCollector) that don't query
+// MySQL either.
+func NewDB() *sql.DB {
+	registerOnce.Do(func() {
+		sql.Register(DB_DRIVER, dbDriver{})
+	})
+	db, _ := sql.Open(DB_DRIVER, "") // never fails: dbDriver.Open doesn't fail
+	return db
+}
+
+type dbDriver struct{}
+
+func (dbDriver) Open(string) (driver.Conn, error) {
+	return dbConn{}, nil
+}
+
+type dbConn struct{}
+
+var _ driver.Pinger = dbConn{}
+var _ driver.QueryerContext = dbConn{}
+var _ driver.ExecerContext = dbConn{}
+
+func (dbConn) Prepare(string) (driver.Stmt, error) { return nil, ErrQuery }
+func (dbConn) Close() error                        { return nil }
+func (dbConn) Begin() (driver.Tx, error)           { return nil, ErrQuery }
+func (dbConn) Ping(context.Context) error          { return nil }
+
+func (dbConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return nil, ErrQuery
+}
+
+func (dbConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return nil, ErrQuery
+}
+
+// DbFactory is a blip.DbFactory that makes mock DBs (NewDB), or returns Err
+// if set.
+type DbFactory struct {
+	Err error
+}
+
+func (f DbFactory) Make(blip.ConfigMonitor) (*sql.DB, string, error) {
+	if f.Err != nil {
+		return nil, "", f.Err
+	}
+	return NewDB(), "mock", nil
+}
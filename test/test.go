@@ -82,11 +82,9 @@ func ReadPlan(t *testing.T, file string) blip.Plan {
 
 	levels := make(map[string]blip.Level, len(pf))
 	for k := range pf {
-		levels[k] = blip.Level{
-			Name:    k, // must have, levels are collected by name
-			Freq:    pf[k].Freq,
-			Collect: pf[k].Collect,
-		}
+		level := *pf[k]
+		level.Name = k // must have, levels are collected by name
+		levels[k] = level
 	}
 
 	return blip.Plan{